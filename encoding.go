@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// toUTF8 transcodes the input from charset to UTF-8. A BOM takes precedence
+// over charset, and without either UTF-16 is detected from the zero bytes of
+// the leading ASCII character, otherwise the input is taken as UTF-8.
+func toUTF8(data []byte, charset string) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data, charset = data[len(bomUTF8):], "utf-8"
+	case bytes.HasPrefix(data, bomUTF16LE):
+		data, charset = data[len(bomUTF16LE):], "utf-16le"
+	case bytes.HasPrefix(data, bomUTF16BE):
+		data, charset = data[len(bomUTF16BE):], "utf-16be"
+	case charset == "":
+		charset = detectCharset(data)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding %q", charset)
+	}
+	if enc == unicode.UTF8 {
+		return escapeInvalidUTF8(data), nil
+	}
+	return enc.NewDecoder().Bytes(data)
+}
+
+func detectCharset(data []byte) string {
+	if len(data) < 2 {
+		return "utf-8"
+	}
+	if data[0] == 0 && data[1] != 0 {
+		return "utf-16be"
+	}
+	if data[0] != 0 && data[1] == 0 {
+		return "utf-16le"
+	}
+	return "utf-8"
+}
+
+// escapeInvalidUTF8 replaces every byte that is not valid UTF-8 with the JSON
+// escaped text `\\xff`, so it shows up as `\xff` inside strings instead of
+// being silently decoded as U+FFFD.
+func escapeInvalidUTF8(data []byte) []byte {
+	if utf8.Valid(data) {
+		return data
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+64))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			fmt.Fprintf(out, `\\x%02x`, data[0])
+		} else {
+			out.Write(data[:size])
+		}
+		data = data[size:]
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		charset  string
+		expected string
+	}{
+		{"utf-8", []byte(`{"a":"中文"}`), "", `{"a":"中文"}`},
+		{"utf-8 bom", []byte("\xEF\xBB\xBF{\"a\":1}"), "", `{"a":1}`},
+		{"utf-16le bom", []byte("\xFF\xFE{\x00\"\x00a\x00\"\x00:\x001\x00}\x00"), "", `{"a":1}`},
+		{"utf-16be bom", []byte("\xFE\xFF\x00{\x00\"\x00a\x00\"\x00:\x001\x00}"), "gbk", `{"a":1}`},
+		{"utf-16le", []byte("[\x001\x00]\x00"), "", `[1]`},
+		{"utf-16be", []byte("\x00[\x001\x00]"), "", `[1]`},
+		{"gbk", []byte("[\"\xD6\xD0\xCE\xC4\"]"), "gbk", `["中文"]`},
+		{"gb18030", []byte("[\"\xD6\xD0\xCE\xC4\"]"), "GB18030", `["中文"]`},
+		{"invalid utf-8", []byte("[\"a\xFFb\"]"), "", `["a\\xffb"]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := toUTF8(test.data, test.charset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+	if _, err := toUTF8([]byte("{}"), "unknown"); err == nil {
+		t.Fatalf("expected error for unknown encoding")
+	}
+}
+
+func TestInvalidUTF8String(t *testing.T) {
+	data, err := toUTF8([]byte("{\"a\":\"x\xFE\"}"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := fromBytes(data)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	if v := tree.find([]string{"a"}).(*stringNode).data; v != `x\xfe` {
+		t.Fatalf("invalid byte should be visible, got %q", v)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/jroimartin/gocui"
+)
+
+// treeFilter is the search whose matches the tree view is pruned to, it is
+// only accessed by the UI goroutine.
+var treeFilter searchState
+
+// filterMatches are the matches of treeFilter shown by the tree view, nil
+// when the whole tree is shown.
+var filterMatches *filterTrie
+
+// filterTrie holds the positions of the matches of a filter, by key. The
+// positions which end at a node without children are the matches.
+type filterTrie struct {
+	keys     []string // in the order of the document
+	children map[string]*filterTrie
+}
+
+// newFilterTrie returns the trie of matches, which are in document order.
+func newFilterTrie(matches []treePosition) *filterTrie {
+	root := &filterTrie{}
+	for _, position := range matches {
+		t := root
+		for _, key := range position {
+			t = t.child(key)
+		}
+	}
+	return root
+}
+
+func (t *filterTrie) child(key string) *filterTrie {
+	if child, isOk := t.children[key]; isOk {
+		return child
+	}
+	if t.children == nil {
+		t.children = make(map[string]*filterTrie)
+	}
+	child := &filterTrie{}
+	t.children[key] = child
+	t.keys = append(t.keys, key)
+	return child
+}
+
+// newRows returns the rows of the tree view, pruned by the filter if any.
+func newRows() *treeRows {
+	rows := newTreeRows(tree)
+	if filterMatches != nil && tree != nil {
+		rows = newFilteredTreeRows(tree, filterMatches)
+	}
+	rows.highlight = highlightMatcher()
+	return rows
+}
+
+// filterStatus describes the filter for the path bar, it is empty without a
+// filter.
+func filterStatus() string {
+	if treeFilter.query == "" {
+		return ""
+	}
+	return "filter " + strconv.Quote(treeFilter.query) + ": " + treeFilter.status()
+}
+
+// openFilter opens the filter prompt, the tree is pruned as the pattern is
+// typed and shown whole again if it is cleared or cancelled.
+func openFilter(g *gocui.Gui, v *gocui.View) error {
+	return openPrompt(g, &prompt{
+		title: func() string {
+			return matchTitle("filter", &treeFilter)
+		},
+		input:    treeFilter.query,
+		matching: true,
+		change:   startFilter,
+		done: func(g *gocui.Gui, input string) error {
+			return drawPath(g)
+		},
+		cancel: clearFilter,
+	})
+}
+
+// startFilter filters the tree by pattern in the background.
+func startFilter(g *gocui.Gui, pattern string) error {
+	if pattern == "" {
+		return clearFilter(g)
+	}
+	treeFilter.start(g, pattern, applyFilter)
+	return drawPath(g)
+}
+
+// clearFilter shows the whole tree again, as it was expanded before it was
+// filtered.
+func clearFilter(g *gocui.Gui) error {
+	if treeFilter.query == "" && filterMatches == nil {
+		return nil
+	}
+	treeFilter.reset()
+	return applyFilter(g)
+}
+
+// applyFilter replaces the rows of the tree view with the ones of the matches
+// of the filter, the cursor goes to the first match. Without a filter, it
+// goes back to the row of the node it was on.
+func applyFilter(g *gocui.Gui) error {
+	selected := findTreePosition(g)
+	filterMatches = nil
+	if treeFilter.query != "" {
+		filterMatches = newFilterTrie(treeFilter.matches)
+	}
+	treeLines = newRows()
+	treeController.Source = treeLines
+	index := treeLines.locate(selected)
+	if filterMatches != nil && len(treeFilter.matches) > 0 {
+		index = treeLines.reveal(treeFilter.matches[0])
+	}
+	tv, err := g.View(treeView)
+	if err != nil {
+		return err
+	}
+	if err := treeController.Show(tv, index); err != nil {
+		return err
+	}
+	_ = drawJSON(g)
+	return drawPath(g)
+}
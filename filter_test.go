@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func filterTree(t *testing.T, raw []byte, query string) (treeNode, *treeRows) {
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	m, _ := newMatcher(query, matchOptions{})
+	result, err := searchRaw(context.Background(), raw, m)
+	if err != nil {
+		t.Fatalf("failed to search %q: %v", query, err)
+	}
+	return tree, newFilteredTreeRows(tree, newFilterTrie(result.matches))
+}
+
+func TestFilteredTreeRows(t *testing.T) {
+	raw := []byte(`{"a": 1, "b": {"c": [1, 2, {"d": "x"}], "e": {"x": [3]}}, "f": "y"}`)
+	tree, rows := filterTree(t, raw, "x")
+	expected := "root\n└─ b\n│  ├─ c\n│  │  └─ [2]\n│  │  │  └─ d\n│  └─ e\n│  │  └─ x\n│  │  │  └─ [0]\n"
+	if result := drawRows(rows); result != expected {
+		t.Fatalf("unexpected filtered rows:\n%s", result)
+	}
+	if node := rows.node(4); node != tree.find([]string{"b", "c", "[2]", "d"}) {
+		t.Fatalf("unexpected node of the row of a match")
+	}
+
+	rows.toggle(1)
+	if result := drawRows(rows); result != "root\n└─ b (+)\n" {
+		t.Fatalf("unexpected rows after collapse:\n%s", result)
+	}
+	if b := tree.find([]string{"b"}); !b.isExpanded() {
+		t.Fatalf("collapsing a filtered row shouldn't collapse its node")
+	}
+	if index := rows.reveal(treePosition{"b", "e", "x"}); index != 6 {
+		t.Fatalf("unexpected row %d of a match:\n%s", index, drawRows(rows))
+	}
+	if index := rows.locate(treePosition{"a"}); index != 0 {
+		t.Fatalf("expected a hidden node to be located at the root, got %d", index)
+	}
+
+	_, rows = filterTree(t, raw, "zzz")
+	if result := drawRows(rows); result != "root\n" {
+		t.Fatalf("unexpected rows without a match:\n%s", result)
+	}
+}
+
+func TestFilterTrie(t *testing.T) {
+	trie := newFilterTrie([]treePosition{{"b", "[1]"}, {"a"}, {"b", "[0]", "c"}, {"b", "[0]", "d"}})
+	if strings.Join(trie.keys, ",") != "b,a" || strings.Join(trie.children["b"].keys, ",") != "[1],[0]" {
+		t.Fatalf("the keys should be in the order of the matches")
+	}
+	if len(trie.children["b"].children["[0]"].keys) != 2 || len(trie.children["a"].keys) != 0 {
+		t.Fatalf("unexpected trie")
+	}
+}
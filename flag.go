@@ -63,23 +63,94 @@ func (h *helpMsg) String() string {
 }
 
 type flagArgs struct {
-	File string `json:"file"`
+	File      string `json:"file"`
+	Text      bool   `json:"text"`
+	Clipboard bool   `json:"clipboard"`
+	Encoding  string `json:"encoding"`
+	Python    bool   `json:"python"`
+	Index     bool   `json:"index"`
+	Depth     int    `json:"depth"`
+}
+
+// validate reports the flags which can't be used together.
+func (f *flagArgs) validate() error {
+	if f.Text && f.Python {
+		return fmt.Errorf("-text and -python can't be used together")
+	}
+	return nil
+}
+
+func (f *flagArgs) decoder() decodeFunc {
+	if f.Text {
+		return fromText
+	}
+	if f.Python {
+		return fromPython
+	}
+	return fromBytes
+}
+
+// loader returns the loader of the input selected by the flags.
+func (f *flagArgs) loader() *treeLoader {
+	loader := &treeLoader{depth: f.Depth}
+	if f.Depth == 0 {
+		// the children of the root are always shown
+		loader.depth = 1
+	}
+	if f.Text || f.Python {
+		loader.decode = f.decoder()
+	}
+	switch {
+	case f.Clipboard:
+		loader.read = readClipboard
+		return loader
+	case f.File != "":
+		loader.read = readFile(f.File)
+		if f.Index && loader.decode == nil {
+			loader.index = f.File
+		}
+	default:
+		loader.read = readStdin
+	}
+	// unlike the clipboard, files and stdin are not necessarily UTF-8
+	loader.transcode = func(b []byte) ([]byte, error) {
+		return toUTF8(b, f.Encoding)
+	}
+	return loader
 }
 
 func initFlag() *flagArgs {
 	result := &flagArgs{}
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, `Usage: %s [-r file]
+		fmt.Fprintf(os.Stderr, `Usage: %s [-r file [-index]] [-clipboard] [-text | -python] [-encoding charset] [-depth n]
 Examples:
 - %[1]s -r example.json
 - %[1]s < example.json
 - cat example.json | %[1]s
+- kubectl logs pod | %[1]s -text
+- %[1]s -clipboard
+- %[1]s -encoding gbk -r example.json
+- %[1]s -index -r snapshot.json
+- %[1]s -depth 2 -r large.json
+- python -c 'print({"a": True})' | %[1]s -python
 Help: 
 - https://github.com/anthony-dong/jsonui
 `, filepath.Base(os.Args[0]))
 	}
 	flag.StringVar(&result.File, "r", "", "File to read from")
+	flag.BoolVar(&result.Text, "text", false, "Extract the JSON values embedded in plain text, e.g. logs")
+	flag.BoolVar(&result.Clipboard, "clipboard", false, "Read from the system clipboard")
+	flag.BoolVar(&result.Python, "python", false, "Read Python literals (repr of dict/list/tuple), e.g. {'a': True, 'b': None}")
+	flag.BoolVar(&result.Index, "index", false, "Keep an index of the file given with -r in the user cache directory, to reopen it without parsing it again")
+	flag.IntVar(&result.Depth, "depth", -1, "Levels of the tree expanded at startup, e.g. 2 (default: all of them, except the children of the objects and arrays over 1MB)")
+	flag.StringVar(&result.Encoding, "encoding", "", "Input encoding, e.g. utf-16, gbk, gb18030 (default: detected from BOM, otherwise utf-8)")
 	flag.Parse()
+	if err := result.validate(); err != nil {
+		// like the flag package does with an invalid flag
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
 	return result
 }
 
@@ -93,6 +164,24 @@ func initHelpMsg() *helpMsg {
 	msg.addFlag("ctrl+b", "PageUp")
 	msg.addFlag("c", "Copy node value")
 	msg.addFlag("f", "Format node data")
+	msg.addFlag("v", "Reload document from clipboard")
+	msg.addFlag("/", "Search keys and values (Enter to keep, Esc to cancel)")
+	msg.addFlag("n/N", "Next/previous match")
+	msg.addFlag("F", "Filter the tree (Esc to show it whole again)")
+	msg.addFlag("g", "Go to a path like /a/0, a.b[0] or [\"a\"][0] (Tab complete the keys)")
+	msg.addFlag("e", "Expand/collapse all (the children of objects and arrays over 1MB start collapsed)")
+	msg.addFlag("1-9", "Expand the selected node (the whole tree from the root) to that depth")
+	msg.addFlag("p", "Go to the parent node")
+	msg.addFlag("J/K", "Go to the next/previous sibling, over its expanded children")
+	msg.addFlag("[/]", "Go to the first/last child")
+	msg.addFlag(">/<", "Go to the next/previous node at the same depth")
+	msg.addFlag("ctrl+o/ctrl+p", "Go back/forward in the history of jumps")
+	msg.addFlag("m<letter>", "Mark the node, '<letter> to jump back to it")
+	msg.addFlag("M", "List the marks (Enter jump, d delete)")
+	msg.addFlag("$", "Query with JSONPath, e.g. $..book[?(@.price < 10)] (Enter jump, c copy all, Esc cancel a query in progress)")
+	msg.addFlag("|", "Transform the node with jq, e.g. .items | map(.name) (Enter keep, ctrl+r replace the tree, Esc cancel the replacement)")
+	msg.addFlag("ctrl+t", "Switch the match mode: substring, ignore case, regexp, fuzzy")
+	msg.addFlag("ctrl+k", "Switch what is matched: keys and values, keys, values")
 	msg.addFlag("q/ctrl+c", "Exit")
 	msg.addFlag("h/?", "Toggle help message")
 	return msg
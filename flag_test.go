@@ -8,3 +8,14 @@ import (
 func TestNewHelpMsg(t *testing.T) {
 	fmt.Println(initHelpMsg().String())
 }
+
+func TestFlagArgsValidate(t *testing.T) {
+	if err := (&flagArgs{Text: true, Python: true}).validate(); err == nil {
+		t.Fatalf("-text and -python should be rejected together")
+	}
+	for _, f := range []*flagArgs{{}, {Text: true}, {Python: true}, {Python: true, Clipboard: true}} {
+		if err := f.validate(); err != nil {
+			t.Fatalf("unexpected error for %+v: %v", *f, err)
+		}
+	}
+}
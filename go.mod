@@ -6,5 +6,5 @@ require (
 	github.com/atotto/clipboard v0.1.4
 	github.com/jroimartin/gocui v0.5.0
 	github.com/mattn/go-runewidth v0.0.16
-	golang.org/x/sync v0.10.0
+	golang.org/x/text v0.21.0
 )
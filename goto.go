@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+// maxCompletions is the number of keys the goto prompt cycles through.
+const maxCompletions = 1000
+
+// gotoText is the latest path typed in the goto prompt, it is only accessed
+// by the UI goroutine.
+var gotoText = ""
+
+// gotoStyle is how a key of a path is written.
+type gotoStyle int
+
+const (
+	pointerStyle gotoStyle = iota // /key of a JSON Pointer
+	dotStyle                      // .key, or key at the start of the path
+	bracketStyle                  // ["key"] or [0]
+)
+
+// gotoKey is a key of a path typed in the goto prompt.
+type gotoKey struct {
+	key   string
+	style gotoStyle
+	start int  // offset of the key in the path, including its . or [
+	open  bool // a [ without its ], only the last key may be open
+}
+
+// scanGotoPath splits a path into its keys. A path is either a JSON Pointer
+// like /a/b/0, or a sequence of keys like a.b[0], $.a["b"][0] and the
+// ["a"]["b"][0] of the path bar.
+func scanGotoPath(text string) ([]gotoKey, error) {
+	keys := make([]gotoKey, 0)
+	if strings.HasPrefix(text, "/") {
+		start := 0
+		for _, part := range strings.Split(text[1:], "/") {
+			key := strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			keys = append(keys, gotoKey{key: key, style: pointerStyle, start: start})
+			start += len(part) + 1
+		}
+		return keys, nil
+	}
+	i := 0
+	if strings.HasPrefix(text, "$") {
+		i++
+	}
+	for i < len(text) {
+		switch c := text[i]; {
+		case c == '[':
+			key, end, err := scanBracket(text, i)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			i = end
+		case c == '.' || i == 0:
+			start := i
+			if c == '.' {
+				i++
+			}
+			end := i + strings.IndexAny(text[i:], ".[")
+			if end < i {
+				end = len(text)
+			}
+			keys = append(keys, gotoKey{key: text[i:end], style: dotStyle, start: start})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+	return keys, nil
+}
+
+// scanBracket scans the ["key"], ['key'] or [0] at offset start of text, and
+// returns the offset after it. The key is open if text ends before the ].
+func scanBracket(text string, start int) (gotoKey, int, error) {
+	key := gotoKey{style: bracketStyle, start: start}
+	i := start + 1
+	if i < len(text) && (text[i] == '"' || text[i] == '\'') {
+		quote := text[i]
+		end := i + 1
+		for end < len(text) && text[end] != quote {
+			if text[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(text) {
+			// the key typed so far
+			key.key, key.open = unescapeKey(text[i+1:], quote), true
+			return key, len(text), nil
+		}
+		if quote == '"' {
+			unquoted, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return key, 0, fmt.Errorf("invalid key %s at offset %d", text[i:end+1], i)
+			}
+			key.key = unquoted
+		} else {
+			key.key = unescapeKey(text[i+1:end], quote)
+		}
+		i = end + 1
+	} else {
+		end := i
+		for end < len(text) && (text[end] == '-' || text[end] >= '0' && text[end] <= '9') {
+			end++
+		}
+		key.key, i = text[i:end], end
+	}
+	if i >= len(text) {
+		key.open = true
+		return key, i, nil
+	}
+	if text[i] != ']' {
+		return key, 0, fmt.Errorf("expected ] at offset %d", i)
+	}
+	return key, i + 1, nil
+}
+
+// unescapeKey removes the backslashes of a key quoted by quote.
+func unescapeKey(s string, quote byte) string {
+	if quote == '"' {
+		if unquoted, err := strconv.Unquote(`"` + s + `"`); err == nil {
+			return unquoted
+		}
+	}
+	return strings.NewReplacer(`\\`, `\`, `\`+string(quote), string(quote)).Replace(s)
+}
+
+// resolveGotoPath returns the position of the node at a path of root.
+func resolveGotoPath(root treeNode, text string) (treePosition, error) {
+	keys, err := scanGotoPath(strings.TrimSpace(text))
+	if err != nil {
+		return nil, err
+	}
+	position := make(treePosition, 0, len(keys))
+	node := root
+	for _, k := range keys {
+		if k.open {
+			return nil, fmt.Errorf("expected ] at offset %d", len(text))
+		}
+		key, err := childKey(node, k.key)
+		if err != nil {
+			return nil, fmt.Errorf("%s at $%s", err.Error(), formatPath(root, position))
+		}
+		position = append(position, key)
+		node = node.find(treePosition{key})
+	}
+	return position, nil
+}
+
+// childKey returns the key in the tree of the child of node written key in a
+// path, an index of an array may be negative to count from its end.
+func childKey(node treeNode, key string) (string, error) {
+	switch n := node.(type) {
+	case *complexNode:
+		if _, isOk := n.get(key); isOk {
+			return key, nil
+		}
+		return "", fmt.Errorf("no key %q", key)
+	case *listNode:
+		n.load()
+		i, err := parseListIndex(key)
+		if err != nil {
+			return "", fmt.Errorf("invalid index %q", key)
+		}
+		if i < 0 {
+			i += len(n.data)
+		}
+		if i < 0 || i >= len(n.data) {
+			return "", fmt.Errorf("no index %s, the array has %s", key, plural(len(n.data), "item"))
+		}
+		return fmt.Sprintf("[%d]", i), nil
+	}
+	return "", fmt.Errorf("%s is not an object or an array", previewNode(node))
+}
+
+// completeGotoPath returns the paths completing the last key of text with
+// the keys of the node it is in, written in the style of the path.
+func completeGotoPath(root treeNode, text string) []string {
+	keys, err := scanGotoPath(text)
+	if err != nil {
+		return nil
+	}
+	// the key being typed, a closed ["key"] is followed by an empty one
+	last := gotoKey{style: dotStyle, start: len(text)}
+	if len(keys) > 0 && (keys[len(keys)-1].style != bracketStyle || keys[len(keys)-1].open) {
+		last, keys = keys[len(keys)-1], keys[:len(keys)-1]
+	} else if len(keys) > 0 || strings.HasPrefix(text, "[") {
+		last.style = bracketStyle
+	}
+	node := root
+	for _, k := range keys {
+		key, err := childKey(node, k.key)
+		if err != nil {
+			return nil
+		}
+		node = node.find(treePosition{key})
+	}
+	completions := make([]string, 0)
+	prefix := text[:last.start]
+	foreachChild(node, 0, func(key, _ string, _ treeNode, _, _ bool) {
+		if len(completions) == maxCompletions {
+			return
+		}
+		_, isElement := node.(*listNode)
+		written := key
+		if isElement {
+			written = strings.Trim(key, "[]")
+		}
+		if !strings.HasPrefix(written, last.key) {
+			return
+		}
+		completions = append(completions, prefix+writeGotoKey(written, isElement, last.style, last.start == 0))
+	})
+	return completions
+}
+
+// gotoSeparator returns what is typed after a path to type the keys of its
+// node.
+func gotoSeparator(text string) string {
+	switch {
+	case strings.HasPrefix(text, "/"):
+		return "/"
+	case strings.HasSuffix(text, "]"):
+		return ""
+	}
+	return "."
+}
+
+// writeGotoKey writes a key of a path in a style, first is set for the first
+// key of a path which isn't written with its dot.
+func writeGotoKey(key string, element bool, style gotoStyle, first bool) string {
+	switch {
+	case style == pointerStyle:
+		return "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+	case element:
+		return "[" + key + "]"
+	case style == bracketStyle || key == "" || strings.ContainsAny(key, ".[]\"' "):
+		return fmt.Sprintf("[%q]", key)
+	case first:
+		return key
+	}
+	return "." + key
+}
+
+// openGoto opens the goto prompt, Tab completes the key being typed and
+// Enter moves the cursor to the node.
+func openGoto(g *gocui.Gui, v *gocui.View) error {
+	return openGotoPrompt(g, gotoText, "")
+}
+
+// gotoCompleter cycles through the completions of the goto prompt, every Tab
+// replaces the input with the next one.
+type gotoCompleter struct {
+	completions []string
+	current     int // index of the completion in the input, -1 if none is
+}
+
+// complete returns the input following input and the status of the
+// completion.
+func (c *gotoCompleter) complete(root treeNode, input string) (string, string) {
+	switch {
+	case len(c.completions) == 1 && c.completions[0] == input:
+		// the key is complete, complete the keys of its node
+		c.completions, c.current = completeGotoPath(root, input+gotoSeparator(input)), -1
+	case c.current < 0 || c.completions[c.current] != input:
+		c.completions, c.current = completeGotoPath(root, input), -1
+	}
+	if len(c.completions) == 0 {
+		return input, "no completion"
+	}
+	c.current = (c.current + 1) % len(c.completions)
+	if len(c.completions) == 1 {
+		return c.completions[0], ""
+	}
+	return c.completions[c.current], fmt.Sprintf("%d/%d", c.current+1, len(c.completions))
+}
+
+func openGotoPrompt(g *gocui.Gui, input, status string) error {
+	completer := &gotoCompleter{current: -1}
+	return openPrompt(g, &prompt{
+		title: func() string {
+			if status != "" {
+				return " goto (" + status + ") "
+			}
+			return " goto: /a/0, a.b[0] or [\"a\"][0] (Tab complete) "
+		},
+		input: input,
+		change: func(g *gocui.Gui, input string) error {
+			status = ""
+			return nil
+		},
+		complete: func(g *gocui.Gui, input string) string {
+			completed, completion := completer.complete(tree, input)
+			status = completion
+			return completed
+		},
+		done: gotoPath,
+	})
+}
+
+// gotoPath moves the tree cursor to the node at a path and expands its
+// ancestors, the prompt is opened again if there is no such node.
+func gotoPath(g *gocui.Gui, input string) error {
+	gotoText = input
+	if tree == nil {
+		return nil
+	}
+	position, err := resolveGotoPath(tree, input)
+	if err != nil {
+		return openGotoPrompt(g, input, err.Error())
+	}
+	return jumpToPosition(g, position)
+}
+
+// jumpToPosition moves the tree cursor to the node at position and records
+// the jump in the history.
+func jumpToPosition(g *gocui.Gui, position treePosition) error {
+	recordJump(findTreePosition(g), position)
+	return revealPosition(g, position)
+}
+
+// revealPosition moves the tree cursor to the node at position like
+// showPosition, the tree is shown whole again if the node was filtered out.
+func revealPosition(g *gocui.Gui, position treePosition) error {
+	if filterMatches != nil && treeLines.reveal(position) < 0 {
+		if err := clearFilter(g); err != nil {
+			return err
+		}
+	}
+	return showPosition(g, position)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveGotoPath(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"b": [1, 2, {"c": 3}]}, "x.y": {"a/b": 1, "m~n": 2}, "": 4}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, c := range []struct {
+		path     string
+		expected treePosition
+	}{
+		{"", treePosition{}},
+		{"$", treePosition{}},
+		{"/a/b/2/c", treePosition{"a", "b", "[2]", "c"}},
+		{"/x.y/a~1b", treePosition{"x.y", "a/b"}},
+		{"/x.y/m~0n", treePosition{"x.y", "m~n"}},
+		{"/", treePosition{""}},
+		{"a.b[2].c", treePosition{"a", "b", "[2]", "c"}},
+		{"$.a.b[-1]", treePosition{"a", "b", "[2]"}},
+		{".a.b.0", treePosition{"a", "b", "[0]"}},
+		{`["x.y"]['a/b']`, treePosition{"x.y", "a/b"}},
+		{`["a"]["b"][1]`, treePosition{"a", "b", "[1]"}},
+		{`a["b"][2]["c"]`, treePosition{"a", "b", "[2]", "c"}},
+	} {
+		position, err := resolveGotoPath(root, c.path)
+		if err != nil {
+			t.Fatalf("failed to resolve %q: %v", c.path, err)
+		}
+		if !reflect.DeepEqual(position, c.expected) {
+			t.Fatalf("unexpected position of %q: %q", c.path, position)
+		}
+	}
+	for _, c := range []struct {
+		path, expected string
+	}{
+		{"/a/z", `no key "z" at $["a"]`},
+		{"a.b[3]", `no index 3, the array has 3 items at $["a"]["b"]`},
+		{"a.b[x]", `expected ] at offset 4`},
+		{`a.b[0].c`, `1 is not an object or an array at $["a"]["b"][0]`},
+		{`["a"`, `expected ] at offset 4`},
+		{`a.b[0]x`, `unexpected 'x' at offset 6`},
+	} {
+		if _, err := resolveGotoPath(root, c.path); err == nil || err.Error() != c.expected {
+			t.Fatalf("unexpected error resolving %q: %v", c.path, err)
+		}
+	}
+}
+
+func TestCompleteGotoPath(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"b": [1, 2], "bc": 1, "d e": 2}, "ab": 1}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, c := range []struct {
+		path     string
+		expected []string
+	}{
+		{"", []string{"a", "ab"}},
+		{"a", []string{"a", "ab"}},
+		{"$.a", []string{"$.a", "$.ab"}},
+		{"a.b", []string{"a.b", "a.bc"}},
+		{"a.", []string{"a.b", "a.bc", `a["d e"]`}},
+		{"a.b.", []string{"a.b[0]", "a.b[1]"}},
+		{"a.b[", []string{"a.b[0]", "a.b[1]"}},
+		{"/a/", []string{"/a/b", "/a/bc", "/a/d e"}},
+		{"/a/b/1", []string{"/a/b/1"}},
+		{`["a"]`, []string{`["a"]["b"]`, `["a"]["bc"]`, `["a"]["d e"]`}},
+		{`["a"]["d`, []string{`["a"]["d e"]`}},
+		{"a.z", []string{}},
+		{"z.", nil},
+	} {
+		if completions := completeGotoPath(root, c.path); !reflect.DeepEqual(completions, c.expected) {
+			t.Fatalf("unexpected completions of %q: %q", c.path, completions)
+		}
+	}
+}
+
+func TestGotoCompleter(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"x": 1}, "ab": 2, "c": 3}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	c := &gotoCompleter{current: -1}
+	input := "a"
+	for _, expected := range []struct {
+		input, status string
+	}{
+		{"a", "1/2"},
+		{"ab", "2/2"},
+		{"a", "1/2"},
+		{"ab", "2/2"},
+		{"a", "1/2"},
+	} {
+		var status string
+		input, status = c.complete(root, input)
+		if input != expected.input || status != expected.status {
+			t.Fatalf("unexpected completion %q (%s), expected %q (%s)", input, status, expected.input, expected.status)
+		}
+	}
+	c = &gotoCompleter{current: -1}
+	input = "c"
+	for _, expected := range []string{"c", "c", "c"} {
+		if input, _ = c.complete(root, input); input != expected {
+			t.Fatalf("unexpected completion %q", input)
+		}
+	}
+	if completed, status := c.complete(root, "z"); completed != "z" || status != "no completion" {
+		t.Fatalf("unexpected completion %q (%s)", completed, status)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+)
+
+// maxHistory is the number of positions kept by the history.
+const maxHistory = 100
+
+// visited is the history of the positions jumped from and to in the tree,
+// ctrl+o goes back and ctrl+p forward. It is only accessed by the UI
+// goroutine.
+var visited = &history{}
+
+// history is a stack of positions, they are paths rather than rows so they
+// survive expanding, collapsing and reloading the tree.
+type history struct {
+	positions []treePosition
+	index     int // the current position
+}
+
+// visit makes position the newest one, the positions gone back from are
+// forgotten.
+func (h *history) visit(position treePosition) {
+	if len(h.positions) > 0 {
+		if samePosition(h.positions[h.index], position) {
+			return
+		}
+		h.positions = h.positions[:h.index+1]
+	}
+	h.positions = append(h.positions, position)
+	if len(h.positions) > maxHistory {
+		h.positions = h.positions[len(h.positions)-maxHistory:]
+	}
+	h.index = len(h.positions) - 1
+}
+
+// move goes back (d < 0) or forward (d > 0) from current to the nearest
+// position which exists, current is visited first if it was moved to since.
+func (h *history) move(current treePosition, d int, exists func(position treePosition) bool) (treePosition, bool) {
+	if len(h.positions) > 0 && !samePosition(h.positions[h.index], current) {
+		if d > 0 {
+			// moving forward from a position which isn't in the history
+			return nil, false
+		}
+		h.visit(current)
+	}
+	for i := h.index + d; i >= 0 && i < len(h.positions); i += d {
+		if exists(h.positions[i]) {
+			h.index = i
+			return h.positions[i], true
+		}
+	}
+	return nil, false
+}
+
+// status is the position in the history for the path bar.
+func (h *history) status() string {
+	if len(h.positions) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("history %d/%d", h.index+1, len(h.positions))
+}
+
+// recordJump records a jump of the tree cursor from a position to another in
+// the history.
+func recordJump(from, to treePosition) {
+	if tree == nil {
+		return
+	}
+	visited.visit(from)
+	visited.visit(to)
+}
+
+// nodeExists tells whether the document has a node at position.
+func nodeExists(position treePosition) bool {
+	return tree.find(position) != nil
+}
+
+// historyMovement moves the tree cursor d positions back or forward in the
+// history, skipping the positions which no longer exist.
+func historyMovement(d int) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if tree == nil {
+			return nil
+		}
+		position, isOk := visited.move(findTreePosition(g), d, nodeExists)
+		if !isOk {
+			return drawPath(g)
+		}
+		return revealPosition(g, position)
+	}
+}
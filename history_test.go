@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := &history{}
+	missing := treePosition{"c"}
+	exists := func(position treePosition) bool {
+		return !samePosition(position, missing)
+	}
+	for _, position := range []treePosition{{}, {"a"}, {"a"}, {"c"}, {"b"}} {
+		h.visit(position)
+	}
+	if status := h.status(); status != "history 4/4" {
+		t.Fatalf("unexpected status: %s", status)
+	}
+	move := func(current treePosition, d int, expected treePosition) {
+		t.Helper()
+		position, isOk := h.move(current, d, exists)
+		if expected == nil {
+			if isOk {
+				t.Fatalf("unexpected move to %q", position)
+			}
+			return
+		}
+		if !isOk || !reflect.DeepEqual(position, expected) {
+			t.Fatalf("unexpected move from %q by %d: %q", current, d, position)
+		}
+	}
+	// the missing position is skipped
+	move(treePosition{"b"}, -1, treePosition{"a"})
+	move(treePosition{"a"}, -1, treePosition{})
+	move(treePosition{}, -1, nil)
+	move(treePosition{}, 1, treePosition{"a"})
+	move(treePosition{"a"}, 1, treePosition{"b"})
+	move(treePosition{"b"}, 1, nil)
+	// going back from a position moved to since visits it first
+	move(treePosition{"b"}, -1, treePosition{"a"})
+	move(treePosition{"d"}, 1, nil)
+	move(treePosition{"d"}, -1, treePosition{"a"})
+	if status := h.status(); status != "history 2/3" {
+		t.Fatalf("unexpected status: %s", status)
+	}
+	move(treePosition{"a"}, 1, treePosition{"d"})
+}
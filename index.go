@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// indexMagic starts every index file, it changes with the format.
+const indexMagic = "jsonui-index-1\n"
+
+// treeIndex is the index of the document being browsed, if it has been
+// opened from one. It is only accessed by the UI goroutine.
+var treeIndex *fileIndex
+
+// fileIndex records where the children of every object and array larger than
+// lazyExpandSize are in a file, along with its duplicate keys. Such containers
+// are exactly the ones whose children are built lazily, so with the index the
+// file can be browsed without being parsed again.
+type fileIndex struct {
+	path    string // absolute path of the file
+	size    int64
+	modTime int64 // in nanoseconds
+	length  int   // length of the document once trimmed
+
+	containers []indexContainer
+	duplicates []treePosition
+	keys       []string // keys of the children read from an index file
+
+	// byStart maps the first byte of each container in the document to it
+	byStart map[*byte]*indexContainer
+}
+
+// indexContainer is an object or array of the document and its children, the
+// keys are empty for array elements. The children of a container read from an
+// index file are only decoded from table when they are needed.
+type indexContainer struct {
+	start, end int
+	children   []indexChild
+	count      int
+	table      []byte
+}
+
+type indexChild struct {
+	key        string
+	start, end int
+}
+
+// indexBuilder collects the children of the large containers while they are
+// parsed, see jsonParser.foreachChild.
+type indexBuilder struct {
+	// children of the containers being parsed, innermost last
+	children   []indexChild
+	containers []indexContainer
+}
+
+// close ends the container at start, its children are the ones collected
+// since mark. They are kept only if the container is large.
+func (b *indexBuilder) close(start, end, mark int) {
+	if end-start > lazyExpandSize {
+		children := make([]indexChild, len(b.children)-mark)
+		copy(children, b.children[mark:])
+		b.containers = append(b.containers, indexContainer{start: start, end: end, children: children})
+	}
+	b.children = b.children[:mark]
+}
+
+// indexPath returns where the index of a file is kept, in the user cache
+// directory.
+func indexPath(path string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(path))
+	return filepath.Join(dir, "jsonui", "index", hex.EncodeToString(sum[:])+".idx"), nil
+}
+
+// newFileIndex returns an empty index of the file as it is now.
+func newFileIndex(filename string) (*fileIndex, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileIndex{path: path, size: info.Size(), modTime: info.ModTime().UnixNano()}, nil
+}
+
+// readFileIndex reads the index of a file given its current state, see
+// newFileIndex. It fails if there is none or if the file has changed since it
+// was written.
+func readFileIndex(current *fileIndex) (*fileIndex, error) {
+	indexFile, err := indexPath(current.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	index, err := decodeFileIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	if index.path != current.path || index.size != current.size || index.modTime != current.modTime {
+		return nil, errors.New("the file has changed since it was indexed")
+	}
+	return index, nil
+}
+
+// write writes the index to the user cache directory, replacing the index
+// of the same file if any.
+func (x *fileIndex) write() error {
+	indexFile, err := indexPath(x.path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(indexFile), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(indexFile), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	x.encode(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), indexFile)
+}
+
+// encode writes the index as a sequence of uvarints and strings, the keys are
+// written once in a table and referred to by their position in it. The
+// children of each container are preceded by their size, so that they can be
+// skipped until they are needed.
+func (x *fileIndex) encode(w *bufio.Writer) {
+	var buf []byte
+	putInt := func(v int) {
+		buf = appendUvarint(buf[:0], v)
+		w.Write(buf)
+	}
+	putString := func(s string) {
+		putInt(len(s))
+		w.WriteString(s)
+	}
+	w.WriteString(indexMagic)
+	putString(x.path)
+	putInt(int(x.size))
+	putInt(int(x.modTime))
+	putInt(x.length)
+
+	keys := make(map[string]int)
+	table := make([]string, 0)
+	for _, container := range x.containers {
+		for _, child := range container.children {
+			if _, isOk := keys[child.key]; !isOk && child.key != "" {
+				keys[child.key] = len(table) + 1
+				table = append(table, child.key)
+			}
+		}
+	}
+	putInt(len(table))
+	for _, key := range table {
+		putString(key)
+	}
+	putInt(len(x.containers))
+	var children []byte
+	for _, container := range x.containers {
+		children = children[:0]
+		for _, child := range container.children {
+			children = appendUvarint(children, keys[child.key])
+			children = appendUvarint(children, child.start-container.start)
+			children = appendUvarint(children, child.end-child.start)
+		}
+		putInt(container.start)
+		putInt(container.end - container.start)
+		putInt(len(container.children))
+		putInt(len(children))
+		w.Write(children)
+	}
+	putInt(len(x.duplicates))
+	for _, position := range x.duplicates {
+		putInt(len(position))
+		for _, key := range position {
+			putString(key)
+		}
+	}
+}
+
+func appendUvarint(b []byte, v int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], uint64(v))]...)
+}
+
+var errInvalidIndex = errors.New("invalid index")
+
+const maxInt = int(^uint(0) >> 1)
+
+// indexReader reads the uvarints and strings of an index, once it fails
+// every read returns a zero value and err is set.
+type indexReader struct {
+	data []byte
+	err  error
+}
+
+func (r *indexReader) int() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 || v > uint64(maxInt) {
+		r.err = errInvalidIndex
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
+
+func (r *indexReader) bytes() []byte {
+	n := r.int()
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errInvalidIndex
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *indexReader) string() string {
+	return string(r.bytes())
+}
+
+func decodeFileIndex(data []byte) (*fileIndex, error) {
+	if !bytes.HasPrefix(data, []byte(indexMagic)) {
+		return nil, errors.New("unknown index format")
+	}
+	r := &indexReader{data: data[len(indexMagic):]}
+	x := &fileIndex{}
+	x.path = r.string()
+	x.size = int64(r.int())
+	x.modTime = int64(r.int())
+	x.length = r.int()
+
+	// the key 0 is for array elements
+	x.keys = []string{""}
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		x.keys = append(x.keys, r.string())
+	}
+	x.containers = make([]indexContainer, 0)
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		container := indexContainer{start: r.int()}
+		container.end = container.start + r.int()
+		container.count = r.int()
+		container.table = r.bytes()
+		x.containers = append(x.containers, container)
+	}
+	x.duplicates = make([]treePosition, 0)
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		position := make(treePosition, 0)
+		for n := r.int(); n > 0 && r.err == nil; n-- {
+			position = append(position, r.string())
+		}
+		x.duplicates = append(x.duplicates, position)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return x, nil
+}
+
+// open checks the index against the document and prepares it for lookups.
+func (x *fileIndex) open(data []byte) error {
+	if len(data) != x.length {
+		return errors.New("the index doesn't match the document")
+	}
+	x.byStart = make(map[*byte]*indexContainer, len(x.containers))
+	for i := range x.containers {
+		container := &x.containers[i]
+		if container.start < 0 || container.end > len(data) || container.start >= container.end {
+			return errInvalidIndex
+		}
+		x.byStart[&data[container.start]] = container
+	}
+	if _, isOk := x.byStart[&data[0]]; !isOk {
+		return errors.New("the document is not indexed")
+	}
+	return nil
+}
+
+// foreachChild calls fn with each child of container. The children read from
+// an index file are checked before fn is called, it returns false if they are
+// invalid.
+func (x *fileIndex) foreachChild(container *indexContainer, fn func(child indexChild)) bool {
+	if container.table == nil {
+		for _, child := range container.children {
+			fn(child)
+		}
+		return true
+	}
+	decode := func(fn func(child indexChild)) bool {
+		r := &indexReader{data: container.table}
+		for n := container.count; n > 0; n-- {
+			key := r.int()
+			child := indexChild{start: container.start + r.int()}
+			child.end = child.start + r.int()
+			if r.err != nil || key >= len(x.keys) || child.start < container.start || child.start >= child.end ||
+				child.end > container.end {
+				return false
+			}
+			child.key = x.keys[key]
+			fn(child)
+		}
+		return true
+	}
+	if !decode(func(indexChild) {}) {
+		return false
+	}
+	return decode(fn)
+}
+
+// children builds the children of the container raw from the index and calls
+// add with each of them, it returns false if raw is not indexed or if the
+// index doesn't match it.
+func (x *fileIndex) children(raw []byte, add func(key string, child treeNode)) bool {
+	if x == nil || len(raw) == 0 {
+		return false
+	}
+	container, isOk := x.byStart[&raw[0]]
+	if !isOk || container.end-container.start != len(raw) {
+		return false
+	}
+	// the children are only added once they have all been built, raw is
+	// parsed instead if one of them doesn't match the index
+	keys, nodes := make([]string, 0, container.count), make([]treeNode, 0, container.count)
+	var err error
+	valid := x.foreachChild(container, func(child indexChild) {
+		if err != nil {
+			return
+		}
+		var node treeNode
+		if node, err = indexedNode(raw[child.start-container.start : child.end-container.start]); err != nil {
+			return
+		}
+		if node.isCollapsable() {
+			// like the children of any container larger than lazyExpandSize
+			node.toggleExpanded()
+		}
+		keys, nodes = append(keys, child.key), append(nodes, node)
+	})
+	if !valid || err != nil {
+		return false
+	}
+	for i, node := range nodes {
+		add(keys[i], node)
+	}
+	return true
+}
+
+// indexedNode returns the node of a value found with the index, objects and
+// arrays are left to be built when they are loaded. errInvalidIndex is
+// returned if raw is not a value, the index doesn't match the document then.
+func indexedNode(raw []byte) (treeNode, error) {
+	atomic.AddInt64(&builtNodes, 1)
+	switch raw[0] {
+	case '{':
+		return &complexNode{baseTreeNode: baseTreeNode{true}, raw: json.RawMessage(raw)}, nil
+	case '[':
+		return &listNode{baseTreeNode: baseTreeNode{true}, raw: json.RawMessage(raw)}, nil
+	}
+	node, err := parseTree(raw)
+	if err != nil {
+		return nil, errInvalidIndex
+	}
+	return node, nil
+}
+
+// loadChildren builds the children of the container raw, from index if the
+// document is indexed, and calls add with each of them.
+func loadChildren(index *fileIndex, raw json.RawMessage, add func(key string, child treeNode)) {
+	if index.children(raw, add) {
+		return
+	}
+	// raw has been validated by the parser
+	_ = newJsonParser(raw).parseChildren(buildLevels(len(raw))-1, add)
+}
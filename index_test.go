@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// indexedDocument returns a document larger than lazyExpandSize, with a large
+// nested object and duplicate keys.
+func indexedDocument() []byte {
+	var doc strings.Builder
+	doc.WriteString(`{"list": [`)
+	for i := 0; i < 20000; i++ {
+		if i > 0 {
+			doc.WriteString(", ")
+		}
+		fmt.Fprintf(&doc, `{"id": %d, "name": "item %d", "tags": ["a", "b"]}`, i, i)
+	}
+	doc.WriteString(`], "nested": {"padding": "` + strings.Repeat("x", lazyExpandSize) + `", "k": 1, "k": 2}, "list": 1}`)
+	return []byte(doc.String())
+}
+
+func buildIndex(t *testing.T, data []byte) *fileIndex {
+	builder := &indexBuilder{}
+	positions := make([]treePosition, 0)
+	p := newJsonParser(data)
+	p.duplicates = &positions
+	p.index = builder
+	if err := p.skipValue(); err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	return &fileIndex{path: "doc.json", size: 1, modTime: 2, length: len(data), containers: builder.containers, duplicates: positions}
+}
+
+func TestFileIndex(t *testing.T) {
+	data := indexedDocument()
+	index := buildIndex(t, data)
+	if len(index.containers) != 3 {
+		t.Fatalf("expected the root, list and nested to be indexed, got %d containers", len(index.containers))
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	index.encode(w)
+	w.Flush()
+	decoded, err := decodeFileIndex(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to decode the index: %v", err)
+	}
+	if err := decoded.open(data); err != nil {
+		t.Fatalf("failed to open the index: %v", err)
+	}
+	if fmt.Sprint(decoded.duplicates) != "[[nested k#2] [list#2]]" {
+		t.Fatalf("unexpected duplicate keys %v", decoded.duplicates)
+	}
+
+	treeIndex = decoded
+	defer func() {
+		treeIndex = nil
+	}()
+	root, err := indexedNode(data)
+	if err != nil {
+		t.Fatalf("failed to build the root from the index: %v", err)
+	}
+	expected, err := fromBytes(data)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	if result := drawRows(newTreeRows(root)); result != drawRows(newTreeRows(expected)) {
+		t.Fatalf("unexpected tree from the index:\n%s", result)
+	}
+	list := root.find([]string{"list"}).(*listNode)
+	list.load()
+	if len(list.data) != 20000 || list.data[0].isExpanded() {
+		t.Fatalf("the children of the list should be built collapsed from the index")
+	}
+	if v := root.find([]string{"list", "[19999]", "name"}); v == nil || v.String(0) != `"item 19999"` {
+		t.Fatalf("unexpected node %v", v)
+	}
+	if v := root.find([]string{"nested", "k#2"}); v == nil || v.String(0) != "2" {
+		t.Fatalf("unexpected node %v", v)
+	}
+
+	// the index of a document changed since doesn't match its values
+	stale := bytes.Replace(data, []byte(`"list": 1}`), []byte(`"list": x}`), 1)
+	staleIndex := buildIndex(t, data)
+	if err := staleIndex.open(stale); err != nil {
+		t.Fatalf("failed to open the index: %v", err)
+	}
+	if staleIndex.children(stale, func(string, treeNode) {}) {
+		t.Fatalf("the children of a stale index shouldn't be used")
+	}
+
+	for i := range decoded.containers {
+		container := &decoded.containers[i]
+		container.table = container.table[:len(container.table)-1]
+		if decoded.children(data[container.start:container.end], func(string, treeNode) {}) {
+			t.Fatalf("the children of a corrupted index shouldn't be used")
+		}
+	}
+	if err := decoded.open(data[:len(data)-1]); err == nil {
+		t.Fatalf("an index shouldn't open another document")
+	}
+	for _, size := range []int{0, len(indexMagic), buf.Len() / 2, buf.Len() - 1} {
+		if _, err := decodeFileIndex(buf.Bytes()[:size]); err == nil {
+			t.Fatalf("expected an error for an index truncated to %d bytes", size)
+		}
+	}
+}
+
+func TestFileIndexReopen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "jsonui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"XDG_CACHE_HOME", "HOME", "LocalAppData"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, dir)
+	}
+
+	file := filepath.Join(dir, "doc.json")
+	data := indexedDocument()
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index, err := newFileIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFileIndex(index); err == nil {
+		t.Fatalf("the file hasn't been indexed yet")
+	}
+	built := buildIndex(t, data)
+	index.length, index.containers, index.duplicates = built.length, built.containers, built.duplicates
+	if err := index.write(); err != nil {
+		t.Fatalf("failed to write the index: %v", err)
+	}
+	current, err := newFileIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := readFileIndex(current)
+	if err != nil {
+		t.Fatalf("failed to read the index: %v", err)
+	}
+	if err := reopened.open(data); err != nil {
+		t.Fatalf("failed to open the index: %v", err)
+	}
+	if err := os.WriteFile(file, append(data, ' '), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if current, err = newFileIndex(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFileIndex(current); err == nil {
+		t.Fatalf("the index of a modified file shouldn't be used")
+	}
+}
@@ -0,0 +1,972 @@
+package jq
+
+import (
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anthony-dong/jsonui/internal/orderedmap"
+)
+
+// native is a builtin implemented in Go, its arguments are evaluated in the
+// env e of the caller.
+type native func(e *env, in item, args []expr, out func(item) error) error
+
+// natives are the builtins implemented in Go by name/arity, the others are
+// defined in jq by builtinSource.
+var natives map[string]native
+
+// builtinDefs are the functions defined by builtinSource by name/arity.
+var builtinDefs map[string]*closure
+
+const builtinSource = `
+def error: error(.);
+def values: select(. != null);
+def nulls: select(. == null);
+def booleans: select(type == "boolean");
+def numbers: select(type == "number");
+def strings: select(type == "string");
+def arrays: select(type == "array");
+def objects: select(type == "object");
+def iterables: select(type | . == "array" or . == "object");
+def scalars: select(type | . != "array" and . != "object");
+def finites: select(isinfinite or isnan | not);
+def normals: select(isnormal);
+def select(f): if f then . else empty end;
+def recurse(f): def r: ., (f | r); r;
+def recurse(f; cond): def r: ., (f | select(cond) | r); r;
+def recurse: recurse(.[]?);
+def map(f): [.[] | f];
+def map_values(f): .[] |= f;
+def to_entries: [keys_unsorted[] as $k | {key: $k, value: .[$k]}];
+def from_entries: reduce .[] as $x ({};
+	. + {($x | if .key == null then .k // .name // .Name // .K // .Key else .key end
+		| if type == "string" then . else tojson end):
+		($x | if has("value") then .value else .v end)});
+def with_entries(f): to_entries | map(f) | from_entries;
+def isempty(g): first((g | false), true);
+def any: reduce .[] as $x (false; . or $x);
+def all: reduce .[] as $x (true; . and $x);
+def any(f): reduce (.[] | f) as $x (false; . or $x);
+def all(f): reduce (.[] | f) as $x (true; . and $x);
+def any(g; cond): isempty(first(g | cond | select(.))) | not;
+def all(g; cond): isempty(first(g | cond | select(. | not)));
+def range($x): range(0; $x);
+def in(xs): . as $x | xs | has($x);
+def inside(xs): . as $x | xs | contains($x);
+def paths: path(..) | select(length > 0);
+def paths(node_filter): . as $dot | paths | select(. as $p | $dot | getpath($p) | node_filter);
+def leaf_paths: paths(scalars);
+def del(f): delpaths([path(f)]);
+def pick(pathexps): . as $top | reduce path(pathexps) as $p (null; setpath($p; $top | getpath($p)));
+def to_array: if type == "array" then . else [.] end;
+def toarray: to_array;
+def abs: if type == "number" and . < 0 then -. else . end;
+def first: .[0];
+def last: .[-1];
+def first(f): limit(1; f);
+def last(f): reduce f as $x (null; $x);
+def nth($n): .[$n];
+def nth($n; f): if $n < 0 then error("Out of bounds negative array index") else last(limit($n + 1; f)) end;
+def until(cond; update): def _until: if cond then . else (update | _until) end; _until;
+def while(cond; update): def _while: if cond then ., (update | _while) else empty end; _while;
+def repeat(f): def _repeat: ., (f | _repeat); _repeat;
+def flatten: flatten(1e9);
+def unique: unique_by(.);
+def join($x): reduce .[] as $i (null;
+	(if . == null then "" else . + $x end)
+	+ ($i | if . == null then "" elif type == "string" then . else tojson end)) // "";
+def index($i): indices($i) | .[0];
+def rindex($i): indices($i) | .[-1:][0];
+def capture(re): capture(re; null);
+def capture(re; flags): match(re; flags) | [.captures[] | select(.name != null) | {key: .name, value: .string}] | from_entries;
+def scan(re): scan(re; null);
+def scan(re; flags): match(re; "g" + (flags // "")) | if (.captures | length) > 0 then [.captures[].string] else .string end;
+def splits($re): splits($re; null);
+def splits($re; flags): split($re; flags) | .[];
+def gsub(re; str): sub(re; str; "g");
+def gsub(re; str; flags): sub(re; str; flags + "g");
+def combinations: if length == 0 then [] else .[0][] as $x | (.[1:] | combinations) as $w | [$x] + $w end;
+def combinations(n): . as $dot | [range(n)] | map($dot) | combinations;
+def walk(f): def w: if type == "object" then map_values(w) elif type == "array" then map(w) else . end | f; w;
+def transpose: if . == [] then [] else . as $in | (map(length) | max) as $max
+	| [range(0; $max) as $j | [range(0; $in | length) as $i | $in[$i][$j]]] end;
+def tostream: path(def r: (.[]? | r), .; r) as $p | getpath($p) | reduce path(.[]?) as $q ([$p, .]; [$p + $q]);
+def env: $ENV;
+def debug: .;
+def debug(msg): .;
+def stderr: .;
+def input_filename: null;
+def ascii: [.] | implode;
+`
+
+func init() {
+	natives = map[string]native{
+		"empty/0": func(*env, item, []expr, func(item) error) error {
+			return nil
+		},
+		"error/1": func(e *env, in item, args []expr, out func(item) error) error {
+			return eachValue(e, args[0], in, func(v interface{}) error {
+				return &Error{Value: v}
+			})
+		},
+		"not/0": function(func(v interface{}, _ []interface{}) (interface{}, error) {
+			return !truthy(v), nil
+		}),
+		"path/1":     pathNative,
+		"getpath/1":  getpathNative,
+		"limit/2":    limitNative,
+		"range/2":    rangeNative,
+		"range/3":    rangeNative,
+		"sort_by/1":  sortByNative,
+		"group_by/1": groupByNative,
+		"unique_by/1": byKeysNative(func(v []interface{}, keys []interface{}) (interface{}, error) {
+			result := make([]interface{}, 0)
+			for i := range v {
+				if i == 0 || compareValues(keys[i], keys[i-1]) != 0 {
+					result = append(result, v[i])
+				}
+			}
+			return result, nil
+		}),
+		"min_by/1": byKeysNative(func(v []interface{}, keys []interface{}) (interface{}, error) {
+			if len(v) == 0 {
+				return nil, nil
+			}
+			return v[0], nil
+		}),
+		"max_by/1": byKeysNative(func(v []interface{}, keys []interface{}) (interface{}, error) {
+			if len(v) == 0 {
+				return nil, nil
+			}
+			// the last of the greatest ones, like jq
+			return v[len(v)-1], nil
+		}),
+		"match/1": matchNative,
+		"match/2": matchNative,
+		"sub/2":   subNative,
+		"sub/3":   subNative,
+	}
+	for name, fn := range functions {
+		natives[name] = function(fn)
+	}
+	for name, fn := range mathFunctions {
+		fn := fn
+		natives[name+"/0"] = function(func(v interface{}, _ []interface{}) (interface{}, error) {
+			f, isOk := toNumber(v)
+			if !isOk {
+				return nil, newError("%s number required", describe(v))
+			}
+			return fn(f), nil
+		})
+	}
+	builtinDefs = make(map[string]*closure)
+	x, err := parse(builtinSource + ".")
+	if err != nil {
+		panic("invalid builtins: " + err.Error())
+	}
+	// every definition sees all the builtins, like the ones defined after it
+	for define, isOk := x.(defineExpr); isOk; define, isOk = define.rest.(defineExpr) {
+		def := define.def
+		builtinDefs[def.name+"/"+strconv.Itoa(len(def.params))] = &closure{def: def, env: &env{}}
+	}
+}
+
+// function returns a native computing a value from its input and the values
+// of its arguments, each combination of which is passed to fn.
+func function(fn func(v interface{}, args []interface{}) (interface{}, error)) native {
+	return func(e *env, in item, args []expr, out func(item) error) error {
+		return eachArgs(e, in, args, nil, func(values []interface{}) error {
+			v, err := fn(in.value, values)
+			if err != nil {
+				return err
+			}
+			return emit(in, v, out)
+		})
+	}
+}
+
+func eachArgs(e *env, in item, args []expr, values []interface{}, fn func(values []interface{}) error) error {
+	if len(args) == 0 {
+		return fn(values)
+	}
+	return eachValue(e, args[0], in, func(v interface{}) error {
+		return eachArgs(e, in, args[1:], append(values[:len(values):len(values)], v), fn)
+	})
+}
+
+var mathFunctions = map[string]func(float64) float64{
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"trunc": math.Trunc,
+	"sqrt":  math.Sqrt,
+	"fabs":  math.Abs,
+	"log":   math.Log,
+	"log2":  math.Log2,
+	"log10": math.Log10,
+	"exp":   math.Exp,
+	"exp2":  math.Exp2,
+	"exp10": func(f float64) float64 { return math.Pow(10, f) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+}
+
+var functions = map[string]func(v interface{}, args []interface{}) (interface{}, error){
+	"length/0":         length,
+	"utf8bytelength/0": utf8ByteLength,
+	"keys/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return keys(v, true)
+	},
+	"keys_unsorted/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return keys(v, false)
+	},
+	"has/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		return has(v, args[0])
+	},
+	"contains/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		return contains(v, args[0])
+	},
+	"add/0":  addAll,
+	"type/0": func(v interface{}, _ []interface{}) (interface{}, error) { return typeOf(v), nil },
+	"tostring/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return applyFormat("text", v)
+	},
+	"tojson/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return Encode(v, 0), nil
+	},
+	"fromjson/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		s, isOk := v.(string)
+		if !isOk {
+			return nil, newError("%s cannot be parsed as JSON", describe(v))
+		}
+		result, err := Decode([]byte(s))
+		if err != nil {
+			return nil, newError("%s (while parsing '%s')", err.Error(), s)
+		}
+		return result, nil
+	},
+	"tonumber/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case float64, json.Number:
+			return v, nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, newError("Cannot parse '%s' as JSON", v)
+			}
+			return f, nil
+		}
+		return nil, newError("%s cannot be parsed as a number", describe(v))
+	},
+	"infinite/0":   func(interface{}, []interface{}) (interface{}, error) { return math.Inf(1), nil },
+	"nan/0":        func(interface{}, []interface{}) (interface{}, error) { return math.NaN(), nil },
+	"isinfinite/0": numberPredicate(func(f float64) bool { return math.IsInf(f, 0) }),
+	"isnan/0":      numberPredicate(math.IsNaN),
+	"isnormal/0": numberPredicate(func(f float64) bool {
+		return f != 0 && !math.IsNaN(f) && !math.IsInf(f, 0) && math.Abs(f) >= 2.2250738585072014e-308
+	}),
+	"now/0": func(interface{}, []interface{}) (interface{}, error) {
+		return float64(time.Now().UnixNano()) / 1e9, nil
+	},
+	"pow/2": func(_ interface{}, args []interface{}) (interface{}, error) {
+		x, isNumberX := toNumber(args[0])
+		y, isNumberY := toNumber(args[1])
+		if !isNumberX || !isNumberY {
+			return nil, newError("pow/2 requires numbers")
+		}
+		return math.Pow(x, y), nil
+	},
+	"sort/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		array, isOk := v.([]interface{})
+		if !isOk {
+			return nil, newError("%s cannot be sorted, as it is not an array", describe(v))
+		}
+		result := append([]interface{}(nil), array...)
+		sort.SliceStable(result, func(i, j int) bool {
+			return compareValues(result[i], result[j]) < 0
+		})
+		return result, nil
+	},
+	"min/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return extreme(v, -1)
+	},
+	"max/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		return extreme(v, 1)
+	},
+	"reverse/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case nil:
+			return make([]interface{}, 0), nil
+		case string:
+			runes := []rune(v)
+			for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+				runes[i], runes[j] = runes[j], runes[i]
+			}
+			return string(runes), nil
+		case []interface{}:
+			result := make([]interface{}, len(v))
+			for i, element := range v {
+				result[len(v)-1-i] = element
+			}
+			return result, nil
+		}
+		return nil, newError("Cannot reverse %s", describe(v))
+	},
+	"flatten/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		array, isOk := v.([]interface{})
+		if !isOk {
+			return nil, newError("Cannot flatten %s", describe(v))
+		}
+		depth, isOk := toNumber(args[0])
+		if !isOk || depth < 0 {
+			return nil, newError("flatten depth must not be negative")
+		}
+		return flatten(make([]interface{}, 0), array, depth), nil
+	},
+	"indices/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		if s, isOk := v.(string); isOk {
+			if sub, isOk := args[0].(string); isOk {
+				return stringIndices(s, sub), nil
+			}
+		}
+		if array, isOk := v.([]interface{}); isOk {
+			if _, isArray := args[0].([]interface{}); !isArray {
+				return index(array, []interface{}{args[0]})
+			}
+		}
+		return index(v, args[0])
+	},
+	"setpath/2": func(v interface{}, args []interface{}) (interface{}, error) {
+		path, isOk := args[0].([]interface{})
+		if !isOk {
+			return nil, newError("Path must be specified as an array")
+		}
+		return setPath(v, path, args[1])
+	},
+	"delpaths/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		paths, isOk := args[0].([]interface{})
+		if !isOk {
+			return nil, newError("Paths must be specified as an array")
+		}
+		return deletePaths(v, paths)
+	},
+	"split/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, isString := v.(string)
+		separator, isSeparatorString := args[0].(string)
+		if !isString || !isSeparatorString {
+			return nil, newError("split input and separator must be strings")
+		}
+		return splitString(s, separator), nil
+	},
+	"split/2": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, re, err := regexpArgs(v, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, 0)
+		for _, part := range re.Split(s, -1) {
+			result = append(result, part)
+		}
+		return result, nil
+	},
+	"test/1": testRegexp,
+	"test/2": testRegexp,
+	"ascii_downcase/0": stringFunction("ascii_downcase", func(s string) interface{} {
+		return mapASCII(s, 'A', 'Z', 'a'-'A')
+	}),
+	"ascii_upcase/0": stringFunction("ascii_upcase", func(s string) interface{} {
+		return mapASCII(s, 'a', 'z', 'A'-'a')
+	}),
+	"explode/0": stringFunction("explode", func(s string) interface{} {
+		result := make([]interface{}, 0, len(s))
+		for _, r := range s {
+			result = append(result, float64(r))
+		}
+		return result
+	}),
+	"trim/0":  stringFunction("trim", func(s string) interface{} { return strings.TrimSpace(s) }),
+	"ltrim/0": stringFunction("trim", func(s string) interface{} { return strings.TrimLeft(s, " \t\n\r\f\v") }),
+	"rtrim/0": stringFunction("trim", func(s string) interface{} { return strings.TrimRight(s, " \t\n\r\f\v") }),
+	"implode/0": func(v interface{}, _ []interface{}) (interface{}, error) {
+		array, isOk := v.([]interface{})
+		if !isOk {
+			return nil, newError("Implode input must be an array")
+		}
+		runes := make([]rune, len(array))
+		for i, element := range array {
+			f, isOk := toNumber(element)
+			if !isOk {
+				return nil, newError("Unicode codepoint must be numeric")
+			}
+			runes[i] = rune(f)
+		}
+		return string(runes), nil
+	},
+	"ltrimstr/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, isString := v.(string)
+		prefix, isPrefixString := args[0].(string)
+		if isString && isPrefixString {
+			return strings.TrimPrefix(s, prefix), nil
+		}
+		return v, nil
+	},
+	"rtrimstr/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, isString := v.(string)
+		suffix, isSuffixString := args[0].(string)
+		if isString && isSuffixString {
+			return strings.TrimSuffix(s, suffix), nil
+		}
+		return v, nil
+	},
+	"startswith/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, isString := v.(string)
+		prefix, isPrefixString := args[0].(string)
+		if !isString || !isPrefixString {
+			return nil, newError("startswith() requires string inputs")
+		}
+		return strings.HasPrefix(s, prefix), nil
+	},
+	"endswith/1": func(v interface{}, args []interface{}) (interface{}, error) {
+		s, isString := v.(string)
+		suffix, isSuffixString := args[0].(string)
+		if !isString || !isSuffixString {
+			return nil, newError("endswith() requires string inputs")
+		}
+		return strings.HasSuffix(s, suffix), nil
+	},
+}
+
+func numberPredicate(fn func(float64) bool) func(v interface{}, _ []interface{}) (interface{}, error) {
+	return func(v interface{}, _ []interface{}) (interface{}, error) {
+		f, isOk := toNumber(v)
+		if !isOk {
+			return nil, newError("%s number required", describe(v))
+		}
+		return fn(f), nil
+	}
+}
+
+func stringFunction(name string, fn func(s string) interface{}) func(v interface{}, _ []interface{}) (interface{}, error) {
+	return func(v interface{}, _ []interface{}) (interface{}, error) {
+		s, isOk := v.(string)
+		if !isOk {
+			return nil, newError("%s input must be a string", name)
+		}
+		return fn(s), nil
+	}
+}
+
+func mapASCII(s string, from, to byte, delta int) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= from && c <= to {
+			b[i] = byte(int(c) + delta)
+		}
+	}
+	return string(b)
+}
+
+func length(v interface{}, _ []interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0.0, nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case *orderedmap.OrderedMap:
+		return float64(v.Size()), nil
+	}
+	if f, isOk := toNumber(v); isOk {
+		return math.Abs(f), nil
+	}
+	return nil, newError("%s has no length", describe(v))
+}
+
+func utf8ByteLength(v interface{}, _ []interface{}) (interface{}, error) {
+	s, isOk := v.(string)
+	if !isOk {
+		return nil, newError("%s only strings have UTF-8 byte length", describe(v))
+	}
+	return float64(len(s)), nil
+}
+
+func keys(v interface{}, sorted bool) (interface{}, error) {
+	switch v := v.(type) {
+	case *orderedmap.OrderedMap:
+		if sorted {
+			return stringsToValues(sortedKeys(v)), nil
+		}
+		return stringsToValues(v.Keys()), nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i := range v {
+			result[i] = float64(i)
+		}
+		return result, nil
+	}
+	return nil, newError("%s has no keys", describe(v))
+}
+
+func has(v, key interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *orderedmap.OrderedMap:
+		if key, isOk := key.(string); isOk {
+			return v.Exist(key), nil
+		}
+	case []interface{}:
+		if f, isOk := toNumber(key); isOk {
+			return f >= 0 && f < float64(len(v)), nil
+		}
+	}
+	return nil, newError("Cannot check whether %s has a %s key", typeOf(v), typeOf(key))
+}
+
+func contains(a, b interface{}) (bool, error) {
+	if typeOrder(a) != typeOrder(b) && !(typeOf(a) == "boolean" && typeOf(b) == "boolean") {
+		return false, newError("%s and %s cannot have their containment checked", describe(a), describe(b))
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Contains(a, b.(string)), nil
+	case []interface{}:
+		for _, y := range b.([]interface{}) {
+			found := false
+			for _, x := range a {
+				if typeOrder(x) != typeOrder(y) {
+					continue
+				}
+				if isOk, err := contains(x, y); err != nil {
+					return false, err
+				} else if isOk {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *orderedmap.OrderedMap:
+		for _, key := range b.(*orderedmap.OrderedMap).Keys() {
+			x, exists := a.Get(key)
+			if !exists {
+				return false, nil
+			}
+			y := b.(*orderedmap.OrderedMap).GetOr(key)
+			if typeOrder(x) != typeOrder(y) && !(typeOf(x) == "boolean" && typeOf(y) == "boolean") {
+				return false, nil
+			}
+			if isOk, err := contains(x, y); err != nil || !isOk {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return compareValues(a, b) == 0, nil
+}
+
+func addAll(v interface{}, _ []interface{}) (interface{}, error) {
+	var values []interface{}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		values = v
+	case *orderedmap.OrderedMap:
+		v.Foreach(func(_ string, value interface{}) {
+			values = append(values, value)
+		})
+	default:
+		return nil, newError("Cannot iterate over %s", describe(v))
+	}
+	var result interface{}
+	for _, value := range values {
+		var err error
+		if result, err = add(result, value); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// extreme returns the least element of an array if sign is -1, the greatest
+// if it is 1.
+func extreme(v interface{}, sign int) (interface{}, error) {
+	array, isOk := v.([]interface{})
+	if !isOk {
+		return nil, newError("%s cannot be iterated over", describe(v))
+	}
+	var result interface{}
+	for i, element := range array {
+		if i == 0 || compareValues(element, result)*sign >= 0 && (sign > 0 || compareValues(element, result) != 0) {
+			result = element
+		}
+	}
+	return result, nil
+}
+
+func flatten(result, array []interface{}, depth float64) []interface{} {
+	for _, element := range array {
+		if nested, isOk := element.([]interface{}); isOk && depth > 0 {
+			result = flatten(result, nested, depth-1)
+		} else {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+// stringIndices returns the offsets in code points of the occurrences of sub
+// in s.
+func stringIndices(s, sub string) interface{} {
+	result := make([]interface{}, 0)
+	if sub == "" {
+		return nil
+	}
+	for offset := 0; offset <= len(s)-len(sub); offset++ {
+		if strings.HasPrefix(s[offset:], sub) {
+			result = append(result, float64(utf8.RuneCountInString(s[:offset])))
+		}
+	}
+	return result
+}
+
+func pathNative(e *env, in item, args []expr, out func(item) error) error {
+	return args[0].eval(e, item{value: in.value, path: []interface{}{}}, func(it item) error {
+		return emit(in, append(make([]interface{}, 0, len(it.path)), it.path...), out)
+	})
+}
+
+func getpathNative(e *env, in item, args []expr, out func(item) error) error {
+	return eachValue(e, args[0], in, func(p interface{}) error {
+		path, isOk := p.([]interface{})
+		if !isOk {
+			return newError("Path must be specified as an array")
+		}
+		v, err := getPath(in.value, path)
+		if err != nil {
+			return err
+		}
+		if in.path == nil {
+			return out(item{value: v})
+		}
+		return out(item{value: v, path: append(append(make([]interface{}, 0, len(in.path)+len(path)), in.path...), path...)})
+	})
+}
+
+func limitNative(e *env, in item, args []expr, out func(item) error) error {
+	return eachValue(e, args[0], in, func(n interface{}) error {
+		count, isOk := toInt(n)
+		if !isOk {
+			return newError("Invalid limit: must be a number")
+		}
+		if count <= 0 {
+			return nil
+		}
+		stop, i := &breakError{}, 0
+		err := args[1].eval(e, in, func(it item) error {
+			if err := out(it); err != nil {
+				return err
+			}
+			if i++; i == count {
+				return stop
+			}
+			return nil
+		})
+		if err == stop {
+			return nil
+		}
+		return err
+	})
+}
+
+func rangeNative(e *env, in item, args []expr, out func(item) error) error {
+	return eachArgs(e, in, args, nil, func(values []interface{}) error {
+		from, isNumberFrom := toNumber(values[0])
+		upto, isNumberUpto := toNumber(values[1])
+		by := 1.0
+		isNumberBy := true
+		if len(values) == 3 {
+			by, isNumberBy = toNumber(values[2])
+		}
+		if !isNumberFrom || !isNumberUpto || !isNumberBy {
+			return newError("Range bounds must be numeric")
+		}
+		for f := from; by > 0 && f < upto || by < 0 && f > upto; f += by {
+			if err := e.step(); err != nil {
+				return err
+			}
+			if err := emit(in, f, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sortByKeys returns the elements of an array and their keys [f] sorted by
+// the keys.
+func sortByKeys(e *env, in item, f expr) ([]interface{}, []interface{}, error) {
+	array, isOk := in.value.([]interface{})
+	if !isOk {
+		return nil, nil, newError("Cannot index %s with number", typeOf(in.value))
+	}
+	type keyed struct {
+		key, value interface{}
+	}
+	elements := make([]keyed, len(array))
+	for i, element := range array {
+		key := make([]interface{}, 0, 1)
+		err := eachValue(e, f, valueItem(element), func(v interface{}) error {
+			key = append(key, v)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		elements[i] = keyed{key: key, value: element}
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		return compareValues(elements[i].key, elements[j].key) < 0
+	})
+	values, keys := make([]interface{}, len(elements)), make([]interface{}, len(elements))
+	for i, element := range elements {
+		values[i], keys[i] = element.value, element.key
+	}
+	return values, keys, nil
+}
+
+// byKeysNative returns a builtin like sort_by(f), fn computes its result from
+// the elements sorted by their keys.
+func byKeysNative(fn func(values, keys []interface{}) (interface{}, error)) native {
+	return func(e *env, in item, args []expr, out func(item) error) error {
+		values, keys, err := sortByKeys(e, in, args[0])
+		if err != nil {
+			return err
+		}
+		v, err := fn(values, keys)
+		if err != nil {
+			return err
+		}
+		return emit(in, v, out)
+	}
+}
+
+var sortByNative = byKeysNative(func(values, _ []interface{}) (interface{}, error) {
+	return values, nil
+})
+
+var groupByNative = byKeysNative(func(values, keys []interface{}) (interface{}, error) {
+	groups := make([]interface{}, 0)
+	for i := range values {
+		if i == 0 || compareValues(keys[i], keys[i-1]) != 0 {
+			groups = append(groups, make([]interface{}, 0, 1))
+		}
+		last := len(groups) - 1
+		groups[last] = append(groups[last].([]interface{}), values[i])
+	}
+	return groups, nil
+})
+
+// compileRegexp compiles a regular expression with the flags of jq, global
+// is set by the flag g.
+func compileRegexp(re, flags interface{}) (*regexp.Regexp, bool, error) {
+	pattern, isOk := re.(string)
+	if !isOk {
+		return nil, false, newError("%s cannot be matched, as it is not a string", describe(re))
+	}
+	modifiers, global := "", false
+	if flags != nil {
+		text, isOk := flags.(string)
+		if !isOk {
+			return nil, false, newError("%s is not a string", describe(flags))
+		}
+		for _, flag := range text {
+			switch flag {
+			case 'g':
+				global = true
+			case 'i':
+				modifiers += "i"
+			case 's':
+				modifiers += "s"
+			case 'x', 'n', 'l', 'p':
+			default:
+				return nil, false, newError("%s is not a valid modifier string", text)
+			}
+		}
+	}
+	// named groups are written (?<name>...) in jq
+	pattern = namedGroup.ReplaceAllString(pattern, "${1}(?P<")
+	if modifiers != "" {
+		pattern = "(?" + modifiers + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, false, newError("%s (at offset 0) is not a valid regex: %s", re, err.Error())
+	}
+	return compiled, global, nil
+}
+
+var namedGroup = regexp.MustCompile(`((?:^|[^\\])(?:\\\\)*)\(\?<`)
+
+func regexpArgs(v, re, flags interface{}) (string, *regexp.Regexp, error) {
+	s, isOk := v.(string)
+	if !isOk {
+		return "", nil, newError("%s cannot be matched, as it is not a string", describe(v))
+	}
+	compiled, _, err := compileRegexp(re, flags)
+	return s, compiled, err
+}
+
+func testRegexp(v interface{}, args []interface{}) (interface{}, error) {
+	var flags interface{}
+	if len(args) > 1 {
+		flags = args[1]
+	}
+	s, re, err := regexpArgs(v, args[0], flags)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+// matchNative is match(re) and match(re; flags), which output an object for
+// each match of re.
+func matchNative(e *env, in item, args []expr, out func(item) error) error {
+	return eachArgs(e, in, args, nil, func(values []interface{}) error {
+		var flags interface{}
+		if len(values) > 1 {
+			flags = values[1]
+		}
+		matches, err := matchRegexp(in.value, values[0], flags)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			if err := emit(in, m, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func matchRegexp(v, re, flags interface{}) ([]interface{}, error) {
+	s, isOk := v.(string)
+	if !isOk {
+		return nil, newError("%s cannot be matched, as it is not a string", describe(v))
+	}
+	compiled, global, err := compileRegexp(re, flags)
+	if err != nil {
+		return nil, err
+	}
+	count := 1
+	if global {
+		count = -1
+	}
+	result := make([]interface{}, 0)
+	for _, m := range compiled.FindAllStringSubmatchIndex(s, count) {
+		result = append(result, matchObject(s, compiled, m))
+	}
+	return result, nil
+}
+
+func matchObject(s string, re *regexp.Regexp, m []int) *orderedmap.OrderedMap {
+	offset := func(i int) float64 {
+		return float64(utf8.RuneCountInString(s[:i]))
+	}
+	object := orderedmap.New()
+	object.Set("offset", offset(m[0]))
+	object.Set("length", float64(utf8.RuneCountInString(s[m[0]:m[1]])))
+	object.Set("string", s[m[0]:m[1]])
+	captures := make([]interface{}, 0)
+	for i, name := range re.SubexpNames()[1:] {
+		capture := orderedmap.New()
+		start, end := m[2*i+2], m[2*i+3]
+		if start < 0 {
+			capture.Set("offset", -1.0)
+			capture.Set("length", 0.0)
+			capture.Set("string", nil)
+		} else {
+			capture.Set("offset", offset(start))
+			capture.Set("length", float64(utf8.RuneCountInString(s[start:end])))
+			capture.Set("string", s[start:end])
+		}
+		if name == "" {
+			capture.Set("name", nil)
+		} else {
+			capture.Set("name", name)
+		}
+		captures = append(captures, capture)
+	}
+	object.Set("captures", captures)
+	return object
+}
+
+// subNative is sub(re; str) and sub(re; str; flags), str is evaluated on an
+// object of the named captures of each match.
+func subNative(e *env, in item, args []expr, out func(item) error) error {
+	flagsArg := expr(literal{value: nil})
+	if len(args) == 3 {
+		flagsArg = args[2]
+	}
+	return eachValue(e, flagsArg, in, func(flags interface{}) error {
+		return eachValue(e, args[0], in, func(re interface{}) error {
+			s, isOk := in.value.(string)
+			if !isOk {
+				return newError("%s cannot be matched, as it is not a string", describe(in.value))
+			}
+			compiled, global, err := compileRegexp(re, flags)
+			if err != nil {
+				return err
+			}
+			count := 1
+			if global {
+				count = -1
+			}
+			matches := compiled.FindAllStringSubmatchIndex(s, count)
+			var replace func(i int, prefix string) error
+			replace = func(i int, prefix string) error {
+				start := 0
+				if i > 0 {
+					start = matches[i-1][1]
+				}
+				if i == len(matches) {
+					return emit(in, prefix+s[start:], out)
+				}
+				m := matches[i]
+				captures := orderedmap.New()
+				for j, name := range compiled.SubexpNames() {
+					if name == "" {
+						continue
+					}
+					if m[2*j] < 0 {
+						captures.Set(name, nil)
+					} else {
+						captures.Set(name, s[m[2*j]:m[2*j+1]])
+					}
+				}
+				return eachValue(e, args[1], valueItem(captures), func(replacement interface{}) error {
+					text, isOk := replacement.(string)
+					if !isOk {
+						return newError("%s cannot be added to a string", describe(replacement))
+					}
+					return replace(i+1, prefix+s[start:m[0]]+text)
+				})
+			}
+			return replace(0, "")
+		})
+	})
+}
@@ -0,0 +1,976 @@
+package jq
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anthony-dong/jsonui/internal/orderedmap"
+)
+
+// checkSteps is how many steps are evaluated between two checks of the
+// context of a query.
+const checkSteps = 1024
+
+// maxCallDepth is how many function calls may be nested. The evaluation
+// recurses on the Go stack, which an endless recursion like def f: f; f
+// would overflow and crash the process.
+const maxCallDepth = 10000
+
+// errCallDepth stops a query nesting more than maxCallDepth calls, it can't be
+// caught by try.
+var errCallDepth = fmt.Errorf("the function calls are nested more than %d times", maxCallDepth)
+
+// maxRepeatSize is the length of the longest string repeated by string *
+// number, like for arrays in setPath a longer one would take all the memory.
+const maxRepeatSize = 1 << 27
+
+// Error is raised by error(value) and by the failures of the evaluation, such
+// as indexing a number. try catches them.
+type Error struct {
+	Value interface{}
+}
+
+func (err *Error) Error() string {
+	if s, isOk := err.Value.(string); isOk {
+		return s
+	}
+	return Encode(err.Value, 0) + " (not a string)"
+}
+
+func newError(format string, args ...interface{}) *Error {
+	return &Error{Value: fmt.Sprintf(format, args...)}
+}
+
+// breakError stops a generator early, for limit and first. Each use has its
+// own, which is not caught by try.
+type breakError struct {
+	// pointers to distinct zero-size values may be equal
+	_ byte
+}
+
+func (*breakError) Error() string {
+	return "break"
+}
+
+// downstreamError is an error raised by the consumer of the outputs of a try,
+// which the try lets through.
+type downstreamError struct {
+	err error
+}
+
+func (err *downstreamError) Error() string {
+	return err.err.Error()
+}
+
+// item is a value being evaluated. In a path expression such as the left side
+// of an assignment, path is where the value is in the input of the path
+// expression, it is nil elsewhere.
+type item struct {
+	value interface{}
+	path  []interface{}
+}
+
+func valueItem(v interface{}) item {
+	return item{value: v}
+}
+
+// child returns the item of the value at key of it.
+func (it item) child(key, value interface{}) item {
+	if it.path == nil {
+		return item{value: value}
+	}
+	path := make([]interface{}, len(it.path)+1)
+	copy(path, it.path)
+	path[len(it.path)] = key
+	return item{value: value, path: path}
+}
+
+// emit outputs a value computed from it, which isn't a path.
+func emit(it item, v interface{}, out func(item) error) error {
+	if it.path != nil {
+		return newError("Invalid path expression with result %s", describe(v))
+	}
+	return out(item{value: v})
+}
+
+type expr interface {
+	eval(e *env, in item, out func(item) error) error
+}
+
+// env holds the variables and the functions in scope, each binding is linked
+// to the bindings made before it.
+type env struct {
+	parent *env
+	name   string // $name of a variable, name/arity of a function
+	value  interface{}
+	fn     *closure
+	state  *runState
+}
+
+// closure is a function along with the env it is defined in.
+type closure struct {
+	def *funcDef
+	env *env
+}
+
+type runState struct {
+	ctx   context.Context
+	steps int
+	depth int // function calls being evaluated
+}
+
+func (e *env) step() error {
+	if e.state.steps++; e.state.steps%checkSteps == 0 {
+		return e.state.ctx.Err()
+	}
+	return nil
+}
+
+func (e *env) bindValue(name string, v interface{}) *env {
+	return &env{parent: e, name: name, value: v, state: e.state}
+}
+
+func (e *env) bindFunction(def *funcDef, defEnv *env) *env {
+	child := &env{parent: e, name: fmt.Sprintf("%s/%d", def.name, len(def.params)), state: e.state}
+	if defEnv == nil {
+		// the function is in scope in its own body
+		defEnv = child
+	}
+	child.fn = &closure{def: def, env: defEnv}
+	return child
+}
+
+func (e *env) lookup(name string) *env {
+	for cur := e; cur != nil; cur = cur.parent {
+		if cur.name == name {
+			return cur
+		}
+	}
+	return nil
+}
+
+// eachValue evaluates x on the value of in, outside of path expressions.
+func eachValue(e *env, x expr, in item, fn func(v interface{}) error) error {
+	return x.eval(e, valueItem(in.value), func(it item) error {
+		return fn(it.value)
+	})
+}
+
+type identity struct{}
+
+func (identity) eval(_ *env, in item, out func(item) error) error {
+	return out(in)
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (x literal) eval(_ *env, in item, out func(item) error) error {
+	if in.path != nil && x.value == nil {
+		// null is the path of nothing, like in getpath
+		return out(item{path: in.path})
+	}
+	return emit(in, x.value, out)
+}
+
+type pipe struct {
+	left, right expr
+}
+
+func (x pipe) eval(e *env, in item, out func(item) error) error {
+	return x.left.eval(e, in, func(it item) error {
+		if err := e.step(); err != nil {
+			return err
+		}
+		return x.right.eval(e, it, out)
+	})
+}
+
+type comma struct {
+	left, right expr
+}
+
+func (x comma) eval(e *env, in item, out func(item) error) error {
+	if err := x.left.eval(e, in, out); err != nil {
+		return err
+	}
+	return x.right.eval(e, in, out)
+}
+
+// indexExpr is term[key], the key is evaluated on the input of the term.
+type indexExpr struct {
+	term, key expr
+}
+
+func (x indexExpr) eval(e *env, in item, out func(item) error) error {
+	return x.term.eval(e, in, func(t item) error {
+		return eachValue(e, x.key, in, func(key interface{}) error {
+			v, err := index(t.value, key)
+			if err != nil {
+				return err
+			}
+			return out(t.child(key, v))
+		})
+	})
+}
+
+// sliceExpr is term[start:end], start or end may be nil.
+type sliceExpr struct {
+	term, start, end expr
+}
+
+func (x sliceExpr) eval(e *env, in item, out func(item) error) error {
+	bound := func(b expr, fn func(v interface{}) error) error {
+		if b == nil {
+			return fn(nil)
+		}
+		return eachValue(e, b, in, fn)
+	}
+	return x.term.eval(e, in, func(t item) error {
+		return bound(x.end, func(end interface{}) error {
+			return bound(x.start, func(start interface{}) error {
+				key := orderedmap.New()
+				key.Set("start", start)
+				key.Set("end", end)
+				v, err := index(t.value, key)
+				if err != nil {
+					return err
+				}
+				return out(t.child(key, v))
+			})
+		})
+	})
+}
+
+// iterate is term[], the values of an array or an object.
+type iterate struct {
+	term expr
+}
+
+func (x iterate) eval(e *env, in item, out func(item) error) error {
+	return x.term.eval(e, in, func(t item) error {
+		return iterateValues(t, out)
+	})
+}
+
+func iterateValues(t item, out func(item) error) error {
+	switch v := t.value.(type) {
+	case []interface{}:
+		for i, element := range v {
+			if err := out(t.child(float64(i), element)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *orderedmap.OrderedMap:
+		return v.ForeachErr(func(key string, value interface{}) error {
+			return out(t.child(key, value))
+		})
+	}
+	return newError("Cannot iterate over %s", describeIterable(t.value))
+}
+
+func describeIterable(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return describe(v)
+}
+
+// tryExpr is try body catch handler, and body? without a handler.
+type tryExpr struct {
+	body, handler expr
+}
+
+func (x tryExpr) eval(e *env, in item, out func(item) error) error {
+	err := x.body.eval(e, in, func(it item) error {
+		if err := out(it); err != nil {
+			return &downstreamError{err: err}
+		}
+		return nil
+	})
+	switch caught := err.(type) {
+	case nil:
+		return nil
+	case *downstreamError:
+		return caught.err
+	case *Error:
+		if x.handler == nil {
+			return nil
+		}
+		return x.handler.eval(e, valueItem(caught.Value), func(it item) error {
+			return emit(in, it.value, out)
+		})
+	}
+	// cancelled or stopped by a break
+	return err
+}
+
+type arrayExpr struct {
+	body expr // nil for []
+}
+
+func (x arrayExpr) eval(e *env, in item, out func(item) error) error {
+	array := make([]interface{}, 0)
+	if x.body != nil {
+		err := eachValue(e, x.body, in, func(v interface{}) error {
+			array = append(array, v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return emit(in, array, out)
+}
+
+type objectEntry struct {
+	key, value expr
+}
+
+type objectExpr struct {
+	entries []objectEntry
+}
+
+func (x objectExpr) eval(e *env, in item, out func(item) error) error {
+	return x.build(e, in, 0, orderedmap.New(), out)
+}
+
+// build adds the entries from index i on to object, an object is output for
+// each combination of the values of the keys and values.
+func (x objectExpr) build(e *env, in item, i int, object *orderedmap.OrderedMap, out func(item) error) error {
+	if i == len(x.entries) {
+		return emit(in, object, out)
+	}
+	entry := x.entries[i]
+	return eachValue(e, entry.key, in, func(key interface{}) error {
+		name, isOk := key.(string)
+		if !isOk {
+			return newError("Object keys must be strings")
+		}
+		return eachValue(e, entry.value, in, func(value interface{}) error {
+			next := copyObject(object)
+			next.Set(name, value)
+			return x.build(e, in, i+1, next, out)
+		})
+	})
+}
+
+type negate struct {
+	operand expr
+}
+
+func (x negate) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.operand, in, func(v interface{}) error {
+		f, isOk := toNumber(v)
+		if !isOk {
+			return newError("%s cannot be negated", describe(v))
+		}
+		return emit(in, -f, out)
+	})
+}
+
+// binary is an arithmetic or comparison operator, the right operand is the
+// outer loop like in jq.
+type binary struct {
+	op          string
+	left, right expr
+}
+
+func (x binary) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.right, in, func(r interface{}) error {
+		return eachValue(e, x.left, in, func(l interface{}) error {
+			v, err := binaryOp(x.op, l, r)
+			if err != nil {
+				return err
+			}
+			return emit(in, v, out)
+		})
+	})
+}
+
+type andExpr struct {
+	left, right expr
+}
+
+func (x andExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.left, in, func(l interface{}) error {
+		if !truthy(l) {
+			return emit(in, false, out)
+		}
+		return eachValue(e, x.right, in, func(r interface{}) error {
+			return emit(in, truthy(r), out)
+		})
+	})
+}
+
+type orExpr struct {
+	left, right expr
+}
+
+func (x orExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.left, in, func(l interface{}) error {
+		if truthy(l) {
+			return emit(in, true, out)
+		}
+		return eachValue(e, x.right, in, func(r interface{}) error {
+			return emit(in, truthy(r), out)
+		})
+	})
+}
+
+// alternative is left // right: the values of left which are neither false
+// nor null, or the values of right if there are none.
+type alternative struct {
+	left, right expr
+}
+
+func (x alternative) eval(e *env, in item, out func(item) error) error {
+	found := false
+	err := x.left.eval(e, in, func(it item) error {
+		if !truthy(it.value) {
+			return nil
+		}
+		found = true
+		if err := out(it); err != nil {
+			return &downstreamError{err: err}
+		}
+		return nil
+	})
+	switch caught := err.(type) {
+	case *downstreamError:
+		return caught.err
+	case *Error, nil:
+	default:
+		return err
+	}
+	if found {
+		return nil
+	}
+	return x.right.eval(e, in, out)
+}
+
+type ifExpr struct {
+	cond, then, otherwise expr // otherwise is nil without else
+}
+
+func (x ifExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.cond, in, func(c interface{}) error {
+		if truthy(c) {
+			return x.then.eval(e, in, out)
+		}
+		if x.otherwise == nil {
+			return out(in)
+		}
+		return x.otherwise.eval(e, in, out)
+	})
+}
+
+// bindExpr is source as pattern | body.
+type bindExpr struct {
+	source  expr
+	pattern *pattern
+	body    expr
+}
+
+func (x bindExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.source, in, func(v interface{}) error {
+		return x.pattern.bind(e, in, v, func(bound *env) error {
+			return x.body.eval(bound, in, out)
+		})
+	})
+}
+
+// reduceExpr is reduce source as pattern (init; update).
+type reduceExpr struct {
+	source       expr
+	pattern      *pattern
+	init, update expr
+}
+
+func (x reduceExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.init, in, func(acc interface{}) error {
+		err := eachValue(e, x.source, in, func(v interface{}) error {
+			return x.pattern.bind(e, in, v, func(bound *env) error {
+				next := interface{}(nil)
+				err := eachValue(bound, x.update, valueItem(acc), func(u interface{}) error {
+					next = u
+					return nil
+				})
+				acc = next
+				return err
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return emit(in, acc, out)
+	})
+}
+
+// foreachExpr is foreach source as pattern (init; update; extract).
+type foreachExpr struct {
+	source                expr
+	pattern               *pattern
+	init, update, extract expr // extract is nil for .
+}
+
+func (x foreachExpr) eval(e *env, in item, out func(item) error) error {
+	return eachValue(e, x.init, in, func(acc interface{}) error {
+		return eachValue(e, x.source, in, func(v interface{}) error {
+			return x.pattern.bind(e, in, v, func(bound *env) error {
+				return eachValue(bound, x.update, valueItem(acc), func(u interface{}) error {
+					acc = u
+					if x.extract == nil {
+						return emit(in, u, out)
+					}
+					return eachValue(bound, x.extract, valueItem(u), func(extracted interface{}) error {
+						return emit(in, extracted, out)
+					})
+				})
+			})
+		})
+	})
+}
+
+type funcDef struct {
+	name   string
+	params []string // $name for the value parameters
+	body   expr
+}
+
+// defineExpr is def name: body; rest.
+type defineExpr struct {
+	def  *funcDef
+	rest expr
+}
+
+func (x defineExpr) eval(e *env, in item, out func(item) error) error {
+	return x.rest.eval(e.bindFunction(x.def, nil), in, out)
+}
+
+type funcCall struct {
+	name string
+	args []expr
+}
+
+func (x funcCall) eval(e *env, in item, out func(item) error) error {
+	name := fmt.Sprintf("%s/%d", x.name, len(x.args))
+	if bound := e.lookup(name); bound != nil {
+		return callClosure(e, bound.fn, x.args, in, out)
+	}
+	if fn, isOk := builtinDefs[name]; isOk {
+		return callClosure(e, fn, x.args, in, out)
+	}
+	if native, isOk := natives[name]; isOk {
+		return native(e, in, x.args, out)
+	}
+	return newError("%s is not defined", name)
+}
+
+// callClosure calls a function with args, which are evaluated in the env of
+// the caller e.
+func callClosure(e *env, fn *closure, args []expr, in item, out func(item) error) error {
+	if err := e.step(); err != nil {
+		return err
+	}
+	if e.state.depth >= maxCallDepth {
+		return errCallDepth
+	}
+	e.state.depth++
+	defer func() {
+		e.state.depth--
+	}()
+	// the body runs with the state of the caller, the builtins are shared
+	// by all the runs
+	frame := &env{parent: fn.env, state: e.state}
+	return bindParams(e, frame, fn.def.params, args, in, func(body *env) error {
+		return fn.def.body.eval(body, in, out)
+	})
+}
+
+func bindParams(caller, body *env, params []string, args []expr, in item, fn func(body *env) error) error {
+	if len(params) == 0 {
+		return fn(body)
+	}
+	param, arg := params[0], args[0]
+	if strings.HasPrefix(param, "$") {
+		// def f($a) is def f(a): a as $a, with a returning the value
+		return eachValue(caller, arg, in, func(v interface{}) error {
+			bound := body.bindValue(param, v).bindFunction(&funcDef{name: param[1:], body: literal{value: v}}, caller)
+			return bindParams(caller, bound, params[1:], args[1:], in, fn)
+		})
+	}
+	bound := body.bindFunction(&funcDef{name: param, body: arg}, caller)
+	return bindParams(caller, bound, params[1:], args[1:], in, fn)
+}
+
+type varRef struct {
+	name string
+}
+
+func (x varRef) eval(e *env, in item, out func(item) error) error {
+	bound := e.lookup(x.name)
+	if bound == nil {
+		if x.name == "$ENV" {
+			return emit(in, environment(), out)
+		}
+		return newError("%s is not defined", x.name)
+	}
+	return emit(in, bound.value, out)
+}
+
+// environment returns the environment variables as an object.
+func environment() *orderedmap.OrderedMap {
+	object := orderedmap.New()
+	for _, variable := range os.Environ() {
+		if i := strings.IndexByte(variable, '='); i > 0 {
+			object.Set(variable[:i], variable[i+1:])
+		}
+	}
+	return object
+}
+
+// stringExpr is a string with interpolations "a \(.b)", formatted by format
+// for @format "a \(.b)".
+type stringExpr struct {
+	parts  []stringPart // in order
+	format string
+}
+
+// stringPart is either the text of a string or an interpolation \(x), when x
+// is set.
+type stringPart struct {
+	text string
+	x    expr
+}
+
+func (x stringExpr) eval(e *env, in item, out func(item) error) error {
+	return x.build(e, in, 0, "", out)
+}
+
+func (x stringExpr) build(e *env, in item, i int, prefix string, out func(item) error) error {
+	if i == len(x.parts) {
+		return emit(in, prefix, out)
+	}
+	if x.parts[i].x == nil {
+		return x.build(e, in, i+1, prefix+x.parts[i].text, out)
+	}
+	return eachValue(e, x.parts[i].x, in, func(v interface{}) error {
+		text, err := applyFormat(x.format, v)
+		if err != nil {
+			return err
+		}
+		return x.build(e, in, i+1, prefix+text, out)
+	})
+}
+
+// formatExpr is @name, which formats its input.
+type formatExpr struct {
+	format string
+}
+
+func (x formatExpr) eval(_ *env, in item, out func(item) error) error {
+	text, err := applyFormat(x.format, in.value)
+	if err != nil {
+		return err
+	}
+	return emit(in, text, out)
+}
+
+// assignExpr is an assignment of the paths of lhs: = with the values of rhs,
+// |= with rhs applied to the values at the paths, and the arithmetic updates
+// like += with the values of rhs.
+type assignExpr struct {
+	op       string
+	lhs, rhs expr
+}
+
+func (x assignExpr) eval(e *env, in item, out func(item) error) error {
+	var paths [][]interface{}
+	err := x.lhs.eval(e, item{value: in.value, path: []interface{}{}}, func(it item) error {
+		paths = append(paths, it.path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if x.op == "|=" {
+		v := in.value
+		for _, path := range paths {
+			old, err := getPath(v, path)
+			if err != nil {
+				return err
+			}
+			updated, found := interface{}(nil), false
+			err = eachValue(e, x.rhs, valueItem(old), func(u interface{}) error {
+				updated, found = u, true
+				return &breakError{}
+			})
+			if _, isBreak := err.(*breakError); err != nil && !isBreak {
+				return err
+			}
+			if found {
+				v, err = setPath(v, path, updated)
+			} else {
+				v, err = deletePaths(v, []interface{}{path})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return emit(in, v, out)
+	}
+	return eachValue(e, x.rhs, in, func(r interface{}) error {
+		v := in.value
+		for _, path := range paths {
+			value := r
+			if x.op != "=" {
+				old, err := getPath(v, path)
+				if err != nil {
+					return err
+				}
+				if x.op == "//=" {
+					if truthy(old) {
+						value = old
+					}
+				} else if value, err = binaryOp(strings.TrimSuffix(x.op, "="), old, r); err != nil {
+					return err
+				}
+			}
+			var err error
+			if v, err = setPath(v, path, value); err != nil {
+				return err
+			}
+		}
+		return emit(in, v, out)
+	})
+}
+
+// pattern is the destructuring of a value bound by as, reduce and foreach: a
+// variable, an array of patterns or an object of patterns.
+type pattern struct {
+	name   string
+	array  []*pattern
+	object []objectPattern
+}
+
+type objectPattern struct {
+	name  string // $name, bound to the value at key
+	key   expr
+	value *pattern // nil for {$name}
+}
+
+// bind binds the variables of p to the parts of v, fn is called for each way
+// of binding them.
+func (p *pattern) bind(e *env, in item, v interface{}, fn func(bound *env) error) error {
+	switch {
+	case p.name != "":
+		return fn(e.bindValue(p.name, v))
+	case p.array != nil:
+		if v != nil {
+			if _, isOk := v.([]interface{}); !isOk {
+				return newError("Cannot index %s with number", typeOf(v))
+			}
+		}
+		return bindArray(e, in, v, p.array, 0, fn)
+	}
+	return bindObject(e, in, v, p.object, fn)
+}
+
+func bindArray(e *env, in item, v interface{}, patterns []*pattern, i int, fn func(bound *env) error) error {
+	if i == len(patterns) {
+		return fn(e)
+	}
+	element, _ := index(v, float64(i))
+	return patterns[i].bind(e, in, element, func(bound *env) error {
+		return bindArray(bound, in, v, patterns, i+1, fn)
+	})
+}
+
+func bindObject(e *env, in item, v interface{}, patterns []objectPattern, fn func(bound *env) error) error {
+	if len(patterns) == 0 {
+		return fn(e)
+	}
+	p := patterns[0]
+	return eachValue(e, p.key, in, func(key interface{}) error {
+		name, isOk := key.(string)
+		if !isOk {
+			return newError("Cannot index %s with %s", typeOf(v), typeOf(key))
+		}
+		value, err := index(v, name)
+		if err != nil {
+			return err
+		}
+		bound := e
+		if p.name != "" {
+			bound = bound.bindValue(p.name, value)
+		}
+		if p.value == nil {
+			return bindObject(bound, in, v, patterns[1:], fn)
+		}
+		return p.value.bind(bound, in, value, func(bound *env) error {
+			return bindObject(bound, in, v, patterns[1:], fn)
+		})
+	})
+}
+
+// binaryOp applies an arithmetic or comparison operator.
+func binaryOp(op string, l, r interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return compareValues(l, r) == 0, nil
+	case "!=":
+		return compareValues(l, r) != 0, nil
+	case "<":
+		return compareValues(l, r) < 0, nil
+	case "<=":
+		return compareValues(l, r) <= 0, nil
+	case ">":
+		return compareValues(l, r) > 0, nil
+	case ">=":
+		return compareValues(l, r) >= 0, nil
+	case "+":
+		return add(l, r)
+	}
+	x, isNumberX := toNumber(l)
+	y, isNumberY := toNumber(r)
+	if isNumberX && isNumberY {
+		switch op {
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return nil, newError("%s and %s cannot be divided because the divisor is zero", describe(l), describe(r))
+			}
+			return x / y, nil
+		case "%":
+			a, b := int(x), int(y)
+			if b == 0 {
+				return nil, newError("%s and %s cannot be divided because the divisor is zero", describe(l), describe(r))
+			}
+			if b < 0 {
+				b = -b
+			}
+			return float64(a % b), nil
+		}
+	}
+	switch op {
+	case "-":
+		if a, isOk := l.([]interface{}); isOk {
+			if b, isOk := r.([]interface{}); isOk {
+				result := make([]interface{}, 0, len(a))
+				for _, v := range a {
+					found := false
+					for _, w := range b {
+						if compareValues(v, w) == 0 {
+							found = true
+							break
+						}
+					}
+					if !found {
+						result = append(result, v)
+					}
+				}
+				return result, nil
+			}
+		}
+	case "*":
+		if a, isOk := l.(*orderedmap.OrderedMap); isOk {
+			if b, isOk := r.(*orderedmap.OrderedMap); isOk {
+				return deepMerge(a, b), nil
+			}
+		}
+		if isNumberX || isNumberY {
+			s, n := l, y
+			if isNumberX {
+				s, n = r, x
+			}
+			if s, isOk := s.(string); isOk {
+				if n <= 0 {
+					return nil, nil
+				}
+				if s == "" {
+					return s, nil
+				}
+				if float64(len(s))*n > maxRepeatSize {
+					return nil, newError("Repeat string result too long")
+				}
+				count := int(n)
+				if float64(count) < n {
+					count++
+				}
+				return strings.Repeat(s, count), nil
+			}
+		}
+	case "/":
+		if a, isOk := l.(string); isOk {
+			if b, isOk := r.(string); isOk {
+				return splitString(a, b), nil
+			}
+		}
+	}
+	verb := map[string]string{"-": "subtracted", "*": "multiplied", "/": "divided", "%": "divided"}[op]
+	return nil, newError("%s and %s cannot be %s", describe(l), describe(r), verb)
+}
+
+func add(l, r interface{}) (interface{}, error) {
+	if l == nil {
+		return r, nil
+	}
+	if r == nil {
+		return l, nil
+	}
+	if x, isOk := toNumber(l); isOk {
+		if y, isOk := toNumber(r); isOk {
+			return x + y, nil
+		}
+	}
+	switch a := l.(type) {
+	case string:
+		if b, isOk := r.(string); isOk {
+			return a + b, nil
+		}
+	case []interface{}:
+		if b, isOk := r.([]interface{}); isOk {
+			result := make([]interface{}, 0, len(a)+len(b))
+			return append(append(result, a...), b...), nil
+		}
+	case *orderedmap.OrderedMap:
+		if b, isOk := r.(*orderedmap.OrderedMap); isOk {
+			result := copyObject(a)
+			b.Foreach(result.Set)
+			return result, nil
+		}
+	}
+	return nil, newError("%s and %s cannot be added", describe(l), describe(r))
+}
+
+func deepMerge(a, b *orderedmap.OrderedMap) *orderedmap.OrderedMap {
+	result := copyObject(a)
+	b.Foreach(func(key string, value interface{}) {
+		x, isObjectX := result.GetOr(key).(*orderedmap.OrderedMap)
+		y, isObjectY := value.(*orderedmap.OrderedMap)
+		if isObjectX && isObjectY {
+			value = deepMerge(x, y)
+		}
+		result.Set(key, value)
+	})
+	return result
+}
+
+func splitString(s, separator string) interface{} {
+	result := make([]interface{}, 0)
+	if s == "" {
+		return result
+	}
+	for _, part := range strings.Split(s, separator) {
+		result = append(result, part)
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package jq
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/anthony-dong/jsonui/internal/orderedmap"
+)
+
+// formats are the @name string formats by name.
+var formats = map[string]func(v interface{}) (string, error){
+	"text": func(v interface{}) (string, error) {
+		return toText(v), nil
+	},
+	"json": func(v interface{}) (string, error) {
+		return Encode(v, 0), nil
+	},
+	"html": func(v interface{}) (string, error) {
+		return html.EscapeString(toText(v)), nil
+	},
+	"uri": func(v interface{}) (string, error) {
+		s := toText(v)
+		out := &strings.Builder{}
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if isIdentChar(c) || c == '-' || c == '.' || c == '~' {
+				out.WriteByte(c)
+			} else {
+				fmt.Fprintf(out, "%%%02X", c)
+			}
+		}
+		return out.String(), nil
+	},
+	"csv": func(v interface{}) (string, error) {
+		return formatRow(v, "csv", ",", func(s string) string {
+			return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+		})
+	},
+	"tsv": func(v interface{}) (string, error) {
+		return formatRow(v, "tsv", "\t", strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace)
+	},
+	"sh": func(v interface{}) (string, error) {
+		values, isArray := v.([]interface{})
+		if !isArray {
+			values = []interface{}{v}
+		}
+		words := make([]string, len(values))
+		for i, value := range values {
+			switch value := value.(type) {
+			case string:
+				words[i] = "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+			case []interface{}, *orderedmap.OrderedMap:
+				return "", newError("%s can not be escaped for shell", describe(value))
+			default:
+				words[i] = Encode(value, 0)
+			}
+		}
+		return strings.Join(words, " "), nil
+	},
+	"base64": func(v interface{}) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(toText(v))), nil
+	},
+	"base64d": func(v interface{}) (string, error) {
+		s := toText(v)
+		decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return "", newError("%s is not valid base64 data", describe(v))
+		}
+		return string(decoded), nil
+	},
+	"base32": func(v interface{}) (string, error) {
+		return base32.StdEncoding.EncodeToString([]byte(toText(v))), nil
+	},
+	"base32d": func(v interface{}) (string, error) {
+		s := toText(v)
+		decoded, err := base32.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", newError("%s is not valid base32 data", describe(v))
+		}
+		return string(decoded), nil
+	},
+}
+
+// toText returns a string as it is and the other values as JSON.
+func toText(v interface{}) string {
+	if s, isOk := v.(string); isOk {
+		return s
+	}
+	return Encode(v, 0)
+}
+
+// applyFormat formats a value with the format @name.
+func applyFormat(name string, v interface{}) (string, error) {
+	return formats[name](v)
+}
+
+// formatRow formats an array as a row of @csv or @tsv, strings are escaped
+// by quote.
+func formatRow(v interface{}, name, separator string, quote func(s string) string) (string, error) {
+	values, isOk := v.([]interface{})
+	if !isOk {
+		return "", newError("%s cannot be %s-formatted, only an array can be", describe(v), name)
+	}
+	fields := make([]string, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			fields[i] = quote(value)
+		case []interface{}, *orderedmap.OrderedMap:
+			return "", newError("%s is not valid in a csv row", describe(value))
+		default:
+			fields[i] = Encode(value, 0)
+		}
+	}
+	return strings.Join(fields, separator), nil
+}
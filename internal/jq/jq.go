@@ -0,0 +1,44 @@
+// Package jq evaluates queries of the jq language over JSON values. Most of
+// the language is supported: pipes, paths, assignments, reduce, foreach,
+// function definitions, string interpolation, formats and the common
+// builtins. Modules, labels, dates and streaming input are not.
+package jq
+
+import (
+	"context"
+)
+
+// Query is a compiled jq query, it can be run concurrently.
+type Query struct {
+	src  string
+	body expr
+}
+
+// Compile parses a jq query.
+func Compile(src string) (*Query, error) {
+	body, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{src: src, body: body}, nil
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// Run evaluates the query over input, calling fn with each result until
+// the query is done, fn returns an error or ctx is done.
+func (q *Query) Run(ctx context.Context, input interface{}, fn func(v interface{}) error) error {
+	e := &env{state: &runState{ctx: ctx}}
+	err := q.body.eval(e, valueItem(input), func(it item) error {
+		if err := fn(it.value); err != nil {
+			return &downstreamError{err: err}
+		}
+		return nil
+	})
+	if downstream, isOk := err.(*downstreamError); isOk {
+		return downstream.err
+	}
+	return err
+}
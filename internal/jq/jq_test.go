@@ -0,0 +1,178 @@
+package jq
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// run returns the results of a query over input, one JSON per line.
+func run(t *testing.T, query, input string) (string, error) {
+	q, err := Compile(query)
+	if err != nil {
+		t.Fatalf("failed to compile %s: %v", query, err)
+	}
+	v, err := Decode([]byte(input))
+	if err != nil {
+		t.Fatalf("invalid input %s: %v", input, err)
+	}
+	results := make([]string, 0)
+	err = q.Run(context.Background(), v, func(v interface{}) error {
+		results = append(results, Encode(v, 0))
+		return nil
+	})
+	return strings.Join(results, "\n"), err
+}
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		query, input, expected string
+	}{
+		{`.`, `{"b":1,"a":[1.50,2]}`, `{"b":1,"a":[1.50,2]}`},
+		{`.a, .b`, `{"a":1,"b":2}`, "1\n2"},
+		{`.a.b.c`, `{"a":{"b":{"c":"x"}}}`, `"x"`},
+		{`.["a"], ."a", .a?`, `{"a":1}`, "1\n1\n1"},
+		{`.[1:], .[-1], .[:-1]`, `[1,2,3]`, "[2,3]\n3\n[1,2]"},
+		{`.[2:4]`, `"abcdef"`, `"cd"`},
+		{`.[] | select(. > 1)`, `[1,2,3]`, "2\n3"},
+		{`[.[] | . * 2]`, `[1,2]`, `[2,4]`},
+		{`.x // "default"`, `{}`, `"default"`},
+		{`(1, null, 2) // 3`, `null`, "1\n2"},
+		{`[.[] | numbers]`, `[1,"a",null,2]`, `[1,2]`},
+		{`{a, "b": .c, (.d): 1, "x\(.a)": 2}`, `{"a":1,"c":2,"d":"e"}`, `{"a":1,"b":2,"e":1,"x1":2}`},
+		{`. as [$a, {b: $c}] | $a + $c`, `[1,{"b":2}]`, `3`},
+		{`. as {$a, b: [$c]} | [$a, $c]`, `{"a":1,"b":[2]}`, `[1,2]`},
+		{`reduce .[] as $x (0; . + $x)`, `[1,2,3]`, `6`},
+		{`[foreach .[] as $x (0; . + $x)]`, `[1,2,3]`, `[1,3,6]`},
+		{`[foreach .[] as $x (0; . + $x; [$x, .])]`, `[1,2]`, `[[1,1],[2,3]]`},
+		{`def f(x): x * 2; def g($y): $y + y; f(.) + g(1)`, `3`, `8`},
+		{`def fac: if . <= 1 then 1 else . * (. - 1 | fac) end; fac`, `5`, `120`},
+		{`if . == 1 then "a" elif . == 2 then "b" else "c" end`, `2`, `"b"`},
+		{`if . then "yes" end`, `false`, `false`},
+		{`try error("x") catch ., (.a)?`, `1`, `"x"`},
+		{`[.[] | try if . == 2 then error("two") else . end catch "caught"]`, `[1,2]`, `[1,"caught"]`},
+		{`"ab" * 2.5, "" * 1e300, "x" * 0`, `null`, "\"ababab\"\n\"\"\nnull"},
+		{`"a\(.x)b\(.y + 1)"`, `{"x":"1","y":2}`, `"a1b3"`},
+		// the interpolated numbers are formatted, not taken as the text
+		{`"a\(1)", "\(1)", @json "x\(1)\("y")", @json "x"`, `null`, "\"a1\"\n\"1\"\n\"x1\\\"y\\\"\"\n\"x\""},
+		{`@base64 "x\(.)", @base64d, @csv "\([1, "a\"b"])"`, `"aGk="`, "\"xYUdrPQ==\"\n\"hi\"\n\"1,\\\"a\\\"\\\"b\\\"\""},
+		{`[@text, @json, @html, @uri, @sh]`, `"<a b'>"`, `["<a b'>","\"<a b'>\"","&lt;a b&#39;&gt;","%3Ca%20b%27%3E","'<a b'\\''>'"]`},
+		{`[.[] | @tsv]`, `[["a\tb", 1, null]]`, `["a\\tb\t1\t"]`},
+		{`.a = 1 | .b.c |= 2 | .d += 1 | .a -= 3 | .e //= 4`, `{"d":1}`, `{"d":2,"a":-2,"b":{"c":2},"e":4}`},
+		{`.[] += 1, (.[1:] = ["x"])`, `[1,2,3]`, "[2,3,4]\n[1,\"x\"]"},
+		{`map_values(. + 1), with_entries(.value |= tostring)`, `{"a":1}`, "{\"a\":2}\n{\"a\":\"1\"}"},
+		{`del(.a, .b[0]), to_entries`, `{"a":1,"b":[1,2]}`, "{\"b\":[2]}\n[{\"key\":\"a\",\"value\":1},{\"key\":\"b\",\"value\":[1,2]}]"},
+		{`[paths], [leaf_paths], ([path(..)] | length)`, `{"a":[1]}`, "[[\"a\"],[\"a\",0]]\n[[\"a\",0]]\n3"},
+		{`getpath(["a","b"]), setpath(["a","b"]; 1), delpaths([["a"]])`, `{"a":{"b":0}}`, "0\n{\"a\":{\"b\":1}}\n{}"},
+		{`[.. | numbers]`, `[1,[2,{"a":3}]]`, `[1,2,3]`},
+		{`keys, keys_unsorted, length, has("b"), (.[] |= . + 1)`, `{"b":1,"a":2}`, "[\"a\",\"b\"]\n[\"b\",\"a\"]\n2\ntrue\n{\"b\":2,\"a\":3}"},
+		{`[length, utf8bytelength, ascii_downcase, ascii_upcase, explode, (explode | implode)]`, `"Aé"`, `[2,3,"aé","Aé",[65,233],"Aé"]`},
+		{`sort, sort_by(-.), group_by(. % 2), unique, min, max, add, any, all, reverse`, `[3,1,2,1]`,
+			"[1,1,2,3]\n[3,2,1,1]\n[[2],[3,1,1]]\n[1,2,3]\n1\n3\n7\ntrue\ntrue\n[1,2,1,3]"},
+		{`min_by(.a).b, max_by(.a).b, (unique_by(.a) | map(.b))`, `[{"a":1,"b":1},{"a":2,"b":2},{"a":1,"b":3}]`, "1\n2\n[1,2]"},
+		{`[limit(2; .[])], first(.[]), [range(3)], [range(1; 10; 4)], [.[] | tostring]`, `[1,"a",null]`,
+			"[1,\"a\"]\n1\n[0,1,2]\n[1,5,9]\n[\"1\",\"a\",\"null\"]"},
+		{`[splits(", *")], (split(",") | join("-")), test("B"; "i"), [match("\\w+"; "g").offset]`, `"a, b,c"`,
+			"[\"a\",\"b\",\"c\"]\n\"a- b-c\"\ntrue\n[0,3,5]"},
+		{`sub("(?<x>[a-z])"; "<\(.x)>"), gsub("[a-z]"; "_"), [scan("[a-z]")], capture("(?<first>\\w)")`, `"ab1"`,
+			"\"<a>b1\"\n\"__1\"\n[\"a\",\"b\"]\n{\"first\":\"a\"}"},
+		{`ltrimstr("a"), rtrimstr("c"), startswith("ab"), endswith("b"), index("b"), indices("b")`, `"abcb"`,
+			"\"bcb\"\n\"abcb\"\ntrue\ntrue\n1\n[1,3]"},
+		{`contains({a: [1]}), inside({a: [1, 2], b: 3, c: 4})`, `{"a":[1,2],"b":3}`, "true\ntrue"},
+		{`flatten, flatten(1), transpose?`, `[[1,[2]],[3]]`, "[1,2,3]\n[1,[2],3]\n[[1,3],[[2],null]]"},
+		{`tojson, (tojson | fromjson), tostream`, `{"a":[1]}`, "\"{\\\"a\\\":[1]}\"\n{\"a\":[1]}\n[[\"a\",0],1]\n[[\"a\",0]]\n[[\"a\"]]"},
+		{`1 + 2 * 3 - 4 / 2 % 3, -(1), "ab" * 2, {} * {a: {b: 1}}, [1, 2, 2] - [2], "a,b" / ","`, `null`,
+			"5\n-1\n\"abab\"\n{\"a\":{\"b\":1}}\n[1]\n[\"a\",\"b\"]"},
+		{`[.[] | floor, sqrt, round], (1e1000 | isinfinite), (nan | isnan), ([nan] | sort), pow(2; 10), (10 | log10)`, `[4.5]`,
+			"[4,2.1213203435596424,5]\ntrue\ntrue\n[null]\n1024\n1"},
+		{`. == 1, 1 < "a", [] < {}, {"a":1} == {"a":1.0}, (true and (1, null)), (false or false), (null | not)`, `1`,
+			"true\ntrue\ntrue\ntrue\ntrue\nfalse\nfalse\ntrue"},
+		{`[until(. > 100; . * 2)], [while(. < 8; . * 2)], [limit(3; repeat(. + 1))], [recurse(if . < 3 then . + 1 else empty end)]`, `1`,
+			"[128]\n[1,2,4]\n[1,2,3]\n[1,2,3]"},
+		{`isempty(empty), [.[] | values], (.[0] | type), walk(if type == "number" then . + 1 else . end), pick(.[1])`, `[null,1]`,
+			"true\n[1]\n\"null\"\n[null,2]\n[null,1]"},
+		{`[combinations], any(.[]; length > 1), all(.[]; length > 1), nth(1; .[][]), (0 | in([5]))`, `[[1,2],[3]]`,
+			"[[1,3],[2,3]]\ntrue\nfalse\n2\ntrue"},
+		{`from_entries, ([{name: "a", v: 1}] | from_entries)`, `[{"k":"x","value":1},{"key":1,"value":2}]`, "{\"x\":1,\"1\":2}\n{\"a\":1}"},
+		{"# comment\n.a # another", `{"a":1}`, `1`},
+		{`.a?//2, (.[]?), .x.y`, `null`, "2\nnull"},
+		{`[.[] | {a: .b | . + 1}]`, `[{"b":1}]`, `[{"a":2}]`},
+	} {
+		result, err := run(t, c.query, c.input)
+		if err != nil {
+			t.Fatalf("failed to run %s: %v", c.query, err)
+		}
+		if result != c.expected {
+			t.Fatalf("unexpected results of %s:\n%s\nexpected:\n%s", c.query, result, c.expected)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, c := range []struct {
+		query, input, expected string
+	}{
+		{`.a`, `1`, `Cannot index number with "a"`},
+		{`.[]`, `true`, `Cannot iterate over boolean (true)`},
+		{`. + 1`, `"a"`, `string ("a") and number (1) cannot be added`},
+		{`error({a: 1})`, `null`, `{"a":1} (not a string)`},
+		{`path(1)`, `null`, `Invalid path expression with result number (1)`},
+		{`unknown(1)`, `null`, `unknown/1 is not defined`},
+		{`$x`, `null`, `$x is not defined`},
+		{`{(1): 2}`, `null`, `Object keys must be strings`},
+		{`test("(")`, `"a"`, `( (at offset 0) is not a valid regex`},
+		// endless recursions fail instead of overflowing the stack
+		{`def f: f; f`, `null`, errCallDepth.Error()},
+		{`def f: [f]; f`, `null`, errCallDepth.Error()},
+		{`def f: try f catch 1; f`, `null`, errCallDepth.Error()},
+		{`0 | until(. < 0; . + 1)`, `null`, errCallDepth.Error()},
+		// values which would take all the memory fail
+		{`"x" * 1e10`, `null`, `Repeat string result too long`},
+		{`"x" * 1e300`, `null`, `Repeat string result too long`},
+		{`setpath([1e9]; 1)`, `null`, `Array index too large`},
+		{`.[1e9] = 1`, `[]`, `Array index too large`},
+		{`.[-1e300] = 1`, `[]`, `Out of bounds negative array index`},
+	} {
+		_, err := run(t, c.query, c.input)
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Fatalf("expected %s to fail with %q, got %v", c.query, c.expected, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for query, expected := range map[string]string{
+		`.a |`:                 "expected a value, got the end of the query at offset 4",
+		`[1, 2`:                `expected ], got the end of the query at offset 5`,
+		`{a: 1 b}`:             `expected ,, got "b" at offset 6`,
+		`"abc`:                 "unterminated string at offset 0",
+		`.a)`:                  `unexpected ")" at offset 2`,
+		`if . then 1`:          "expected end, got the end of the query at offset 11",
+		`@unknown`:             "@unknown is not a valid format at offset 0",
+		`. as [$a] ?// $a | 1`: "destructuring alternatives are not supported at offset 10",
+		`label $out | 1`:       "label is not supported at offset 0",
+	} {
+		_, err := Compile(query)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("expected compiling %s to fail with %q, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	q, err := Compile(`repeat(.)`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err = q.Run(ctx, nil, func(v interface{}) error {
+		if count++; count == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected the query to be cancelled, got %v", err)
+	}
+}
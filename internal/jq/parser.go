@@ -0,0 +1,972 @@
+package jq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenPunct            // operators and brackets
+	tokenIdent            // names and keywords
+	tokenField            // .name
+	tokenVar              // $name
+	tokenFormat           // @name
+	tokenNumber           // 1, 1.5, 1e3
+	tokenString           // the opening quote of a string
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// puncts are the operators, the longest first so that they are preferred.
+var puncts = []string{
+	"?//=", "?//", "//=", "|=", "+=", "-=", "*=", "/=", "%=", "==", "!=", "<=", ">=", "//", "..",
+	".", "[", "]", "{", "}", "(", ")", "|", ",", ":", ";", "=", "<", ">", "+", "-", "*", "/", "%", "?",
+}
+
+var keywords = map[string]bool{
+	"def": true, "if": true, "then": true, "elif": true, "else": true, "end": true, "as": true,
+	"reduce": true, "foreach": true, "try": true, "catch": true, "label": true, "import": true,
+	"include": true, "and": true, "or": true, "__loc__": true,
+}
+
+// parser is a recursive descent parser of the jq language, tokens are read
+// from the source as they are needed.
+type parser struct {
+	src string
+	pos int
+	// postfixes are the terms parsed by position, a pipe tries to parse a
+	// term followed by as before parsing it again as an operand
+	postfixes map[int]parsedTerm
+}
+
+type parsedTerm struct {
+	x   expr
+	end int
+	err error
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at offset %d", append(args, pos)...)
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// identEnd returns the end of the name starting at i, names may contain ::
+// like in jq.
+func (p *parser) identEnd(i int) int {
+	for i < len(p.src) {
+		if isIdentChar(p.src[i]) {
+			i++
+		} else if strings.HasPrefix(p.src[i:], "::") && i+2 < len(p.src) && isIdentStart(p.src[i+2]) {
+			i += 2
+		} else {
+			break
+		}
+	}
+	return i
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	p.skipSpaces()
+	start := p.pos
+	if start == len(p.src) {
+		return token{kind: tokenEOF, pos: start}
+	}
+	c := p.src[start]
+	switch {
+	case c == '"':
+		return token{kind: tokenString, text: `"`, pos: start}
+	case c == '.' && start+1 < len(p.src) && isIdentStart(p.src[start+1]):
+		end := p.identEnd(start + 1)
+		return token{kind: tokenField, text: p.src[start+1 : end], pos: start}
+	case (c == '$' || c == '@') && start+1 < len(p.src) && isIdentStart(p.src[start+1]):
+		kind := tokenVar
+		if c == '@' {
+			kind = tokenFormat
+		}
+		return token{kind: kind, text: p.src[start:p.identEnd(start+1)], pos: start}
+	case isIdentStart(c):
+		return token{kind: tokenIdent, text: p.src[start:p.identEnd(start)], pos: start}
+	case isDigit(c) || c == '.' && start+1 < len(p.src) && isDigit(p.src[start+1]):
+		end := start
+		for end < len(p.src) && (isDigit(p.src[end]) || p.src[end] == '.') {
+			end++
+		}
+		if end < len(p.src) && (p.src[end] == 'e' || p.src[end] == 'E') {
+			exponent := end + 1
+			if exponent < len(p.src) && (p.src[exponent] == '+' || p.src[exponent] == '-') {
+				exponent++
+			}
+			if exponent < len(p.src) && isDigit(p.src[exponent]) {
+				for end = exponent; end < len(p.src) && isDigit(p.src[end]); end++ {
+				}
+			}
+		}
+		return token{kind: tokenNumber, text: p.src[start:end], pos: start}
+	}
+	for _, punct := range puncts {
+		if strings.HasPrefix(p.src[start:], punct) {
+			return token{kind: tokenPunct, text: punct, pos: start}
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(p.src[start:])
+	return token{kind: tokenPunct, text: string(r), pos: start}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos = t.pos + len(t.text)
+	if t.kind == tokenField {
+		p.pos++ // .
+	}
+	return t
+}
+
+// accept consumes the next token if it is the punctuation or keyword text.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenPunct || t.kind == tokenIdent) && t.text == text {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected("expected " + text)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(message string) error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return p.errorf(t.pos, "%s, got the end of the query", message)
+	}
+	return p.errorf(t.pos, "%s, got %q", message, t.text)
+}
+
+func parse(src string) (expr, error) {
+	p := &parser{src: src}
+	x, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t.pos, "unexpected %q", t.text)
+	}
+	return x, nil
+}
+
+// parsePipe parses definitions, bindings and pipes, which have the lowest
+// precedence. The values of objects are parsed without comma.
+func (p *parser) parsePipe(withComma bool) (expr, error) {
+	if p.accept("def") {
+		def, err := p.parseDef()
+		if err != nil {
+			return nil, err
+		}
+		rest, err := p.parsePipe(withComma)
+		if err != nil {
+			return nil, err
+		}
+		return defineExpr{def: def, rest: rest}, nil
+	}
+	if t := p.peek(); t.kind == tokenIdent && (t.text == "label" || t.text == "import" || t.text == "include") {
+		return nil, p.errorf(t.pos, "%s is not supported", t.text)
+	}
+	// term as $x | body
+	start := p.pos
+	if term, err := p.parsePostfix(); err == nil && p.accept("as") {
+		pattern, err := p.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.text == "?//" {
+			return nil, p.errorf(t.pos, "destructuring alternatives are not supported")
+		}
+		if err := p.expect("|"); err != nil {
+			return nil, err
+		}
+		body, err := p.parsePipe(withComma)
+		if err != nil {
+			return nil, err
+		}
+		return bindExpr{source: term, pattern: pattern, body: body}, nil
+	}
+	p.pos = start
+	left, err := p.parseComma(withComma)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("|") {
+		return left, nil
+	}
+	right, err := p.parsePipe(withComma)
+	if err != nil {
+		return nil, err
+	}
+	return pipe{left: left, right: right}, nil
+}
+
+// parseDef parses name(params): body; after def.
+func (p *parser) parseDef() (*funcDef, error) {
+	t := p.next()
+	if t.kind != tokenIdent || keywords[t.text] {
+		p.pos = t.pos
+		return nil, p.unexpected("expected the name of a function")
+	}
+	def := &funcDef{name: t.text}
+	if p.accept("(") {
+		for {
+			param := p.next()
+			if param.kind != tokenIdent && param.kind != tokenVar || keywords[param.text] {
+				p.pos = param.pos
+				return nil, p.unexpected("expected a parameter")
+			}
+			def.params = append(def.params, param.text)
+			if !p.accept(";") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	body, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	def.body = body
+	return def, p.expect(";")
+}
+
+func (p *parser) parseComma(withComma bool) (expr, error) {
+	left, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	for withComma && p.accept(",") {
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		left = comma{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAlternative() (expr, error) {
+	left, err := p.parseAssign()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("//") {
+		return left, nil
+	}
+	right, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	return alternative{left: left, right: right}, nil
+}
+
+var assignOps = map[string]bool{"=": true, "|=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "//=": true}
+
+func (p *parser) parseAssign() (expr, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenPunct || !assignOps[t.text] {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	return assignExpr{op: t.text, lhs: left, rhs: right}, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseArithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenPunct || !comparisonOps[t.text] {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseArithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	return binary{op: t.text, left: left, right: right}, nil
+}
+
+// arithmeticOps are the left associative operators by precedence.
+var arithmeticOps = [][]string{{"+", "-"}, {"*", "/", "%"}}
+
+func (p *parser) parseArithmetic(level int) (expr, error) {
+	if level == len(arithmeticOps) {
+		return p.parseUnary()
+	}
+	left, err := p.parseArithmetic(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenPunct || !containsString(arithmeticOps[level], t.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseArithmetic(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: t.text, left: left, right: right}
+	}
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix parses a term followed by indexes, iterations and ?.
+func (p *parser) parsePostfix() (expr, error) {
+	p.skipSpaces()
+	start := p.pos
+	if parsed, isOk := p.postfixes[start]; isOk {
+		p.pos = parsed.end
+		return parsed.x, parsed.err
+	}
+	x, err := p.parseSuffixes()
+	if p.postfixes == nil {
+		p.postfixes = make(map[int]parsedTerm)
+	}
+	p.postfixes[start] = parsedTerm{x: x, end: p.pos, err: err}
+	return x, err
+}
+
+func (p *parser) parseSuffixes() (expr, error) {
+	term, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenField:
+			p.next()
+			term = indexExpr{term: term, key: literal{value: t.text}}
+		case t.kind == tokenPunct && t.text == ".":
+			p.next()
+			if p.peek().kind == tokenString {
+				key, err := p.parseString("")
+				if err != nil {
+					return nil, err
+				}
+				term = indexExpr{term: term, key: key}
+			} else if p.peek().text != "[" {
+				return nil, p.unexpected("expected a key or [")
+			}
+		case t.kind == tokenPunct && t.text == "[":
+			p.next()
+			if term, err = p.parseBrackets(term); err != nil {
+				return nil, err
+			}
+		case t.kind == tokenPunct && strings.HasPrefix(t.text, "?"):
+			// .a?//b is .a? // b
+			p.pos = t.pos + 1
+			term = tryExpr{body: term}
+		default:
+			return term, nil
+		}
+	}
+}
+
+// parseBrackets parses [], [key], [start:end] after the [.
+func (p *parser) parseBrackets(term expr) (expr, error) {
+	if p.accept("]") {
+		return iterate{term: term}, nil
+	}
+	if p.accept(":") {
+		end, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		return sliceExpr{term: term, end: end}, p.expect("]")
+	}
+	key, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.accept(":") {
+		if p.accept("]") {
+			return sliceExpr{term: term, start: key}, nil
+		}
+		end, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		return sliceExpr{term: term, start: key, end: end}, p.expect("]")
+	}
+	return indexExpr{term: term, key: key}, p.expect("]")
+}
+
+func (p *parser) parseTerm() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenEOF:
+		return nil, p.unexpected("expected a value")
+	case tokenField:
+		p.next()
+		return indexExpr{term: identity{}, key: literal{value: t.text}}, nil
+	case tokenNumber:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if numError, isOk := err.(*strconv.NumError); isOk && numError.Err == strconv.ErrRange {
+			// out of range numbers are infinite
+			err = nil
+		}
+		if err != nil {
+			return nil, p.errorf(t.pos, "invalid number %s", t.text)
+		}
+		return literal{value: f}, nil
+	case tokenString:
+		return p.parseString("")
+	case tokenFormat:
+		p.next()
+		format := t.text[1:]
+		if _, isOk := formats[format]; !isOk {
+			return nil, p.errorf(t.pos, "%s is not a valid format", t.text)
+		}
+		if p.peek().kind == tokenString {
+			return p.parseString(format)
+		}
+		return formatExpr{format: format}, nil
+	case tokenVar:
+		p.next()
+		return varRef{name: t.text}, nil
+	case tokenIdent:
+		return p.parseKeywordOrCall()
+	}
+	switch t.text {
+	case ".":
+		p.next()
+		if p.peek().kind == tokenString {
+			key, err := p.parseString("")
+			if err != nil {
+				return nil, err
+			}
+			return indexExpr{term: identity{}, key: key}, nil
+		}
+		return identity{}, nil
+	case "..":
+		p.next()
+		return funcCall{name: "recurse"}, nil
+	case "(":
+		p.next()
+		x, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case "[":
+		p.next()
+		if p.accept("]") {
+			return arrayExpr{}, nil
+		}
+		body, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		return arrayExpr{body: body}, p.expect("]")
+	case "{":
+		p.next()
+		return p.parseObject()
+	}
+	return nil, p.unexpected("expected a value")
+}
+
+func (p *parser) parseKeywordOrCall() (expr, error) {
+	t := p.next()
+	switch t.text {
+	case "if":
+		return p.parseIf()
+	case "try":
+		body, err := p.parsePostfixOrUnary()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept("catch") {
+			return tryExpr{body: body}, nil
+		}
+		handler, err := p.parsePostfixOrUnary()
+		if err != nil {
+			return nil, err
+		}
+		return tryExpr{body: body, handler: handler}, nil
+	case "reduce", "foreach":
+		return p.parseReduce(t.text)
+	case "def":
+		def, err := p.parseDef()
+		if err != nil {
+			return nil, err
+		}
+		rest, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		return defineExpr{def: def, rest: rest}, nil
+	case "__loc__":
+		return nil, p.errorf(t.pos, "$__loc__ is not supported")
+	}
+	if keywords[t.text] {
+		p.pos = t.pos
+		return nil, p.unexpected("expected a value")
+	}
+	switch t.text {
+	case "null":
+		return literal{value: nil}, nil
+	case "true":
+		return literal{value: true}, nil
+	case "false":
+		return literal{value: false}, nil
+	}
+	call := funcCall{name: t.text}
+	if p.accept("(") {
+		for {
+			arg, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.accept(";") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return call, nil
+}
+
+// parsePostfixOrUnary parses the body of try and catch, which is a term.
+func (p *parser) parsePostfixOrUnary() (expr, error) {
+	if p.peek().text == "-" {
+		return p.parseUnary()
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parseIf() (expr, error) {
+	cond, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe(true)
+	if err != nil {
+		return nil, err
+	}
+	x := ifExpr{cond: cond, then: then}
+	switch {
+	case p.accept("elif"):
+		if x.otherwise, err = p.parseIf(); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case p.accept("else"):
+		if x.otherwise, err = p.parsePipe(true); err != nil {
+			return nil, err
+		}
+	}
+	return x, p.expect("end")
+}
+
+// parseReduce parses source as $x (init; update) after reduce, and source as
+// $x (init; update; extract) after foreach.
+func (p *parser) parseReduce(keyword string) (expr, error) {
+	source, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("as"); err != nil {
+		return nil, err
+	}
+	pattern, err := p.parsePattern()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []expr
+	for {
+		arg, err := p.parsePipe(true)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.accept(";") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if keyword == "reduce" {
+		if len(args) != 2 {
+			return nil, p.errorf(p.pos, "reduce takes an initial value and an update")
+		}
+		return reduceExpr{source: source, pattern: pattern, init: args[0], update: args[1]}, nil
+	}
+	if len(args) != 2 && len(args) != 3 {
+		return nil, p.errorf(p.pos, "foreach takes an initial value, an update and an optional extraction")
+	}
+	x := foreachExpr{source: source, pattern: pattern, init: args[0], update: args[1]}
+	if len(args) == 3 {
+		x.extract = args[2]
+	}
+	return x, nil
+}
+
+// parseObject parses the entries of an object after the {.
+func (p *parser) parseObject() (expr, error) {
+	var x objectExpr
+	if p.accept("}") {
+		return x, nil
+	}
+	for {
+		var entry objectEntry
+		t := p.peek()
+		switch {
+		case t.kind == tokenVar:
+			// {$x} is {x: $x}
+			p.next()
+			entry = objectEntry{key: literal{value: t.text[1:]}, value: varRef{name: t.text}}
+		case t.kind == tokenIdent:
+			p.next()
+			entry = objectEntry{key: literal{value: t.text}, value: indexExpr{term: identity{}, key: literal{value: t.text}}}
+		case t.kind == tokenString:
+			key, err := p.parseString("")
+			if err != nil {
+				return nil, err
+			}
+			entry = objectEntry{key: key, value: indexExpr{term: identity{}, key: key}}
+		case t.text == "(":
+			p.next()
+			key, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			entry = objectEntry{key: key}
+		default:
+			return nil, p.unexpected("expected a key")
+		}
+		if p.accept(":") {
+			value, err := p.parsePipe(false)
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if entry.value == nil {
+			return nil, p.unexpected("expected :")
+		}
+		x.entries = append(x.entries, entry)
+		if p.accept("}") {
+			return x, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parsePattern parses $x, [$x, $y] or {a: $x, $y} after as.
+func (p *parser) parsePattern() (*pattern, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenVar:
+		return &pattern{name: t.text}, nil
+	case t.text == "[":
+		result := &pattern{array: []*pattern{}}
+		for {
+			element, err := p.parsePattern()
+			if err != nil {
+				return nil, err
+			}
+			result.array = append(result.array, element)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return result, p.expect("]")
+	case t.text == "{":
+		result := &pattern{object: []objectPattern{}}
+		for {
+			entry, err := p.parseObjectPattern()
+			if err != nil {
+				return nil, err
+			}
+			result.object = append(result.object, entry)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return result, p.expect("}")
+	}
+	p.pos = t.pos
+	return nil, p.unexpected("expected a pattern")
+}
+
+func (p *parser) parseObjectPattern() (objectPattern, error) {
+	var entry objectPattern
+	t := p.peek()
+	switch {
+	case t.kind == tokenVar:
+		p.next()
+		entry.name = t.text
+		entry.key = literal{value: t.text[1:]}
+		if !p.accept(":") {
+			return entry, nil
+		}
+		value, err := p.parsePattern()
+		entry.value = value
+		return entry, err
+	case t.kind == tokenIdent:
+		p.next()
+		entry.key = literal{value: t.text}
+	case t.kind == tokenString:
+		key, err := p.parseString("")
+		if err != nil {
+			return entry, err
+		}
+		entry.key = key
+	case t.text == "(":
+		p.next()
+		key, err := p.parsePipe(true)
+		if err != nil {
+			return entry, err
+		}
+		if err := p.expect(")"); err != nil {
+			return entry, err
+		}
+		entry.key = key
+	default:
+		return entry, p.unexpected("expected a key")
+	}
+	if err := p.expect(":"); err != nil {
+		return entry, err
+	}
+	value, err := p.parsePattern()
+	entry.value = value
+	return entry, err
+}
+
+// parseString parses a string literal with its interpolations, which are
+// formatted by format.
+func (p *parser) parseString(format string) (expr, error) {
+	p.skipSpaces()
+	start := p.pos
+	p.pos++ // "
+	var parts []stringPart
+	text := &strings.Builder{}
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, stringPart{text: text.String()})
+			text.Reset()
+		}
+	}
+	for {
+		if p.pos >= len(p.src) {
+			return nil, p.errorf(start, "unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			text.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			return nil, p.errorf(start, "unterminated string")
+		}
+		escape := p.src[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			text.WriteByte(escape)
+		case 'b':
+			text.WriteByte('\b')
+		case 'f':
+			text.WriteByte('\f')
+		case 'n':
+			text.WriteByte('\n')
+		case 'r':
+			text.WriteByte('\r')
+		case 't':
+			text.WriteByte('\t')
+		case 'u':
+			r, err := p.parseUnicodeEscape()
+			if err != nil {
+				return nil, err
+			}
+			text.WriteRune(r)
+		case '(':
+			flush()
+			x, err := p.parsePipe(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			parts = append(parts, stringPart{x: x})
+		default:
+			return nil, p.errorf(p.pos-2, "invalid escape \\%c", escape)
+		}
+	}
+	flush()
+	if len(parts) == 0 {
+		return literal{value: ""}, nil
+	}
+	if len(parts) == 1 && parts[0].x == nil {
+		return literal{value: parts[0].text}, nil
+	}
+	if format == "" {
+		format = "text"
+	}
+	return stringExpr{parts: parts, format: format}, nil
+}
+
+// parseUnicodeEscape parses the digits of \uXXXX, and of the low surrogate
+// following a high one.
+func (p *parser) parseUnicodeEscape() (rune, error) {
+	hex := func() (rune, error) {
+		if p.pos+4 > len(p.src) {
+			return 0, p.errorf(p.pos, "invalid \\u escape")
+		}
+		n, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 16)
+		if err != nil {
+			return 0, p.errorf(p.pos, "invalid \\u escape")
+		}
+		p.pos += 4
+		return rune(n), nil
+	}
+	r, err := hex()
+	if err != nil || !utf16.IsSurrogate(r) {
+		return r, err
+	}
+	if !strings.HasPrefix(p.src[p.pos:], `\u`) {
+		return utf8.RuneError, nil
+	}
+	p.pos += 2
+	low, err := hex()
+	if err != nil {
+		return 0, err
+	}
+	return utf16.DecodeRune(r, low), nil
+}
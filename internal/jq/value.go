@@ -0,0 +1,660 @@
+package jq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthony-dong/jsonui/internal/orderedmap"
+)
+
+// The values are nil, bool, float64 or json.Number, string, []interface{} and
+// *orderedmap.OrderedMap. Numbers decoded from the input are json.Number so
+// that they are written back as they were, the results of arithmetic are
+// float64. Values are never modified once built: updating one copies it.
+
+// Decode decodes a JSON value, the objects keep the order of their keys.
+func Decode(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	v, err := decodeValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		object := orderedmap.New()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.Set(key.(string), value)
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := make([]interface{}, 0)
+		for decoder.More() {
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+// Encode encodes a value as JSON like jq does, indented by indent spaces per
+// level, or on a single line without spaces if indent is 0.
+func Encode(v interface{}, indent int) string {
+	out := &strings.Builder{}
+	encodeValue(out, v, indent, 0)
+	return out.String()
+}
+
+func encodeValue(out *strings.Builder, v interface{}, indent, depth int) {
+	newline := func(depth int) {
+		if indent > 0 {
+			out.WriteByte('\n')
+			out.WriteString(strings.Repeat(" ", indent*depth))
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		out.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		out.WriteString(string(v))
+	case float64:
+		out.WriteString(formatNumber(v))
+	case string:
+		encodeString(out, v)
+	case []interface{}:
+		if len(v) == 0 {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			encodeValue(out, element, indent, depth+1)
+		}
+		newline(depth)
+		out.WriteByte(']')
+	case *orderedmap.OrderedMap:
+		if v.Size() == 0 {
+			out.WriteString("{}")
+			return
+		}
+		out.WriteByte('{')
+		for i, key := range v.Keys() {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(depth + 1)
+			encodeString(out, key)
+			out.WriteByte(':')
+			if indent > 0 {
+				out.WriteByte(' ')
+			}
+			encodeValue(out, v.GetOr(key), indent, depth+1)
+		}
+		newline(depth)
+		out.WriteByte('}')
+	default:
+		out.WriteString(fmt.Sprintf("%q", fmt.Sprint(v)))
+	}
+}
+
+func encodeString(out *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+	out.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				out.WriteByte('\\')
+				out.WriteByte(c)
+			case c == '\n':
+				out.WriteString(`\n`)
+			case c == '\t':
+				out.WriteString(`\t`)
+			case c == '\r':
+				out.WriteString(`\r`)
+			case c < 0x20 || c == 0x7f:
+				out.WriteString(`\u00`)
+				out.WriteByte(hex[c>>4])
+				out.WriteByte(hex[c&0xf])
+			default:
+				out.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			out.WriteString(`�`)
+		} else {
+			out.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	out.WriteByte('"')
+}
+
+// formatNumber writes integers without a fraction and the other numbers with
+// as few digits as identify them, like jq.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "null"
+	case math.IsInf(f, 1):
+		return "1.7976931348623157e+308"
+	case math.IsInf(f, -1):
+		return "-1.7976931348623157e+308"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// typeOf returns the name of the type of a value.
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case *orderedmap.OrderedMap:
+		return "object"
+	}
+	return "unknown"
+}
+
+// toNumber returns the value of a number.
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			// out of range
+			return f, true
+		}
+		return f, true
+	}
+	return 0, false
+}
+
+// toInt returns the value of a number truncated to an int.
+func toInt(v interface{}) (int, bool) {
+	f, isOk := toNumber(v)
+	if !isOk {
+		return 0, false
+	}
+	if f >= math.MaxInt32 {
+		return math.MaxInt32, true
+	}
+	if f <= math.MinInt32 {
+		return math.MinInt32, true
+	}
+	return int(f), true
+}
+
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// typeOrder is the order of the types when values of different types are
+// compared.
+func typeOrder(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case float64, json.Number:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+// compareValues orders values like jq: null < false < true < numbers <
+// strings < arrays < objects. Objects are compared by their sorted keys and
+// then by their values.
+func compareValues(a, b interface{}) int {
+	orderA, orderB := typeOrder(a), typeOrder(b)
+	if orderA != orderB {
+		return compareInts(orderA, orderB)
+	}
+	switch a := a.(type) {
+	case float64, json.Number:
+		x, _ := toNumber(a)
+		y, _ := toNumber(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if c := compareValues(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(a), len(b))
+	case *orderedmap.OrderedMap:
+		b := b.(*orderedmap.OrderedMap)
+		keysA, keysB := sortedKeys(a), sortedKeys(b)
+		if c := compareValues(stringsToValues(keysA), stringsToValues(keysB)); c != 0 {
+			return c
+		}
+		for _, key := range keysA {
+			if c := compareValues(a.GetOr(key), b.GetOr(key)); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(o *orderedmap.OrderedMap) []string {
+	keys := append([]string(nil), o.Keys()...)
+	sort.Strings(keys)
+	return keys
+}
+
+func stringsToValues(strs []string) []interface{} {
+	values := make([]interface{}, len(strs))
+	for i, s := range strs {
+		values[i] = s
+	}
+	return values
+}
+
+// copyObject returns a copy of an object which can be modified.
+func copyObject(o *orderedmap.OrderedMap) *orderedmap.OrderedMap {
+	result := orderedmap.NewWithSize(o.Size())
+	o.Foreach(result.Set)
+	return result
+}
+
+// describe returns a value for the error messages, cut if it is long.
+func describe(v interface{}) string {
+	text := Encode(v, 0)
+	if len(text) > 11 {
+		end := 10
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		text = text[:end] + "..."
+	}
+	return typeOf(v) + " (" + text + ")"
+}
+
+// index returns the value of an object at a key, of an array at an index, or
+// the slice of an array or a string described by an object with start and
+// end, like .[key].
+func index(v, key interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		switch key.(type) {
+		case string, float64, json.Number, *orderedmap.OrderedMap, nil:
+			return nil, nil
+		}
+	case *orderedmap.OrderedMap:
+		if key, isOk := key.(string); isOk {
+			return v.GetOr(key), nil
+		}
+	case []interface{}:
+		switch k := key.(type) {
+		case float64, json.Number:
+			f, _ := toNumber(k)
+			i := int(math.Floor(f))
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return nil, nil
+			}
+			return v[i], nil
+		case *orderedmap.OrderedMap:
+			start, end, err := sliceBounds(k, len(v))
+			if err != nil {
+				return nil, err
+			}
+			return v[start:end:end], nil
+		case []interface{}:
+			return indices(v, k), nil
+		}
+	case string:
+		if k, isOk := key.(*orderedmap.OrderedMap); isOk {
+			runes := []rune(v)
+			start, end, err := sliceBounds(k, len(runes))
+			if err != nil {
+				return nil, err
+			}
+			return string(runes[start:end]), nil
+		}
+	}
+	return nil, newError("Cannot index %s with %s", typeOf(v), describeKey(key))
+}
+
+func describeKey(key interface{}) string {
+	if s, isOk := key.(string); isOk {
+		return strconv.Quote(s)
+	}
+	return typeOf(key)
+}
+
+// sliceBounds returns the bounds of a slice of a value of the given length
+// described by an object with start and end, either of which may be null.
+func sliceBounds(slice *orderedmap.OrderedMap, length int) (int, int, error) {
+	bound := func(key string, defaultValue int) (int, error) {
+		v := slice.GetOr(key)
+		if v == nil {
+			return defaultValue, nil
+		}
+		f, isOk := toNumber(v)
+		if !isOk {
+			return 0, newError("Start and end indices of an array slice must be numbers")
+		}
+		i := int(math.Floor(f))
+		if key == "end" {
+			i = int(math.Ceil(f))
+		}
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0, nil
+		}
+		if i > length {
+			return length, nil
+		}
+		return i, nil
+	}
+	start, err := bound("start", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := bound("end", length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		end = start
+	}
+	return start, end, nil
+}
+
+// indices returns the indices at which sub occurs in v.
+func indices(v, sub []interface{}) interface{} {
+	result := make([]interface{}, 0)
+	if len(sub) == 0 {
+		return nil
+	}
+	for i := 0; i+len(sub) <= len(v); i++ {
+		found := true
+		for j := range sub {
+			if compareValues(v[i+j], sub[j]) != 0 {
+				found = false
+				break
+			}
+		}
+		if found {
+			result = append(result, float64(i))
+		}
+	}
+	return result
+}
+
+// getPath returns the value at a path, null if there is none.
+func getPath(v interface{}, path []interface{}) (interface{}, error) {
+	for _, key := range path {
+		if v == nil {
+			return nil, nil
+		}
+		var err error
+		if v, err = index(v, key); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// maxArrayIndex is the largest index an array can be grown to by setting it,
+// a larger one would take all the memory rather than fail.
+const maxArrayIndex = 1<<24 - 1
+
+// setPath returns a copy of v with the value at path replaced, the missing
+// objects and arrays along the path are created.
+func setPath(v interface{}, path []interface{}, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch key := path[0].(type) {
+	case string:
+		var object *orderedmap.OrderedMap
+		switch v := v.(type) {
+		case nil:
+			object = orderedmap.New()
+		case *orderedmap.OrderedMap:
+			object = copyObject(v)
+		default:
+			return nil, newError("Cannot index %s with %s", typeOf(v), describeKey(key))
+		}
+		child, err := setPath(object.GetOr(key), path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		object.Set(key, child)
+		return object, nil
+	case float64, json.Number:
+		var array []interface{}
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			array = v
+		default:
+			return nil, newError("Cannot index %s with number", typeOf(v))
+		}
+		f, _ := toNumber(key)
+		if f > maxArrayIndex {
+			return nil, newError("Array index too large")
+		}
+		if f < -maxArrayIndex {
+			return nil, newError("Out of bounds negative array index")
+		}
+		i := int(f)
+		if i < 0 {
+			if i += len(array); i < 0 {
+				return nil, newError("Out of bounds negative array index")
+			}
+		}
+		size := len(array)
+		if i >= size {
+			size = i + 1
+		}
+		result := make([]interface{}, size)
+		copy(result, array)
+		child, err := setPath(result[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = child
+		return result, nil
+	case *orderedmap.OrderedMap:
+		var array []interface{}
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			array = v
+		default:
+			return nil, newError("Cannot update field at object index of %s", typeOf(v))
+		}
+		start, end, err := sliceBounds(key, len(array))
+		if err != nil {
+			return nil, err
+		}
+		slice, err := setPath(array[start:end:end], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		replacement, isOk := slice.([]interface{})
+		if !isOk {
+			return nil, newError("A slice of an array can only be assigned another array")
+		}
+		result := make([]interface{}, 0, len(array)-(end-start)+len(replacement))
+		result = append(result, array[:start]...)
+		result = append(result, replacement...)
+		return append(result, array[end:]...), nil
+	}
+	return nil, newError("Invalid path component %s", describe(path[0]))
+}
+
+// deletePaths returns a copy of v without the values at paths.
+func deletePaths(v interface{}, paths []interface{}) (interface{}, error) {
+	sorted := append([]interface{}(nil), paths...)
+	// delete the last elements of arrays first so that the indices of the
+	// others stay valid
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareValues(sorted[i], sorted[j]) > 0
+	})
+	for _, path := range sorted {
+		p, isOk := path.([]interface{})
+		if !isOk {
+			return nil, newError("Path must be specified as an array")
+		}
+		var err error
+		if v, err = deletePath(v, p); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func deletePath(v interface{}, path []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if len(path) > 1 {
+		child, err := index(v, path[0])
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return v, nil
+		}
+		if child, err = deletePath(child, path[1:]); err != nil {
+			return nil, err
+		}
+		return setPath(v, path[:1], child)
+	}
+	switch key := path[0].(type) {
+	case string:
+		object, isOk := v.(*orderedmap.OrderedMap)
+		if !isOk {
+			return nil, newError("Cannot delete field at object index of %s", typeOf(v))
+		}
+		object = copyObject(object)
+		object.Delete(key)
+		return object, nil
+	case float64, json.Number:
+		array, isOk := v.([]interface{})
+		if !isOk {
+			return nil, newError("Cannot delete field at index of %s", typeOf(v))
+		}
+		f, _ := toNumber(key)
+		if f > maxArrayIndex {
+			return nil, newError("Array index too large")
+		}
+		if f < -maxArrayIndex {
+			return nil, newError("Out of bounds negative array index")
+		}
+		i := int(f)
+		if i < 0 {
+			i += len(array)
+		}
+		if i < 0 || i >= len(array) {
+			return v, nil
+		}
+		result := make([]interface{}, 0, len(array)-1)
+		result = append(result, array[:i]...)
+		return append(result, array[i+1:]...), nil
+	case *orderedmap.OrderedMap:
+		array, isOk := v.([]interface{})
+		if !isOk {
+			return nil, newError("Cannot delete slice of %s", typeOf(v))
+		}
+		start, end, err := sliceBounds(key, len(array))
+		if err != nil {
+			return nil, err
+		}
+		result := make([]interface{}, 0, len(array)-(end-start))
+		result = append(result, array[:start]...)
+		return append(result, array[end:]...), nil
+	}
+	return nil, newError("Invalid path component %s", describe(path[0]))
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package internal
+
+import (
+	"errors"
+	"os"
+)
+
+// Mmap is not supported on this platform, files are read into memory instead.
+func Mmap(f *os.File) ([]byte, error) {
+	return nil, errors.New("mmap is not supported")
+}
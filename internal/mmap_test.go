@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mmap is not supported")
+	}
+	for _, content := range []string{`{"a": [1, 2, 3]}`, ``} {
+		filename := filepath.Join(t.TempDir(), "test.json")
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := Mmap(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Fatalf("expected %q, got %q", content, data)
+		}
+	}
+	dir, err := os.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	if _, err := Mmap(dir); err == nil {
+		t.Fatalf("a directory should not be mapped")
+	}
+}
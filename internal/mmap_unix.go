@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Mmap maps a regular file into memory read-only, so that its content is paged
+// in by the kernel instead of being copied to the heap. The mapping is never
+// released, slices and strings referencing it stay valid for the life of the
+// program.
+func Mmap(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", f.Name())
+	}
+	size := info.Size()
+	if size == 0 {
+		return []byte{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("%s is too large to be mapped", f.Name())
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
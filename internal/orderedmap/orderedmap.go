@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"sort"
+	"strconv"
 )
 
 type Pair struct {
@@ -31,6 +32,7 @@ func (a ByPair) Less(i, j int) bool { return a.LessFunc(a.Pairs[i], a.Pairs[j])
 type OrderedMap struct {
 	keys       []string
 	values     map[string]interface{}
+	duplicates map[string]string
 	escapeHTML bool
 	useNumber  bool
 }
@@ -82,6 +84,65 @@ func (o *OrderedMap) Set(key string, value interface{}) {
 	o.values[key] = value
 }
 
+// Append adds the key like Set, but never overwrites: a duplicate key is stored
+// as "key#2", "key#3" ... next to the existing one, with the first suffix which
+// is not a key of the map. It returns the stored key.
+//
+// A key may be the name given to an earlier duplicate, like the last a#2 of
+// {"a": 1, "a": 2, "a#2": 3}. The duplicates are then named again, so that
+// once every key is appended each duplicate has the first suffix taken
+// neither by a key nor by an earlier duplicate: a, a#3 and a#2 here.
+func (o *OrderedMap) Append(key string, value interface{}) string {
+	if _, isDuplicate := o.duplicates[key]; isDuplicate {
+		o.renameDuplicates(key)
+	}
+	stored := key
+	for n := 2; o.Exist(stored); n++ {
+		stored = key + "#" + strconv.Itoa(n)
+	}
+	if stored != key {
+		if o.duplicates == nil {
+			o.duplicates = make(map[string]string)
+		}
+		o.duplicates[stored] = key
+	}
+	o.Set(stored, value)
+	return stored
+}
+
+// renameDuplicates names the duplicates again in order, without taking the
+// name of a key nor reserved.
+func (o *OrderedMap) renameDuplicates(reserved string) {
+	taken := map[string]bool{reserved: true}
+	for _, k := range o.keys {
+		if _, isDuplicate := o.duplicates[k]; !isDuplicate {
+			taken[k] = true
+		}
+	}
+	values := make(map[string]interface{}, len(o.values))
+	duplicates := make(map[string]string, len(o.duplicates))
+	for i, k := range o.keys {
+		original, isDuplicate := o.duplicates[k]
+		if !isDuplicate {
+			values[k] = o.values[k]
+			continue
+		}
+		stored := original
+		for n := 2; taken[stored]; n++ {
+			stored = original + "#" + strconv.Itoa(n)
+		}
+		taken[stored] = true
+		o.keys[i], values[stored], duplicates[stored] = stored, o.values[k], original
+	}
+	o.values, o.duplicates = values, duplicates
+}
+
+// DuplicateOf returns the original key of a duplicate stored by Append.
+func (o *OrderedMap) DuplicateOf(key string) (string, bool) {
+	original, exists := o.duplicates[key]
+	return original, exists
+}
+
 func (o *OrderedMap) Delete(key string) {
 	// check key is in use
 	_, ok := o.values[key]
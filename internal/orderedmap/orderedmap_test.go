@@ -89,6 +89,58 @@ func TestOrderedMap(t *testing.T) {
 	}
 }
 
+func TestOrderedMap_Append(t *testing.T) {
+	o := New()
+	if key := o.Append("a", 1); key != "a" {
+		t.Error("Append new key", key)
+	}
+	if key := o.Append("a", 2); key != "a#2" {
+		t.Error("Append duplicate key", key)
+	}
+	if key := o.Append("a", 3); key != "a#3" {
+		t.Error("Append second duplicate key", key)
+	}
+	if v, _ := o.Get("a"); v.(int) != 1 {
+		t.Error("Append overwrote existing key")
+	}
+	if original, ok := o.DuplicateOf("a#3"); !ok || original != "a" {
+		t.Error("DuplicateOf duplicate key", original, ok)
+	}
+	if _, ok := o.DuplicateOf("a"); ok {
+		t.Error("DuplicateOf original key")
+	}
+	if !reflect.DeepEqual(o.Keys(), []string{"a", "a#2", "a#3"}) {
+		t.Error("Append keys order", o.Keys())
+	}
+}
+
+func TestOrderedMap_AppendSuffixTaken(t *testing.T) {
+	o := New()
+	o.Append("a", 1)
+	o.Append("a", 2)
+	// a#2 is a key of the object, the duplicate of a is named a#3
+	if key := o.Append("a#2", 3); key != "a#2" {
+		t.Error("Append key named like a duplicate", key)
+	}
+	if key := o.Append("a", 4); key != "a#4" {
+		t.Error("Append duplicate key after a taken suffix", key)
+	}
+	if !reflect.DeepEqual(o.Keys(), []string{"a", "a#3", "a#2", "a#4"}) {
+		t.Error("Append keys order", o.Keys())
+	}
+	for key, expected := range map[string]int{"a": 1, "a#3": 2, "a#2": 3, "a#4": 4} {
+		if v, _ := o.Get(key); v.(int) != expected {
+			t.Error("Append value of", key, v)
+		}
+	}
+	if original, ok := o.DuplicateOf("a#3"); !ok || original != "a" {
+		t.Error("DuplicateOf renamed duplicate key", original, ok)
+	}
+	if _, ok := o.DuplicateOf("a#2"); ok {
+		t.Error("DuplicateOf key named like a duplicate")
+	}
+}
+
 func TestBlankMarshalJSON(t *testing.T) {
 	o := New()
 	// blank map
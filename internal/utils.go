@@ -2,7 +2,6 @@ package internal
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +9,6 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
 	"unsafe"
 
 	"github.com/jroimartin/gocui"
@@ -53,27 +51,6 @@ func Bytes2String(data []byte) string {
 	}))
 }
 
-func RunWithTimeout(ctx context.Context, timeout time.Duration, fn func() error) (err error) {
-	errChan := make(chan error, 1)
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				errChan <- fmt.Errorf("RunWithTimeout panic: %v", r)
-			}
-			close(errChan)
-		}()
-		if bizErr := fn(); bizErr != nil {
-			errChan <- bizErr
-		}
-	}()
-	select {
-	case err = <-errChan:
-		return err
-	case <-time.After(timeout):
-		return fmt.Errorf("timeout")
-	}
-}
-
 func MultiSetKeybinding(g *gocui.Gui, viewName string, keys []interface{}, handler func(*gocui.Gui, *gocui.View) error) {
 	for _, key := range keys {
 		if err := g.SetKeybinding(viewName, key, gocui.ModNone, handler); err != nil {
@@ -3,6 +3,8 @@ package internal
 import (
 	"bytes"
 	"fmt"
+	"unicode/utf8"
+
 	"github.com/jroimartin/gocui"
 )
 
@@ -17,17 +19,47 @@ func (l *Location) CurrentIndex() string {
 	return fmt.Sprintf("%d:%d", l.CurY, l.CurX)
 }
 
+// LineSource provides the lines of a view on demand, so that only the lines in
+// the viewport are rendered. Every line ends with '\n'.
+type LineSource interface {
+	Len() int
+	Line(index int) []byte
+}
+
 type ViewBufferController struct {
 	Lines  [][]byte
+	Source LineSource // takes precedence over Lines
 	Origin int
 	Size   int
 }
 
+// Len returns the number of lines.
+func (c *ViewBufferController) Len() int {
+	if c.Source != nil {
+		return c.Source.Len()
+	}
+	return len(c.Lines)
+}
+
+// Line returns the line at index, including the trailing '\n'.
+func (c *ViewBufferController) Line(index int) []byte {
+	if c.Source != nil {
+		return c.Source.Line(index)
+	}
+	return c.Lines[index]
+}
+
+// Index returns the index of the line under the cursor.
+func (c *ViewBufferController) Index(v *gocui.View) int {
+	_, cy := v.Cursor()
+	return c.Origin + cy
+}
+
 func (c *ViewBufferController) Location(v *gocui.View) *Location {
 	cx, cy := v.Cursor()
 	line := c.getCursorLine(cy)
 	return &Location{
-		TotalY: len(c.Lines),
+		TotalY: c.Len(),
 		CurY:   cy + c.Origin + 1,
 		TotalX: len(line),
 		CurX:   cx + 1,
@@ -36,6 +68,7 @@ func (c *ViewBufferController) Location(v *gocui.View) *Location {
 
 func (c *ViewBufferController) Clear() *ViewBufferController {
 	c.Lines = c.Lines[:0]
+	c.Source = nil
 	c.Origin = 0
 	return c
 }
@@ -61,7 +94,7 @@ func (c *ViewBufferController) MoveCursor(v *gocui.View, x, y int) error {
 	cx, cy := v.Cursor()
 	_, sy := v.Size()
 
-	ncy, noy := cursorY(cy, c.Origin, sy, y, len(c.Lines))
+	ncy, noy := cursorY(cy, c.Origin, sy, y, c.Len())
 	ncx := cursorX(cx, len(c.getCursorLine(cy)), x)
 	if c.Origin != noy {
 		c.Origin = noy
@@ -73,12 +106,41 @@ func (c *ViewBufferController) MoveCursor(v *gocui.View, x, y int) error {
 	return nil
 }
 
+// Show moves the cursor to the line at index, the view is scrolled to have
+// the line in the middle if it isn't visible.
+func (c *ViewBufferController) Show(v *gocui.View, index int) error {
+	if index >= c.Len() {
+		index = c.Len() - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	_, sy := v.Size()
+	c.Origin = scrollOrigin(index, c.Origin, sy)
+	if err := c.Draw(v); err != nil {
+		return err
+	}
+	return v.SetCursor(0, index-c.Origin)
+}
+
+// scrollOrigin returns the origin of a view of the given height showing the
+// line at index, which is origin if the line is visible from it.
+func scrollOrigin(index, origin, height int) int {
+	if index >= origin && index < origin+height {
+		return origin
+	}
+	if origin = index - height/2; origin < 0 {
+		return 0
+	}
+	return origin
+}
+
 func (c *ViewBufferController) getCursorLine(cy int) []byte {
 	index := cy + c.Origin
-	if index >= len(c.Lines) {
+	if index >= c.Len() {
 		return nil
 	}
-	return c.Lines[index]
+	return c.Line(index)
 }
 
 func addCursorX(cx, max int) int {
@@ -151,16 +213,37 @@ func cursorY(cy int, oy, sy, inc, max int) (int, int) {
 }
 
 func (c *ViewBufferController) getCurView(viewSize int) [][]byte {
-	data := c.Lines[c.Origin:]
-	if len(data) <= viewSize {
-		return data
+	if c.Source == nil {
+		data := c.Lines[c.Origin:]
+		if len(data) <= viewSize {
+			return data
+		}
+		return data[:viewSize]
+	}
+	data := make([][]byte, 0, viewSize)
+	for index := c.Origin; index < c.Source.Len() && len(data) < viewSize; index++ {
+		data = append(data, c.Source.Line(index))
 	}
-	return data[:viewSize]
+	return data
 }
 
 func (c *ViewBufferController) getCurViewData(v *gocui.View) []byte {
-	_, y := v.Size()
-	return bytes.Join(c.getCurView(y), []byte{})
+	x, y := v.Size()
+	lines := c.getCurView(y)
+	data := make([]byte, 0, len(lines)*(x+1))
+	for _, line := range lines {
+		data = append(data, clipLine(line, x)...)
+	}
+	return data
+}
+
+// clipLine cuts a line that is longer than width runes could possibly fill,
+// the view doesn't scroll horizontally so the rest is never drawn.
+func clipLine(line []byte, width int) []byte {
+	if limit := width*utf8.UTFMax + 1; len(line) > limit {
+		return append(line[:limit-1:limit-1], '\n')
+	}
+	return line
 }
 
 func (c *ViewBufferController) Draw(v *gocui.View) error {
@@ -171,6 +254,25 @@ func (c *ViewBufferController) Draw(v *gocui.View) error {
 	return nil
 }
 
+// Refresh redraws the view after the lines have changed, keeping the position
+// of the cursor as long as it is still within the lines.
+func (c *ViewBufferController) Refresh(v *gocui.View) error {
+	_, cy := v.Cursor()
+	_, sy := v.Size()
+	if last := c.Len() - 1; c.Origin+cy > last {
+		c.Origin, cy = 0, 0
+		if last >= sy {
+			c.Origin, cy = last-sy+1, sy-1
+		} else if last > 0 {
+			cy = last
+		}
+	}
+	if err := c.Draw(v); err != nil {
+		return err
+	}
+	return v.SetCursor(0, cy)
+}
+
 func (c *ViewBufferController) ReDraw(v *gocui.View, data []byte) error {
 	c.Clear()
 	c.Write(data)
@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"bytes"
 	"strconv"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func Test_incCursor(t *testing.T) {
@@ -82,3 +85,32 @@ func Test_addCursorY(t *testing.T) {
 		t.Log(cy, oy)
 	}
 }
+
+func TestClipLine(t *testing.T) {
+	if line := string(clipLine([]byte("abc\n"), 1)); line != "abc\n" {
+		t.Fatalf("a short line should be kept, got %q", line)
+	}
+	long := []byte(strings.Repeat("é", 100) + "\n")
+	line := clipLine(long, 10)
+	if len(line) != 10*utf8.UTFMax+1 || line[len(line)-1] != '\n' || !bytes.HasPrefix(long, line[:len(line)-1]) {
+		t.Fatalf("unexpected clipped line %q", line)
+	}
+	if utf8.RuneCount(line) < 10 {
+		t.Fatalf("the clipped line should fill the width, got %q", line)
+	}
+}
+
+func TestScrollOrigin(t *testing.T) {
+	for _, test := range []struct {
+		index, origin, height, expected int
+	}{
+		{index: 3, origin: 0, height: 10, expected: 0},
+		{index: 12, origin: 5, height: 10, expected: 5},
+		{index: 30, origin: 0, height: 10, expected: 25},
+		{index: 2, origin: 20, height: 10, expected: 0},
+	} {
+		if origin := scrollOrigin(test.index, test.origin, test.height); origin != test.expected {
+			t.Fatalf("expected the origin %d for the line %d from %d, got %d", test.expected, test.index, test.origin, origin)
+		}
+	}
+}
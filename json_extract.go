@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// textEntry is a JSON value embedded in plain text, together with the text
+// leading up to it on the same line (timestamp, log level, logger name ...).
+type textEntry struct {
+	label string
+	value json.RawMessage
+}
+
+// extractJsonFromText scans arbitrary text, e.g. `kubectl logs` output, and
+// returns every JSON object or array it contains in order of appearance.
+func extractJsonFromText(data []byte) []textEntry {
+	entries := make([]textEntry, 0)
+	labelStart := 0
+	// failed are the brackets which were open when parsing a value failed,
+	// parsing from them would fail at the same place again. Skipping them
+	// keeps unbalanced brackets from making the scan quadratic.
+	failed := make(map[int]bool)
+	unclosed := make([]int, 0)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\n':
+			labelStart = i + 1
+			continue
+		case '{', '[':
+		default:
+			continue
+		}
+		if failed[i] {
+			delete(failed, i)
+			continue
+		}
+		p := newJsonParser(data)
+		p.pos = i
+		unclosed = unclosed[:0]
+		p.unclosed = &unclosed
+		if err := p.skipValue(); err != nil {
+			for _, start := range unclosed {
+				failed[start] = true
+			}
+			continue
+		}
+		entries = append(entries, textEntry{
+			label: string(bytes.TrimSpace(data[labelStart:i])),
+			value: data[i:p.pos],
+		})
+		i = p.pos - 1
+		labelStart = i + 1
+	}
+	return entries
+}
+
+// fromText builds a root list with one entry per JSON value found in the text,
+// each labelled with its prefix.
+func fromText(b []byte) (treeNode, error) {
+	entries := extractJsonFromText(b)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no JSON object or array found in input")
+	}
+	values := make([][]byte, 0, len(entries))
+	labels := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		values = append(values, entry.value)
+		labels = append(labels, entry.label)
+	}
+	raw := append(append([]byte{'['}, bytes.Join(values, []byte{','})...), ']')
+	root, err := parseTree(raw)
+	if err != nil {
+		return nil, err
+	}
+	root.(*listNode).labels = labels
+	return root, nil
+}
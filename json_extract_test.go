@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractJsonFromText(t *testing.T) {
+	raw := []byte(`2024-01-02T03:04:05Z INFO request {"id": 1, "tags": ["a", "b"]}
+2024-01-02T03:04:06Z WARN [worker] no payload
+2024-01-02T03:04:07Z INFO batch [{"id": 2}, {"id": 3}] done {"id": 4}
+{
+  "multi": "line"
+}
+`)
+	entries := extractJsonFromText(raw)
+	expected := []textEntry{
+		{label: "2024-01-02T03:04:05Z INFO request", value: []byte(`{"id": 1, "tags": ["a", "b"]}`)},
+		{label: "2024-01-02T03:04:07Z INFO batch", value: []byte(`[{"id": 2}, {"id": 3}]`)},
+		{label: "done", value: []byte(`{"id": 4}`)},
+		{label: "", value: []byte("{\n  \"multi\": \"line\"\n}")},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d: %v", len(expected), len(entries), entries)
+	}
+	for i, entry := range entries {
+		if entry.label != expected[i].label {
+			t.Fatalf("entry %d: expected label %q, got %q", i, expected[i].label, entry.label)
+		}
+		if string(entry.value) != string(expected[i].value) {
+			t.Fatalf("entry %d: expected value %s, got %s", i, expected[i].value, entry.value)
+		}
+	}
+}
+
+func TestExtractJsonFromUnbalancedText(t *testing.T) {
+	// parsing from each of the brackets again would take minutes
+	raw := []byte("ERROR [ {\"a\": 1} oops\n" + strings.Repeat("[", 100000) + ` {"b": 2}`)
+	entries := extractJsonFromText(raw)
+	if len(entries) != 2 || string(entries[0].value) != `{"a": 1}` || string(entries[1].value) != `{"b": 2}` {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if entries[0].label != "ERROR [" {
+		t.Fatalf("unexpected label %q", entries[0].label)
+	}
+}
+
+func TestFromText(t *testing.T) {
+	tree, err := fromText([]byte("I0102 main.go:12] start {\"a\": 1}\nI0102 main.go:13] stop {\"a\": 2}\n"))
+	if err != nil {
+		t.Fatalf("failed to convert text to tree: %v", err)
+	}
+	if p := tree.find([]string{"[1] I0102 main.go:13] stop", "a"}); p == nil || p.String(0) != "2" {
+		t.Fatalf("unexpected node for labelled path: %v", p)
+	}
+	if _, err := fromText([]byte("nothing to see here")); err == nil {
+		t.Fatalf("expected error for text without JSON")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonLinesAhead is how many lines are indexed past the last line requested,
+// so that the cursor can always move a few pages further.
+const jsonLinesAhead = 1024
+
+// jsonLines renders a raw JSON value as indented text line by line, straight
+// from the bytes of the input. The start of each line is indexed as it is
+// reached, so showing a node only scans the lines up to the viewport no matter
+// how large the node is.
+type jsonLines struct {
+	raw      []byte
+	indent   int
+	starts   []lineStart
+	complete bool
+}
+
+// lineStart is the offset in raw of the first token of a line, along with its
+// depth.
+type lineStart struct {
+	offset int
+	depth  int
+}
+
+func newJsonLines(raw []byte, indent int) *jsonLines {
+	l := &jsonLines{raw: raw, indent: indent}
+	if start := skipSpace(raw, 0); start < len(raw) {
+		l.starts = append(l.starts, lineStart{offset: start})
+	} else {
+		l.complete = true
+	}
+	l.index(jsonLinesAhead)
+	return l
+}
+
+// index scans the lines until n of them are known or the end is reached.
+func (l *jsonLines) index(n int) {
+	for !l.complete && len(l.starts) < n {
+		_, next, ok := l.render(nil, l.starts[len(l.starts)-1], false)
+		if !ok {
+			l.complete = true
+			break
+		}
+		l.starts = append(l.starts, next)
+	}
+}
+
+// Len returns the number of lines indexed so far, see Complete.
+func (l *jsonLines) Len() int {
+	return len(l.starts)
+}
+
+// Complete reports whether every line has been indexed.
+func (l *jsonLines) Complete() bool {
+	return l.complete
+}
+
+func (l *jsonLines) Line(index int) []byte {
+	l.index(index + jsonLinesAhead)
+	if index >= len(l.starts) {
+		return []byte{'\n'}
+	}
+	out, _, _ := l.render(make([]byte, 0, 64), l.starts[index], true)
+	return append(out, '\n')
+}
+
+// render appends the text of the line at start to out when write is set, and
+// returns where the next line starts, ok is false after the last line.
+func (l *jsonLines) render(out []byte, start lineStart, write bool) ([]byte, lineStart, bool) {
+	data, i := l.raw, start.offset
+	emit := func(b []byte) {
+		if write {
+			out = append(out, b...)
+		}
+	}
+	emit(bytes.Repeat([]byte{' '}, start.depth*l.indent))
+	for i < len(data) {
+		switch data[i] {
+		case '{', '[':
+			next := skipSpace(data, i+1)
+			if next >= len(data) || (data[next] != '}' && data[next] != ']') {
+				emit(data[i : i+1])
+				return out, lineStart{offset: next, depth: start.depth + 1}, next < len(data)
+			}
+			// an empty object or array stays on one line
+			emit(data[i : i+1])
+			emit(data[next : next+1])
+			i = next + 1
+		case '}', ']':
+			emit(data[i : i+1])
+			i++
+		default:
+			end, err := skipValue(data, i)
+			if err != nil {
+				emit(data[i:])
+				return out, lineStart{}, false
+			}
+			emit(data[i:end])
+			if next := skipSpace(data, end); data[i] == '"' && next < len(data) && data[next] == ':' {
+				emit([]byte(": "))
+				i = skipSpace(data, next+1)
+				continue
+			}
+			i = end
+		}
+		next := skipSpace(data, i)
+		switch {
+		case next >= len(data):
+			return out, lineStart{}, false
+		case data[next] == ',':
+			emit(data[next : next+1])
+			return out, lineStart{offset: skipSpace(data, next+1), depth: start.depth}, true
+		default:
+			return out, lineStart{offset: next, depth: start.depth - 1}, true
+		}
+	}
+	return out, lineStart{}, false
+}
+
+// nodeRaw returns the raw JSON of an object or array node.
+func nodeRaw(node treeNode) json.RawMessage {
+	switch n := node.(type) {
+	case *complexNode:
+		return n.raw
+	case *listNode:
+		return n.raw
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func readJsonLines(lines *jsonLines) string {
+	var result strings.Builder
+	for i := 0; i < lines.Len(); i++ {
+		result.Write(lines.Line(i))
+	}
+	return result.String()
+}
+
+func TestJsonLines(t *testing.T) {
+	inputs := []string{
+		`{"a": 1, "b": {"c": [1, 2.50, {}], "d": []}, "e": [[], [{"f": null}]], "g": "h, ] }"}`,
+		`[ true ,false,"x"]`,
+		`{}`,
+		`"text"`,
+		`12`,
+	}
+	for _, input := range inputs {
+		expected := encodeRawJson([]byte(input), 2) + "\n"
+		lines := newJsonLines([]byte(input), 2)
+		if !lines.Complete() {
+			t.Fatalf("small input %s should be fully indexed", input)
+		}
+		if result := readJsonLines(lines); result != expected {
+			t.Fatalf("unexpected lines of %s:\n%s\nexpected:\n%s", input, result, expected)
+		}
+	}
+}
+
+func TestJsonLinesLazy(t *testing.T) {
+	raw := []byte("[" + strings.Repeat(`{"a":1},`, 10*jsonLinesAhead) + "1]")
+	lines := newJsonLines(raw, 2)
+	if lines.Complete() || lines.Len() != jsonLinesAhead {
+		t.Fatalf("expected only %d lines to be indexed, got %d", jsonLinesAhead, lines.Len())
+	}
+	if line := string(lines.Line(jsonLinesAhead - 2)); line != "    \"a\": 1\n" {
+		t.Fatalf("unexpected line %q", line)
+	}
+	if lines.Len() != 2*jsonLinesAhead-2 {
+		t.Fatalf("expected the index to move ahead, got %d lines", lines.Len())
+	}
+	for !lines.Complete() {
+		lines.Line(lines.Len() - 1)
+	}
+	if result := readJsonLines(lines); result != encodeRawJson(raw, 2)+"\n" {
+		t.Fatalf("unexpected lines of a large array")
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/anthony-dong/jsonui/internal"
+)
+
+// jsonParser is a single-pass tokenizer which validates JSON and builds the
+// tree nodes as it goes, keeping the key order and the number literals.
+// Objects and arrays deeper than levels are only validated, they become lazy
+// nodes which parse their children when they are loaded.
+type jsonParser struct {
+	data []byte
+	pos  int
+
+	// duplicates collects the position of the duplicate keys when set
+	duplicates *[]treePosition
+	path       []pathSegment
+	keySets    []keySet
+
+	// children collects the children of the containers being built, by depth
+	children []*childrenBuilder
+	depth    int
+
+	// index collects the children of the large containers when set
+	index *indexBuilder
+
+	// unclosed collects the start of the containers which were being parsed
+	// when the parsing failed, innermost first, when set
+	unclosed *[]int
+}
+
+// pathSegment is a segment of the position of the value being parsed, it is
+// only turned into a treePosition when a duplicate key is found.
+type pathSegment struct {
+	key   string
+	index int // -1 for object keys
+}
+
+// keySet holds the keys of an object which is validated without being built,
+// to name duplicate keys like objectKeys does. The sets are reused for every
+// object at the same depth.
+type keySet struct {
+	keys  []string
+	index map[string]struct{}
+	// later are the keys after the first duplicate of the object, which its
+	// duplicates must not be named after
+	later map[string]struct{}
+}
+
+// keySetIndexSize is the number of keys from which a map is used to look
+// them up.
+const keySetIndexSize = 16
+
+func (s *keySet) reset() {
+	s.keys = s.keys[:0]
+	s.index = nil
+	s.later = nil
+}
+
+func (s *keySet) contains(key string) bool {
+	if s.index != nil {
+		_, isOk := s.index[key]
+		return isOk
+	}
+	for _, k := range s.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *keySet) add(key string) {
+	s.keys = append(s.keys, key)
+	if s.index == nil && len(s.keys) < keySetIndexSize {
+		return
+	}
+	if s.index == nil {
+		s.index = make(map[string]struct{}, len(s.keys)*2)
+		for _, k := range s.keys {
+			s.index[k] = struct{}{}
+		}
+	}
+	s.index[key] = struct{}{}
+}
+
+// store returns the name of a key in its object, see objectKeys. p.pos is
+// at the value of the key, the keys after it are looked for at the first
+// duplicate.
+func (s *keySet) store(p *jsonParser, key string) string {
+	stored := key
+	if s.contains(key) {
+		if s.later == nil {
+			s.later = p.laterKeys()
+		}
+		stored = duplicateName(key, func(name string) bool {
+			_, isLater := s.later[name]
+			return isLater || s.contains(name)
+		})
+	}
+	s.add(stored)
+	return stored
+}
+
+func newJsonParser(data []byte) *jsonParser {
+	return &jsonParser{data: data}
+}
+
+// buildLevels returns how many levels of a value of the given size are built
+// at once, the others are built when they are loaded.
+func buildLevels(size int) int {
+	if size <= lazyExpandSize {
+		return -1
+	}
+	return 1
+}
+
+// parseTree validates the JSON value at the beginning of data and builds its
+// tree, anything after the value is ignored.
+func parseTree(data []byte) (treeNode, error) {
+	p := newJsonParser(data)
+	p.pos = skipSpace(data, 0)
+	return p.parseValue(buildLevels(len(data)))
+}
+
+// parseDuplicateKeys validates raw and returns the position of every
+// duplicate object key in it, without building any node.
+func parseDuplicateKeys(raw []byte, position treePosition) ([]treePosition, error) {
+	result := make([]treePosition, 0)
+	p := newJsonParser(raw)
+	p.duplicates = &result
+	for _, key := range position {
+		p.path = append(p.path, pathSegment{key: key, index: -1})
+	}
+	p.pos = skipSpace(raw, 0)
+	err := p.skipValue()
+	return result, err
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSON at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonParser) unexpected(context string) error {
+	if p.pos >= len(p.data) {
+		return p.errorf("unexpected end of input %s", context)
+	}
+	return p.errorf("invalid character %q %s", p.data[p.pos], context)
+}
+
+// expect consumes the byte c after optional spaces.
+func (p *jsonParser) expect(c byte, context string) error {
+	p.pos = skipSpace(p.data, p.pos)
+	if p.pos >= len(p.data) || p.data[p.pos] != c {
+		return p.unexpected(context)
+	}
+	p.pos++
+	return nil
+}
+
+// next skips the spaces and returns the next byte, or 0 at the end.
+func (p *jsonParser) next() byte {
+	p.pos = skipSpace(p.data, p.pos)
+	if p.pos < len(p.data) {
+		return p.data[p.pos]
+	}
+	return 0
+}
+
+// parseValue parses the value at p.pos, building the nodes of levels levels
+// of objects and arrays, or of all of them if levels is negative.
+func (p *jsonParser) parseValue(levels int) (treeNode, error) {
+	atomic.AddInt64(&builtNodes, 1)
+	c := p.next()
+	start := p.pos
+	switch c {
+	case '{', '[':
+		if levels == 0 {
+			if err := p.skipValue(); err != nil {
+				return nil, err
+			}
+			raw := json.RawMessage(p.data[start:p.pos])
+			if raw[0] == '{' {
+				return &complexNode{baseTreeNode: baseTreeNode{true}, raw: raw}, nil
+			}
+			return &listNode{baseTreeNode: baseTreeNode{true}, raw: raw}, nil
+		}
+		return p.parseContainer(levels - 1)
+	case '"':
+		end, err := p.scanString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := unquoteString(p.data[p.pos:end])
+		if err != nil {
+			return nil, err
+		}
+		p.pos = end
+		return &stringNode{data: value}, nil
+	}
+	end, err := p.scanLiteral()
+	if err != nil {
+		return nil, err
+	}
+	literal := p.data[p.pos:end]
+	p.pos = end
+	switch literal[0] {
+	case 't':
+		return trueNode, nil
+	case 'f':
+		return falseNode, nil
+	case 'n':
+		return nullNode, nil
+	}
+	return &floatNode{data: json.Number(internal.Bytes2String(literal))}, nil
+}
+
+// parseContainer builds an object or array, see parseChildren.
+func (p *jsonParser) parseContainer(levels int) (treeNode, error) {
+	start := p.pos
+	if len(p.children) <= p.depth {
+		p.children = append(p.children, &childrenBuilder{})
+	}
+	children := p.children[p.depth]
+	children.reset()
+	p.depth++
+	err := p.parseChildren(levels, children.add)
+	p.depth--
+	if err != nil {
+		return nil, err
+	}
+	if p.data[start] == '{' {
+		shape, data := children.object()
+		return &complexNode{baseTreeNode: baseTreeNode{true}, shape: shape, data: data, raw: p.data[start:p.pos]}, nil
+	}
+	return &listNode{baseTreeNode: baseTreeNode{true}, data: children.list(), raw: p.data[start:p.pos]}, nil
+}
+
+// parseChildren parses the object or array at p.pos and calls add with each
+// child in order, the key is empty for array elements. The children of a
+// container larger than lazyExpandSize start collapsed.
+func (p *jsonParser) parseChildren(levels int, add func(key string, child treeNode)) error {
+	start := p.pos
+	var collapsed []treeNode
+	err := p.foreachChild(func(key string) error {
+		child, err := p.parseValue(levels)
+		if err != nil {
+			return err
+		}
+		if child.isCollapsable() {
+			collapsed = append(collapsed, child)
+		}
+		add(key, child)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if p.pos-start > lazyExpandSize {
+		for _, child := range collapsed {
+			child.toggleExpanded()
+		}
+	}
+	return nil
+}
+
+// skipValue validates the value at p.pos without building it.
+func (p *jsonParser) skipValue() error {
+	switch p.next() {
+	case '{', '[':
+		return p.foreachChild(func(string) error {
+			return p.skipValue()
+		})
+	case '"':
+		end, err := p.scanString()
+		if err != nil {
+			return err
+		}
+		p.pos = end
+		return nil
+	}
+	end, err := p.scanLiteral()
+	if err != nil {
+		return err
+	}
+	p.pos = end
+	return nil
+}
+
+// foreachChild walks the object or array at p.pos, value is called with p.pos
+// at each child, which it must consume.
+func (p *jsonParser) foreachChild(value func(key string) error) (err error) {
+	if p.unclosed != nil {
+		start := p.pos
+		defer func() {
+			if err != nil {
+				*p.unclosed = append(*p.unclosed, start)
+			}
+		}()
+	}
+	if p.index != nil {
+		start, mark := p.pos, len(p.index.children)
+		walk := value
+		value = func(key string) error {
+			child := indexChild{key: key, start: p.pos}
+			if err := walk(key); err != nil {
+				return err
+			}
+			child.end = p.pos
+			p.index.children = append(p.index.children, child)
+			return nil
+		}
+		defer func() {
+			p.index.close(start, p.pos, mark)
+		}()
+	}
+	if p.duplicates == nil {
+		return p.walkChildren(-1, value)
+	}
+	depth := len(p.path)
+	p.path = append(p.path, pathSegment{})
+	err = p.walkChildren(depth, value)
+	p.path = p.path[:depth]
+	return err
+}
+
+// walkChildren implements foreachChild, depth is the index of the children in
+// p.path, or -1 when the duplicate keys are not looked for.
+func (p *jsonParser) walkChildren(depth int, value func(key string) error) error {
+	object := p.data[p.pos] == '{'
+	end := byte(']')
+	if object {
+		end = '}'
+	}
+	p.pos++
+	var keys *keySet
+	if object && depth >= 0 {
+		if len(p.keySets) <= depth {
+			p.keySets = append(p.keySets, make([]keySet, depth+1-len(p.keySets))...)
+		}
+		keys = &p.keySets[depth]
+		keys.reset()
+	}
+	if p.next() == end {
+		p.pos++
+		return nil
+	}
+	for index := 0; ; index++ {
+		key := ""
+		if object {
+			if p.next() != '"' {
+				return p.unexpected("looking for beginning of object key string")
+			}
+			keyEnd, err := p.scanString()
+			if err != nil {
+				return err
+			}
+			if key, err = unquoteString(p.data[p.pos:keyEnd]); err != nil {
+				return err
+			}
+			p.pos = keyEnd
+			if err := p.expect(':', "after object key"); err != nil {
+				return err
+			}
+			if keys != nil {
+				p.path[depth] = pathSegment{key: keys.store(p, key), index: -1}
+				if p.path[depth].key != key {
+					p.addDuplicate()
+				}
+			}
+		} else if depth >= 0 {
+			p.path[depth] = pathSegment{index: index}
+		}
+		p.pos = skipSpace(p.data, p.pos)
+		if err := value(key); err != nil {
+			return err
+		}
+		switch p.next() {
+		case ',':
+			p.pos++
+		case end:
+			p.pos++
+			return nil
+		default:
+			if object {
+				return p.unexpected("after object key:value pair")
+			}
+			return p.unexpected("after array element")
+		}
+	}
+}
+
+// laterKeys returns the keys of the object being walked which come after the
+// value at p.pos, as far as the object is valid.
+func (p *jsonParser) laterKeys() map[string]struct{} {
+	keys := make(map[string]struct{})
+	q := newJsonParser(p.data)
+	q.pos = p.pos
+	for q.skipValue() == nil && q.next() == ',' {
+		q.pos++
+		if q.next() != '"' {
+			break
+		}
+		end, err := q.scanString()
+		if err != nil {
+			break
+		}
+		key, err := unquoteString(p.data[q.pos:end])
+		if err != nil {
+			break
+		}
+		keys[key] = struct{}{}
+		q.pos = end
+		if q.expect(':', "after object key") != nil {
+			break
+		}
+	}
+	return keys
+}
+
+func (p *jsonParser) addDuplicate() {
+	*p.duplicates = append(*p.duplicates, p.position())
+}
+
+// position returns the position of the value being parsed, it is only known
+// when the duplicate keys are looked for.
+func (p *jsonParser) position() treePosition {
+	position := make(treePosition, len(p.path))
+	for i, segment := range p.path {
+		if segment.index < 0 {
+			position[i] = segment.key
+		} else {
+			position[i] = "[" + strconv.Itoa(segment.index) + "]"
+		}
+	}
+	return position
+}
+
+// scanString validates the string at p.pos and returns its end.
+func (p *jsonParser) scanString() (int, error) {
+	data := p.data
+	for i := p.pos + 1; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"':
+			return i + 1, nil
+		case c == '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch data[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(data) {
+					i = len(data)
+					break
+				}
+				for _, h := range data[i+1 : i+5] {
+					if !isHexDigit(h) {
+						return 0, p.errorf("invalid character %q in \\u hexadecimal character escape", h)
+					}
+				}
+				i += 4
+			default:
+				return 0, p.errorf("invalid character %q in string escape code", data[i])
+			}
+		case c < 0x20:
+			return 0, p.errorf("invalid character %q in string literal", c)
+		}
+	}
+	p.pos = len(data)
+	return 0, p.unexpected("in string literal")
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// scanLiteral validates the number, true, false or null at p.pos and returns
+// its end.
+func (p *jsonParser) scanLiteral() (int, error) {
+	data, i := p.data, p.pos
+	if i >= len(data) {
+		return 0, p.unexpected("looking for beginning of value")
+	}
+	for _, literal := range []string{"true", "false", "null"} {
+		if data[i] != literal[0] {
+			continue
+		}
+		if len(data)-i >= len(literal) && string(data[i:i+len(literal)]) == literal {
+			return i + len(literal), nil
+		}
+		return 0, p.errorf("invalid literal, expected %s", literal)
+	}
+	if data[i] == '-' {
+		i++
+	}
+	digits := func() bool {
+		start := i
+		for i < len(data) && isDigit(data[i]) {
+			i++
+		}
+		return i > start
+	}
+	switch {
+	case i < len(data) && data[i] == '0':
+		i++
+	case !digits():
+		p.pos = i
+		return 0, p.unexpected("looking for beginning of value")
+	}
+	if i < len(data) && data[i] == '.' {
+		i++
+		if !digits() {
+			p.pos = i
+			return 0, p.unexpected("after decimal point in numeric literal")
+		}
+	}
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		if !digits() {
+			p.pos = i
+			return 0, p.unexpected("in exponent of numeric literal")
+		}
+	}
+	return i, nil
+}
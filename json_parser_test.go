@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/anthony-dong/jsonui/internal/orderedmap"
+)
+
+func TestParseTree(t *testing.T) {
+	raw := []byte(`{"z": 1.50, "a": [1e3, -0, "x\u00e9\n"], "m": {"t": true, "f": false, "n": null}, "e": {}, "l": []}`)
+	tree, err := parseTree(raw)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if keys := strings.Join(tree.(*complexNode).keys(), ","); keys != "z,a,m,e,l" {
+		t.Fatalf("key order is not kept: %s", keys)
+	}
+	if v := tree.find([]string{"z"}); v == nil || v.String(0) != "1.50" {
+		t.Fatalf("number literal is not kept: %v", v)
+	}
+	if v := tree.find([]string{"a", "[0]"}); v == nil || v.String(0) != "1e3" {
+		t.Fatalf("number literal is not kept: %v", v)
+	}
+	if v, ok := tree.find([]string{"a", "[2]"}).(*stringNode); !ok || v.data != "xé\n" {
+		t.Fatalf("string is not unquoted: %v", v)
+	}
+	if v, ok := tree.find([]string{"m", "n"}).(*nilNode); !ok || v == nil {
+		t.Fatalf("expected null")
+	}
+	if s := tree.String(0); s != `{"z":1.50,"a":[1e3,-0,"x\u00e9\n"],"m":{"t":true,"f":false,"n":null},"e":{},"l":[]}` {
+		t.Fatalf("unexpected tree string: %s", s)
+	}
+}
+
+func TestParseTreeErrors(t *testing.T) {
+	for _, raw := range []string{``, `{`, `[1,]`, `{"a" 1}`, `{"a": 1,}`, `[01]`, `[1.]`, `[-]`, `[1e]`,
+		`"\x"`, `"\u12g4"`, "\"\x01\"", `[tru]`, `nul`, `{1: 2}`, `[1 2]`} {
+		if _, err := parseTree([]byte(raw)); err == nil {
+			t.Errorf("expected an error for %q", raw)
+		}
+	}
+	_, err := parseTree([]byte(`{"a": [1, 2 3]}`))
+	if err == nil || !strings.Contains(err.Error(), "offset 12") {
+		t.Fatalf("expected the offset of the error, got %v", err)
+	}
+}
+
+func TestParseTreeDuplicates(t *testing.T) {
+	tree, err := parseTree([]byte(`{"a": 1, "a": 2, "a#2": 3, "b": {"c": [{"a": 1, "a": 2}]}}`))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if keys := strings.Join(tree.(*complexNode).keys(), ","); keys != "a,a#3,a#2,b" {
+		t.Fatalf("unexpected keys: %s", keys)
+	}
+	positions, err := parseDuplicateKeys(nodeRaw(tree), treePosition{"root"})
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	var paths []string
+	for _, position := range positions {
+		paths = append(paths, strings.Join(position, "/"))
+	}
+	if s := strings.Join(paths, " "); s != "root/a#3 root/b/c/[0]/a#2" {
+		t.Fatalf("unexpected duplicate keys: %s", s)
+	}
+}
+
+func TestScanJsonValue(t *testing.T) {
+	for raw, end := range map[string]int{`{"a": [1, "]"]} x`: 15, `"a\"b" x`: 6, `-1.5e+3, x`: 7, `null]`: 4} {
+		if n, err := scanJsonValue([]byte(raw)); err != nil || n != end {
+			t.Errorf("expected %q to end at %d, got %d, %v", raw, end, n, err)
+		}
+	}
+}
+
+// benchmarkDocument returns an array of n objects of about 200 bytes.
+func benchmarkDocument(n int) []byte {
+	var doc strings.Builder
+	doc.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			doc.WriteString(",\n")
+		}
+		fmt.Fprintf(&doc, `{"id": %d, "name": "name \"%d\"", "score": %d.25, "active": %t, "tags": ["a", "b", null],`+
+			` "nested": {"x": %d, "y": [1.5e3, -2, {"z": "é"}]}}`, i, i, i, i%2 == 0, i)
+	}
+	doc.WriteString("]")
+	return []byte(doc.String())
+}
+
+func benchmarkLoad(b *testing.B, load func(data []byte) error) {
+	for _, n := range []int{1000, 50000} {
+		data := benchmarkDocument(n)
+		b.Run(fmt.Sprintf("objects=%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := load(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBuildTree builds every node of the tree, like expanding all.
+func BenchmarkBuildTree(b *testing.B) {
+	benchmarkLoad(b, func(data []byte) error {
+		tree, err := fromBytes(data)
+		if err != nil {
+			return err
+		}
+		tree.expandAll()
+		return nil
+	})
+}
+
+// BenchmarkLoadTree is what happens before the tree is shown: validating the
+// document, building the root and looking for duplicate keys.
+func BenchmarkLoadTree(b *testing.B) {
+	benchmarkLoad(b, func(data []byte) error {
+		tree, err := fromBytes(data)
+		if err != nil {
+			return err
+		}
+		duplicateKeys(tree, treePosition{})
+		return nil
+	})
+}
+
+// BenchmarkLegacyTree is BenchmarkBuildTree with the tree built the way it
+// was before jsonParser, see legacyFromBytes.
+func BenchmarkLegacyTree(b *testing.B) {
+	benchmarkLoad(b, func(data []byte) error {
+		_, err := legacyFromBytes(data)
+		return err
+	})
+}
+
+// The tree as it was built before jsonParser, kept for the benchmarks. The
+// arrays were decoded into json.RawMessage elements which were decoded again
+// one by one, the objects into an orderedmap which was walked again to build
+// their nodes, and each node kept the decoded value it was built from.
+type legacyComplexNode struct {
+	baseTreeNode
+	data *orderedmap.OrderedMap
+	raw  *orderedmap.OrderedMap
+}
+
+type legacyListNode struct {
+	baseTreeNode
+	data []interface{}
+	raw  []interface{}
+}
+
+type legacyFloatNode struct {
+	baseTreeNode
+	data json.Number
+}
+
+type legacyStringNode struct {
+	baseTreeNode
+	data string
+}
+
+type legacyBoolNode struct {
+	baseTreeNode
+	data bool
+}
+
+type legacyNilNode struct {
+	baseTreeNode
+}
+
+func legacyFromBytes(b []byte) (interface{}, error) {
+	value, err := legacyDecodeRawMessage(bytes.TrimSpace(b))
+	if err != nil {
+		return nil, err
+	}
+	return legacyNewTree(value)
+}
+
+func legacyNewJsonDecoder(data []byte) *json.Decoder {
+	decoder := json.NewDecoder(bytes.NewBuffer(data))
+	decoder.UseNumber()
+	return decoder
+}
+
+func legacyDecodeRawMessage(data json.RawMessage) (interface{}, error) {
+	if len(data) >= 2 && data[0] == '{' {
+		orderedMap := orderedmap.New()
+		orderedMap.SetUseNumber(true)
+		orderedMap.SetEscapeHTML(false)
+		if err := legacyNewJsonDecoder(data).Decode(&orderedMap); err == nil {
+			return orderedMap, nil
+		}
+	}
+	if len(data) >= 2 && data[0] == '[' {
+		if array, err := legacyDecodeArray(data); err == nil {
+			return array, nil
+		}
+	}
+	var result interface{}
+	if err := legacyNewJsonDecoder(data).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func legacyDecodeArray(data []byte) ([]interface{}, error) {
+	array := make([]json.RawMessage, 0)
+	if err := legacyNewJsonDecoder(data).Decode(&array); err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, len(array))
+	for index, elem := range array {
+		message, err := legacyDecodeRawMessage(elem)
+		if err != nil {
+			return nil, err
+		}
+		result[index] = message
+	}
+	return result, nil
+}
+
+func legacyNewTree(y interface{}) (interface{}, error) {
+	switch v := y.(type) {
+	case bool:
+		return &legacyBoolNode{baseTreeNode{true}, v}, nil
+	case string:
+		return &legacyStringNode{baseTreeNode{true}, v}, nil
+	case nil:
+		return &legacyNilNode{baseTreeNode{true}}, nil
+	case json.Number:
+		return &legacyFloatNode{baseTreeNode{true}, v}, nil
+	case orderedmap.OrderedMap:
+		// the objects nested in an object are decoded by value
+		return legacyNewTree(&v)
+	case *orderedmap.OrderedMap:
+		data := orderedmap.NewWithSize(v.Size())
+		if err := v.ForeachErr(func(key string, value interface{}) error {
+			child, err := legacyNewTree(value)
+			if err != nil {
+				return err
+			}
+			data.Set(key, child)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return &legacyComplexNode{baseTreeNode: baseTreeNode{true}, data: data, raw: v}, nil
+	case []interface{}:
+		data := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			child, err := legacyNewTree(item)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, child)
+		}
+		return &legacyListNode{baseTreeNode: baseTreeNode{true}, data: data, raw: v}, nil
+	}
+	return nil, fmt.Errorf("unexpected data type %T", y)
+}
+
+// BenchmarkUnmarshal is encoding/json decoding the same documents, for
+// reference.
+func BenchmarkUnmarshal(b *testing.B) {
+	benchmarkLoad(b, func(data []byte) error {
+		var v interface{}
+		return json.Unmarshal(data, &v)
+	})
+}
+
+// BenchmarkTreeMemory reports the heap held by the fully built tree of an
+// array of a million similar objects, and by the tree built the way it was
+// before, see legacyFromBytes.
+func BenchmarkTreeMemory(b *testing.B) {
+	var doc strings.Builder
+	doc.WriteString("[")
+	for i := 0; i < 1000000; i++ {
+		if i > 0 {
+			doc.WriteString(",")
+		}
+		fmt.Fprintf(&doc, `{"id":%d,"name":"item %d","active":%t,"score":%d.5,"tags":["a",null]}`, i, i, i%2 == 0, i)
+	}
+	doc.WriteString("]")
+	data := []byte(doc.String())
+	for _, c := range []struct {
+		name  string
+		build func() (interface{}, error)
+	}{
+		{"jsonParser", func() (interface{}, error) {
+			tree, err := fromBytes(data)
+			if err != nil {
+				return nil, err
+			}
+			tree.expandAll()
+			return tree, nil
+		}},
+		{"legacy", func() (interface{}, error) {
+			return legacyFromBytes(data)
+		}},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				tree, err := c.build()
+				if err != nil {
+					b.Fatal(err)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "heap-MB")
+				runtime.KeepAlive(tree)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/anthony-dong/jsonui/internal"
+)
+
+// The functions below walk raw JSON byte by byte to find the boundaries of
+// values, they only check as much syntax as they need to, so the input should
+// be validated (see scanJsonValue) before.
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipString returns the end of the string starting at i.
+func skipString(data []byte, i int) (int, error) {
+	if i >= len(data) || data[i] != '"' {
+		return 0, fmt.Errorf("expected a string at offset %d", i)
+	}
+	for i++; ; i++ {
+		quote := bytes.IndexByte(data[i:], '"')
+		if quote < 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		i += quote
+		escapes := 0
+		for data[i-escapes-1] == '\\' {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			return i + 1, nil
+		}
+	}
+}
+
+// skipValue returns the end of the value starting at i.
+func skipValue(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case '"':
+				end, err := skipString(data, i)
+				if err != nil {
+					return 0, err
+				}
+				i = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1, nil
+				}
+			}
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	start := i
+	for i < len(data) {
+		switch data[i] {
+		case ',', '}', ']', ' ', '\t', '\n', '\r':
+			return i, nil
+		}
+		i++
+	}
+	if i == start {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return i, nil
+}
+
+// unquoteString decodes a JSON string, strings without escapes share the
+// memory of raw, which is never modified (it may be a read-only mapping).
+func unquoteString(raw []byte) (string, error) {
+	if len(raw) >= 2 && bytes.IndexByte(raw, '\\') < 0 {
+		return internal.Bytes2String(raw[1 : len(raw)-1]), nil
+	}
+	var result string
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// scanJsonValue validates the JSON value at the beginning of data and returns
+// its size, anything after it is ignored.
+func scanJsonValue(data []byte) (int, error) {
+	p := newJsonParser(data)
+	p.pos = skipSpace(data, 0)
+	if err := p.skipValue(); err != nil {
+		return 0, err
+	}
+	return p.pos, nil
+}
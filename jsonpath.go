@@ -0,0 +1,753 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// jsonPath is a compiled JSONPath expression such as
+// $.store.book[?(@.price < 10)].title, see compileJSONPath.
+type jsonPath struct {
+	segments []jsonPathSegment
+}
+
+// jsonPathSegment selects among the children of the nodes selected by the
+// previous segment, or among the children of all their descendants for the
+// descendant segments (..).
+type jsonPathSegment struct {
+	descendants bool
+	selectors   []jsonPathSelector
+}
+
+// jsonPathSelector selects children of a node.
+type jsonPathSelector interface {
+	selectChildren(ev *jsonPathEval, node treeNode, fn func(key string, child treeNode))
+}
+
+// jsonPathMatch is a node selected by a JSONPath expression.
+type jsonPathMatch struct {
+	position treePosition
+	node     treeNode
+}
+
+// jsonPathEval is the evaluation of a query over the document whose root is
+// root, $ in the filters. It stops with the error of ctx once it is cancelled.
+type jsonPathEval struct {
+	ctx  context.Context
+	root treeNode
+	// load builds the children of a node before they are selected when it is
+	// set, it returns true if they are to be dropped with unload afterwards.
+	// Otherwise the nodes load their children themselves and keep them.
+	load   func(node treeNode) bool
+	unload func(node treeNode)
+}
+
+// evaluate returns the nodes selected by p starting at node, in the order of
+// the selectors. Their children are loaded on the way.
+func (p *jsonPath) evaluate(root, node treeNode) []jsonPathMatch {
+	matches, _ := p.run(&jsonPathEval{ctx: context.Background(), root: root}, node)
+	return matches
+}
+
+// run returns the nodes selected by p starting at node, see evaluate.
+func (p *jsonPath) run(ev *jsonPathEval, node treeNode) ([]jsonPathMatch, error) {
+	matches := []jsonPathMatch{{position: treePosition{}, node: node}}
+	for _, segment := range p.segments {
+		var selected []jsonPathMatch
+		for _, m := range matches {
+			if err := ev.ctx.Err(); err != nil {
+				return nil, err
+			}
+			segment.apply(ev, m, func(child jsonPathMatch) {
+				selected = append(selected, child)
+			})
+		}
+		matches = selected
+	}
+	if err := ev.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func (s jsonPathSegment) apply(ev *jsonPathEval, m jsonPathMatch, fn func(jsonPathMatch)) {
+	if ev.load != nil && ev.load(m.node) {
+		// the children selected are only kept by the matches
+		defer ev.unload(m.node)
+	}
+	for _, selector := range s.selectors {
+		selector.selectChildren(ev, m.node, func(key string, child treeNode) {
+			fn(jsonPathMatch{position: appendPosition(m.position, key), node: child})
+		})
+	}
+	if s.descendants {
+		foreachChild(m.node, 0, func(key, _ string, child treeNode, _, _ bool) {
+			if ev.ctx.Err() != nil {
+				return
+			}
+			s.apply(ev, jsonPathMatch{position: appendPosition(m.position, key), node: child}, fn)
+		})
+	}
+}
+
+// appendPosition returns a new position of the child at key.
+func appendPosition(position treePosition, key string) treePosition {
+	child := make(treePosition, len(position)+1)
+	copy(child, position)
+	child[len(position)] = key
+	return child
+}
+
+// nameSelector selects the member of an object with a key, ['key'] or .key.
+type nameSelector string
+
+func (s nameSelector) selectChildren(_ *jsonPathEval, node treeNode, fn func(key string, child treeNode)) {
+	if n, isOk := node.(*complexNode); isOk {
+		if child, isOk := n.get(string(s)); isOk {
+			fn(string(s), child)
+		}
+	}
+}
+
+// wildcardSelector selects every member of an object or element of an array.
+type wildcardSelector struct{}
+
+func (wildcardSelector) selectChildren(_ *jsonPathEval, node treeNode, fn func(key string, child treeNode)) {
+	foreachChild(node, 0, func(key, _ string, child treeNode, _, _ bool) {
+		fn(key, child)
+	})
+}
+
+// indexSelector selects an element of an array, counted from the end when it
+// is negative.
+type indexSelector int
+
+func (s indexSelector) selectChildren(_ *jsonPathEval, node treeNode, fn func(key string, child treeNode)) {
+	n, isOk := node.(*listNode)
+	if !isOk {
+		return
+	}
+	n.load()
+	i := int(s)
+	if i < 0 {
+		i += len(n.data)
+	}
+	if i >= 0 && i < len(n.data) {
+		fn(fmt.Sprintf("[%d]", i), n.data[i])
+	}
+}
+
+// sliceSelector selects the elements of an array in [start, end) by step, like
+// the slices of Python.
+type sliceSelector struct {
+	start, end       int
+	hasStart, hasEnd bool
+	step             int
+}
+
+func (s sliceSelector) selectChildren(_ *jsonPathEval, node treeNode, fn func(key string, child treeNode)) {
+	n, isOk := node.(*listNode)
+	if !isOk || s.step == 0 {
+		return
+	}
+	n.load()
+	size := len(n.data)
+	// the bounds are clamped to [0, size] going forward, to [-1, size-1]
+	// going backward
+	low, high := 0, size
+	if s.step < 0 {
+		low, high = -1, size-1
+	}
+	bound := func(i int, isSet bool, defaultValue int) int {
+		if !isSet {
+			return defaultValue
+		}
+		if i < 0 {
+			i += size
+		}
+		if i < low {
+			return low
+		}
+		if i > high {
+			return high
+		}
+		return i
+	}
+	if s.step > 0 {
+		for i, end := bound(s.start, s.hasStart, 0), bound(s.end, s.hasEnd, size); i < end; i += s.step {
+			fn(fmt.Sprintf("[%d]", i), n.data[i])
+		}
+		return
+	}
+	for i, end := bound(s.start, s.hasStart, size-1), bound(s.end, s.hasEnd, -1); i > end; i += s.step {
+		fn(fmt.Sprintf("[%d]", i), n.data[i])
+	}
+}
+
+// filterSelector selects the children for which an expression is true, [?()].
+type filterSelector struct {
+	expr filterExpr
+}
+
+func (s filterSelector) selectChildren(ev *jsonPathEval, node treeNode, fn func(key string, child treeNode)) {
+	foreachChild(node, 0, func(key, _ string, child treeNode, _, _ bool) {
+		if s.expr.test(ev, child) {
+			fn(key, child)
+		}
+	})
+}
+
+// filterExpr is the expression of a filter, current is the child tested, @.
+type filterExpr interface {
+	test(ev *jsonPathEval, current treeNode) bool
+}
+
+type orExpr []filterExpr
+
+func (e orExpr) test(ev *jsonPathEval, current treeNode) bool {
+	for _, operand := range e {
+		if operand.test(ev, current) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr []filterExpr
+
+func (e andExpr) test(ev *jsonPathEval, current treeNode) bool {
+	for _, operand := range e {
+		if !operand.test(ev, current) {
+			return false
+		}
+	}
+	return true
+}
+
+type notExpr struct {
+	expr filterExpr
+}
+
+func (e notExpr) test(ev *jsonPathEval, current treeNode) bool {
+	return !e.expr.test(ev, current)
+}
+
+// existsExpr is true when a query selects some node, [?(@.isbn)].
+type existsExpr struct {
+	query queryOperand
+}
+
+func (e existsExpr) test(ev *jsonPathEval, current treeNode) bool {
+	matches, _ := e.query.path.run(ev, e.query.start(ev, current))
+	return len(matches) > 0
+}
+
+// comparisonExpr compares the values of two operands. An operand which
+// doesn't select exactly one node has no value, which is only equal to no
+// value.
+type comparisonExpr struct {
+	left, right filterOperand
+	op          string
+}
+
+func (e comparisonExpr) test(ev *jsonPathEval, current treeNode) bool {
+	left, right := e.left.value(ev, current), e.right.value(ev, current)
+	switch e.op {
+	case "==":
+		return equalNodes(left, right)
+	case "!=":
+		return !equalNodes(left, right)
+	}
+	order, isOk := compareNodes(left, right)
+	if !isOk {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+// regexpExpr matches the value of an operand against a regular expression,
+// [?(@.name =~ /^a/i)].
+type regexpExpr struct {
+	operand filterOperand
+	re      *regexp.Regexp
+}
+
+func (e regexpExpr) test(ev *jsonPathEval, current treeNode) bool {
+	s, isOk := e.operand.value(ev, current).(*stringNode)
+	return isOk && e.re.MatchString(s.data)
+}
+
+// filterOperand is a literal or a query in a filter expression.
+type filterOperand interface {
+	value(ev *jsonPathEval, current treeNode) treeNode
+}
+
+type literalOperand struct {
+	node treeNode
+}
+
+func (o literalOperand) value(_ *jsonPathEval, _ treeNode) treeNode {
+	return o.node
+}
+
+// queryOperand is a query of the current node, @, or of the root, $.
+type queryOperand struct {
+	path     *jsonPath
+	relative bool
+}
+
+func (o queryOperand) start(ev *jsonPathEval, current treeNode) treeNode {
+	if o.relative {
+		return current
+	}
+	return ev.root
+}
+
+func (o queryOperand) value(ev *jsonPathEval, current treeNode) treeNode {
+	matches, _ := o.path.run(ev, o.start(ev, current))
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches[0].node
+}
+
+// equalNodes reports whether two values are equal, nil being no value.
+func equalNodes(a, b treeNode) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if order, isOk := compareNodes(a, b); isOk {
+		return order == 0
+	}
+	switch a.(type) {
+	case *complexNode, *listNode:
+		return a.String(0) == b.String(0)
+	}
+	return a == b
+}
+
+// compareNodes orders two numbers or two strings.
+func compareNodes(a, b treeNode) (int, bool) {
+	switch a := a.(type) {
+	case *floatNode:
+		b, isOk := b.(*floatNode)
+		if !isOk {
+			return 0, false
+		}
+		x, errX := a.data.Float64()
+		y, errY := b.data.Float64()
+		if errX != nil || errY != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case *stringNode:
+		b, isOk := b.(*stringNode)
+		if !isOk {
+			return 0, false
+		}
+		return strings.Compare(a.data, b.data), true
+	}
+	return 0, false
+}
+
+// compileJSONPath compiles a JSONPath expression. It has the root $, the child
+// segments .key, ['key'], [0], [-1], [start:end:step], [*], .* and unions of
+// them like ['a','b'], the descendant segments ..key and ..[selectors], and
+// the filters [?(expression)] where expression compares the queries of the
+// current node @ or of the root $ with == != < <= > >=, with a regular
+// expression with =~ /pattern/i, or tests whether they exist, combined with
+// && || ! and parentheses. The $ can be left out.
+func compileJSONPath(text string) (*jsonPath, error) {
+	p := &jsonPathParser{text: strings.TrimSpace(text)}
+	if !p.consume("$") && !strings.HasPrefix(p.text, ".") && !strings.HasPrefix(p.text, "[") {
+		return nil, p.errorf("expected $")
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.text) {
+		return nil, p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	return path, nil
+}
+
+type jsonPathParser struct {
+	text string
+	pos  int
+}
+
+func (p *jsonPathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at offset %d", append(args, p.pos)...)
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next byte, or 0 at the end.
+func (p *jsonPathParser) peek() byte {
+	if p.pos < len(p.text) {
+		return p.text[p.pos]
+	}
+	return 0
+}
+
+func (p *jsonPathParser) consume(s string) bool {
+	if strings.HasPrefix(p.text[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// parsePath parses the segments following $ or @.
+func (p *jsonPathParser) parsePath() (*jsonPath, error) {
+	path := &jsonPath{}
+	for {
+		p.skipSpace()
+		var segment jsonPathSegment
+		switch {
+		case p.consume(".."):
+			segment.descendants = true
+			if p.peek() == '[' {
+				break
+			}
+			fallthrough
+		case p.consume("."):
+			if p.consume("*") {
+				segment.selectors = []jsonPathSelector{wildcardSelector{}}
+				break
+			}
+			name := p.parseName()
+			if name == "" {
+				return nil, p.errorf("expected a key")
+			}
+			segment.selectors = []jsonPathSelector{nameSelector(name)}
+		case p.peek() == '[':
+		default:
+			return path, nil
+		}
+		if segment.selectors == nil {
+			selectors, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			segment.selectors = selectors
+		}
+		path.segments = append(path.segments, segment)
+	}
+}
+
+// parseName parses the key of .key, made of letters, digits, _ and -.
+func (p *jsonPathParser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.text) {
+		r, size := utf8.DecodeRuneInString(p.text[p.pos:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			break
+		}
+		p.pos += size
+	}
+	return p.text[start:p.pos]
+}
+
+// parseBracket parses the selectors between brackets, separated by commas.
+func (p *jsonPathParser) parseBracket() ([]jsonPathSelector, error) {
+	p.pos++
+	var selectors []jsonPathSelector
+	for {
+		p.skipSpace()
+		selector, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+		p.skipSpace()
+		if p.consume("]") {
+			return selectors, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or ]")
+		}
+	}
+}
+
+func (p *jsonPathParser) parseSelector() (jsonPathSelector, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return nameSelector(name), nil
+	case c == '*':
+		p.pos++
+		return wildcardSelector{}, nil
+	case c == '?':
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return filterSelector{expr: expr}, nil
+	}
+	start, hasStart, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume(":") {
+		if !hasStart {
+			return nil, p.errorf("expected a selector")
+		}
+		return indexSelector(start), nil
+	}
+	s := sliceSelector{start: start, hasStart: hasStart, step: 1}
+	p.skipSpace()
+	if s.end, s.hasEnd, err = p.parseInt(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		step, hasStep, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if hasStep {
+			s.step = step
+		}
+	}
+	return s, nil
+}
+
+// parseInt parses an optional integer.
+func (p *jsonPathParser) parseInt() (int, bool, error) {
+	start := p.pos
+	p.consume("-")
+	for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	number := p.text[start:p.pos]
+	i, err := strconv.Atoi(number)
+	if err != nil {
+		p.pos = start
+		return 0, false, p.errorf("invalid index %q", number)
+	}
+	return i, true, nil
+}
+
+// parseString parses a string quoted with ' or ", with the escapes of JSON.
+func (p *jsonPathParser) parseString() (string, error) {
+	quote := p.text[p.pos]
+	quoted := strings.Builder{}
+	quoted.WriteByte('"')
+	for i := p.pos + 1; i < len(p.text); i++ {
+		switch c := p.text[i]; {
+		case c == quote:
+			s, err := strconv.Unquote(quoted.String() + `"`)
+			if err != nil {
+				return "", p.errorf("invalid string")
+			}
+			p.pos = i + 1
+			return s, nil
+		case c == '\\' && i+1 < len(p.text):
+			i++
+			switch next := p.text[i]; next {
+			case '\'', '/':
+				quoted.WriteByte(next)
+			default:
+				quoted.WriteByte(c)
+				quoted.WriteByte(next)
+			}
+		case c == '"':
+			quoted.WriteString(`\"`)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jsonPathParser) parseOr() (filterExpr, error) {
+	expr, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orExpr{expr}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		if expr, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or = append(or, expr)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *jsonPathParser) parseAnd() (filterExpr, error) {
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := andExpr{expr}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		if expr, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		and = append(and, expr)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *jsonPathParser) parseUnary() (filterExpr, error) {
+	p.skipSpace()
+	if p.consume("!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	}
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *jsonPathParser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume("=~") {
+		p.skipSpace()
+		re, err := p.parseRegexp()
+		if err != nil {
+			return nil, err
+		}
+		return regexpExpr{operand: left, re: re}, nil
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.consume(op) {
+			continue
+		}
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return comparisonExpr{left: left, right: right, op: op}, nil
+	}
+	query, isOk := left.(queryOperand)
+	if !isOk {
+		return nil, p.errorf("expected a comparison")
+	}
+	return existsExpr{query: query}, nil
+}
+
+func (p *jsonPathParser) parseOperand() (filterOperand, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return queryOperand{path: path, relative: c == '@'}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalOperand{node: &stringNode{data: s}}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		for p.pos < len(p.text) && strings.IndexByte("+-.0123456789eE", p.text[p.pos]) >= 0 {
+			p.pos++
+		}
+		number := p.text[start:p.pos]
+		if _, err := strconv.ParseFloat(number, 64); err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", number)
+		}
+		return literalOperand{node: &floatNode{data: json.Number(number)}}, nil
+	}
+	switch {
+	case p.consume("true"):
+		return literalOperand{node: trueNode}, nil
+	case p.consume("false"):
+		return literalOperand{node: falseNode}, nil
+	case p.consume("null"):
+		return literalOperand{node: nullNode}, nil
+	}
+	return nil, p.errorf("expected a value")
+}
+
+// parseRegexp parses /pattern/flags, the flags being the ones of Go's regexp
+// syntax such as i.
+func (p *jsonPathParser) parseRegexp() (*regexp.Regexp, error) {
+	if !p.consume("/") {
+		return nil, p.errorf("expected /pattern/")
+	}
+	pattern := strings.Builder{}
+	for ; p.pos < len(p.text) && p.text[p.pos] != '/'; p.pos++ {
+		if p.text[p.pos] == '\\' && p.pos+1 < len(p.text) && p.text[p.pos+1] == '/' {
+			p.pos++
+		}
+		pattern.WriteByte(p.text[p.pos])
+	}
+	if !p.consume("/") {
+		return nil, p.errorf("unterminated regular expression")
+	}
+	flags := p.parseName()
+	expr := pattern.String()
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, p.errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
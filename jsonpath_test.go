@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const storeJSON = `{"store": {
+	"book": [
+		{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+		{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+		{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+		{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+	],
+	"bicycle": {"color": "red", "price": 19.95}
+}, "expensive": 10, "a.b": [0, 1, 2, 3, 4, 5]}`
+
+func TestJSONPath(t *testing.T) {
+	tree, err := fromBytes([]byte(storeJSON))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for query, expected := range map[string]string{
+		`$.store.book[?(@.price < 10)].title`:     `"Sayings of the Century", "Moby Dick"`,
+		`$.store.book[*].author`:                  `"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"`,
+		`$..author`:                               `"Nigel Rees", "Evelyn Waugh", "Herman Melville", "J. R. R. Tolkien"`,
+		`$.store..price`:                          `8.95, 12.99, 8.99, 22.99, 19.95`,
+		`$..book[2].title`:                        `"Moby Dick"`,
+		`$..book[-1].title`:                       `"The Lord of the Rings"`,
+		`$..book[0,1].price`:                      `8.95, 12.99`,
+		`$..book[:2].price`:                       `8.95, 12.99`,
+		`$..book[?(@.isbn)].price`:                `8.99, 22.99`,
+		`$..book[?(!@.isbn)].price`:               `8.95, 12.99`,
+		`$..book[?(@.price > $.expensive)].price`: `12.99, 22.99`,
+		`$..book[?(@.category == 'fiction' && @.price < 10 || @.price > 20)].price`: `8.99, 22.99`,
+		`$..book[?(@.author =~ /^j\. r/i)].price`:                                   `22.99`,
+		`$.store.*.color`:     `"red"`,
+		`$['a.b'][1:5:2]`:     `1, 3`,
+		`$["a.b"][::-2]`:      `5, 3, 1`,
+		`$['a.b'][-2:]`:       `4, 5`,
+		`$['a.b'][?(@ >= 4)]`: `4, 5`,
+		`.expensive`:          `10`,
+		`$.missing`:           ``,
+	} {
+		path, err := compileJSONPath(query)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %v", query, err)
+		}
+		values := make([]string, 0)
+		for _, m := range path.evaluate(tree, tree) {
+			if tree.find(m.position) != m.node {
+				t.Fatalf("the position %v of a match of %s isn't the one of its node", m.position, query)
+			}
+			values = append(values, m.node.String(0))
+		}
+		if result := strings.Join(values, ", "); result != expected {
+			t.Fatalf("unexpected results of %s: %s", query, result)
+		}
+	}
+	path, _ := compileJSONPath("$")
+	if matches := path.evaluate(tree, tree); len(matches) != 1 || matches[0].node != tree || len(matches[0].position) != 0 {
+		t.Fatalf("expected $ to select the root, got %v", matches)
+	}
+}
+
+func TestJSONPathPositions(t *testing.T) {
+	tree, err := fromBytes([]byte(`{"a": [{"b": 1}, {"b": 2}], "a": 3}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	path, _ := compileJSONPath(`$..b`)
+	if positions := fmt.Sprint(path.evaluate(tree, tree)[1].position); positions != "[a [1] b]" {
+		t.Fatalf("unexpected position %s", positions)
+	}
+	path, _ = compileJSONPath(`$['a#2']`)
+	if matches := path.evaluate(tree, tree); len(matches) != 1 || matches[0].node.String(0) != "3" {
+		t.Fatalf("expected the duplicate key to be selected by its name in the tree, got %v", matches)
+	}
+}
+
+func TestCompileJSONPathErrors(t *testing.T) {
+	for query, expected := range map[string]string{
+		`store`:                   "expected $ at offset 0",
+		`$.`:                      "expected a key at offset 2",
+		`$[1`:                     "expected , or ] at offset 3",
+		`$['a]`:                   "unterminated string at offset 2",
+		`$[?(@.a == )]`:           "expected a value at offset 11",
+		`$[?(@.a =~ /[/)]`:        "invalid regular expression",
+		`$[?(1)]`:                 "expected a comparison at offset 5",
+		`$.a b`:                   `unexpected "b" at offset 4`,
+		`$[?(@.a == 1]`:           "expected ) at offset 12",
+		`$[99999999999999999999]`: "invalid index",
+	} {
+		_, err := compileJSONPath(query)
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Fatalf("expected compiling %s to fail with %q, got %v", query, expected, err)
+		}
+	}
+}
@@ -1,17 +1,13 @@
 package main
 
 import (
-	"bytes"
-	"context"
 	"fmt"
 	"log"
 	"math"
 	"strings"
-	"time"
 
 	"github.com/anthony-dong/jsonui/internal"
 	"github.com/atotto/clipboard"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/jroimartin/gocui"
 )
@@ -77,30 +73,46 @@ var viewPositions = map[string]viewPosition{
 }
 
 var tree treeNode
+var treeLines *treeRows
+var decodeInput decodeFunc = fromBytes
 var treeController internal.ViewBufferController
 var textController internal.ViewBufferController
-var rootTextController internal.ViewBufferController
 
 var helpMessage = ""
+var duplicateSummary = ""
+var duplicateCount = 0
+
+const maxDuplicateSummary = 10
+
+func initDuplicateSummary(positions []treePosition) {
+	duplicateCount = len(positions)
+	duplicateSummary = ""
+	if duplicateCount == 0 {
+		return
+	}
+	paths := make([]string, 0, maxDuplicateSummary)
+	for i, p := range positions {
+		if i == maxDuplicateSummary {
+			paths = append(paths, "...")
+			break
+		}
+		paths = append(paths, formatPath(tree, p))
+	}
+	duplicateSummary = fmt.Sprintf("Warning: %d duplicate keys %s", duplicateCount, strings.Join(paths, ", "))
+}
+
+func treeTitle() string {
+	if duplicateCount > 0 {
+		return fmt.Sprintf(" %s [duplicate keys=%d] ", treeView, duplicateCount)
+	}
+	return " " + treeView + " "
+}
 
 func initController() error {
 	helpMessage = initHelpMsg().String()
-	wg := errgroup.Group{}
-	wg.Go(func() error {
-		buf := bytes.NewBuffer(make([]byte, 0, 1024*1024))
-		if err := tree.draw(buf, 0); err != nil {
-			return err
-		}
-		treeController.Write(buf.Bytes())
-		return nil
-	})
-	wg.Go(func() error {
-		data := tree.String(jsonPadding)
-		textController.WriteString(data)
-		rootTextController.WriteString(data)
-		return nil
-	})
-	return wg.Wait()
+	treeLines = newRows()
+	treeController.Source = treeLines
+	return nil
 }
 
 func initGUI(g *gocui.Gui) {
@@ -108,9 +120,18 @@ func initGUI(g *gocui.Gui) {
 		return
 	}
 	g.Cursor = true
+	// Esc closes the prompts
+	g.InputEsc = true
 	g.SetManagerFunc(layout)
 
-	internal.MultiSetKeybinding(g, "", []interface{}{gocui.KeyCtrlC, 'q'}, internal.Quit)
+	// the keys which type text in a prompt are bound to the other views only
+	documentViews := []string{treeView, textView}
+	if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, internal.Quit); err != nil {
+		log.Panicln(err)
+	}
+	for _, view := range documentViews {
+		internal.MultiSetKeybinding(g, view, []interface{}{'q'}, internal.Quit)
+	}
 
 	if err := g.SetKeybinding("", gocui.KeyTab, gocui.ModNone, switchView); err != nil {
 		log.Panicln(err)
@@ -133,20 +154,32 @@ func initGUI(g *gocui.Gui) {
 	if err := g.SetKeybinding(treeView, gocui.KeyArrowLeft, gocui.ModNone, toggleExpand); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", 'c', gocui.ModNone, func(gui *gocui.Gui, view *gocui.View) error {
-		p := findTreePosition(g)
-		subTree := tree.find(p)
-		data := subTree.String(2)
-		if formatData {
-			data = internal.FormatData(data)
+	for depth := 1; depth <= 9; depth++ {
+		if err := g.SetKeybinding(treeView, rune('0'+depth), gocui.ModNone, expandDepth(depth)); err != nil {
+			log.Panicln(err)
 		}
-		_ = clipboard.WriteAll(data)
-		return nil
-	}); err != nil {
-		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", 'f', gocui.ModNone, formatView); err != nil {
-		log.Panicln(err)
+	for _, view := range documentViews {
+		if err := g.SetKeybinding(view, 'c', gocui.ModNone, func(gui *gocui.Gui, view *gocui.View) error {
+			subTree := findTreeNode(g)
+			if subTree == nil {
+				return nil
+			}
+			data := subTree.String(2)
+			if formatData {
+				data = internal.FormatData(data)
+			}
+			_ = clipboard.WriteAll(data)
+			return nil
+		}); err != nil {
+			log.Panicln(err)
+		}
+		if err := g.SetKeybinding(view, 'f', gocui.ModNone, formatView); err != nil {
+			log.Panicln(err)
+		}
+		if err := g.SetKeybinding(view, 'v', gocui.ModNone, reloadFromClipboard); err != nil {
+			log.Panicln(err)
+		}
 	}
 	if err := g.SetKeybinding(treeView, 'e', gocui.ModNone, func(gui *gocui.Gui, view *gocui.View) error {
 		if expandAllStatus {
@@ -158,10 +191,95 @@ func initGUI(g *gocui.Gui) {
 	}); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", 'h', gocui.ModNone, toggleHelp); err != nil {
+	for _, view := range documentViews {
+		internal.MultiSetKeybinding(g, view, []interface{}{'h', '?'}, toggleHelp)
+	}
+	if err := g.SetKeybinding(treeView, '/', gocui.ModNone, openSearch); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'n', gocui.ModNone, nextMatch(1)); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'N', gocui.ModNone, nextMatch(-1)); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'F', gocui.ModNone, openFilter); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, gocui.KeyEsc, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		if stopQuery(g) {
+			return nil
+		}
+		if err := clearFilter(g); err != nil {
+			return err
+		}
+		return clearTransform(g)
+	}); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'g', gocui.ModNone, openGoto); err != nil {
+		log.Panicln(err)
+	}
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'p'}, structuralMovement(parentPosition))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'J'}, structuralMovement(withDirection(siblingPosition, 1)))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'K'}, structuralMovement(withDirection(siblingPosition, -1)))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'['}, structuralMovement(withDirection(childPosition, 1)))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{']'}, structuralMovement(withDirection(childPosition, -1)))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'>'}, structuralMovement(withDirection(depthPosition, 1)))
+	internal.MultiSetKeybinding(g, treeView, []interface{}{'<'}, structuralMovement(withDirection(depthPosition, -1)))
+	if err := g.SetKeybinding(treeView, gocui.KeyCtrlO, gocui.ModNone, historyMovement(-1)); err != nil {
+		log.Panicln(err)
+	}
+	// ctrl+i can't be told apart from Tab, which switches the views
+	if err := g.SetKeybinding(treeView, gocui.KeyCtrlP, gocui.ModNone, historyMovement(1)); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'm', gocui.ModNone, openMark); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, '\'', gocui.ModNone, openJump); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, 'M', gocui.ModNone, openMarks); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(treeView, '$', gocui.ModNone, openQuery); err != nil {
+		log.Panicln(err)
+	}
+	for _, view := range documentViews {
+		if err := g.SetKeybinding(view, '|', gocui.ModNone, openTransform); err != nil {
+			log.Panicln(err)
+		}
+	}
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyCtrlY, gocui.KeyArrowUp}, resultsMovement(-1))
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyCtrlE, gocui.KeyArrowDown}, resultsMovement(1))
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyCtrlU, gocui.KeyPgup, gocui.KeyCtrlB}, resultsMovement(-15))
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyCtrlD, gocui.KeyPgdn, gocui.KeyCtrlF}, resultsMovement(15))
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyEnter}, jumpToResult)
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{gocui.KeyEsc, 'q'}, closeResultsView)
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{'c'}, copyResults)
+	internal.MultiSetKeybinding(g, resultsView, []interface{}{'$'}, openQuery)
+	internal.MultiSetKeybinding(g, marksView, []interface{}{gocui.KeyCtrlY, gocui.KeyArrowUp}, marksMovement(-1))
+	internal.MultiSetKeybinding(g, marksView, []interface{}{gocui.KeyCtrlE, gocui.KeyArrowDown}, marksMovement(1))
+	internal.MultiSetKeybinding(g, marksView, []interface{}{gocui.KeyEnter}, jumpToSelectedMark)
+	internal.MultiSetKeybinding(g, marksView, []interface{}{gocui.KeyEsc, 'q', 'M'}, closeMarksView)
+	internal.MultiSetKeybinding(g, marksView, []interface{}{'d'}, deleteMark)
+	if err := g.SetKeybinding(promptView, gocui.KeyEnter, gocui.ModNone, submitPrompt); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(promptView, gocui.KeyTab, gocui.ModNone, completePrompt); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(promptView, gocui.KeyCtrlR, gocui.ModNone, applyPrompt); err != nil {
 		log.Panicln(err)
 	}
-	if err := g.SetKeybinding("", '?', gocui.ModNone, toggleHelp); err != nil {
+	if err := g.SetKeybinding(promptView, gocui.KeyCtrlT, gocui.ModNone, toggleMatchMode); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(promptView, gocui.KeyCtrlK, gocui.ModNone, toggleMatchScope); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(promptView, gocui.KeyEsc, gocui.ModNone, cancelPrompt); err != nil {
 		log.Panicln(err)
 	}
 	g.SelFgColor = gocui.ColorBlack
@@ -215,6 +333,7 @@ func layout(g *gocui.Gui) error {
 			v.SelBgColor = gocui.ColorGreen
 			v.Title = " " + view + " "
 			if v.Name() == treeView {
+				v.Title = treeTitle()
 				v.Highlight = true
 				if err := treeController.Draw(v); err != nil {
 					return err
@@ -224,16 +343,30 @@ func layout(g *gocui.Gui) error {
 				if err := textController.Draw(v); err != nil {
 					return err
 				}
-				v.Title = fmt.Sprintf(` %s [lines=%d]`, view, len(textController.Lines))
+				v.Title = textTitle()
 			}
 			if v.Name() == pathView {
 				v.Wrap = true
+				internal.Printf(v, duplicateSummary)
 			}
 		}
 		if view == textView {
+			// the line count of a large node grows as it is scrolled
+			if v, err := g.View(textView); err == nil {
+				v.Title = textTitle()
+			}
 			drawLocation(g, x1, y1)
 		}
 	}
+	if err := drawPrompt(g, maxX, maxY); err != nil {
+		return err
+	}
+	if err := drawResults(g, maxX, maxY); err != nil {
+		return err
+	}
+	if err := drawMarks(g, maxX, maxY); err != nil {
+		return err
+	}
 	if err := drawHelp(g, maxX, maxY); err != nil {
 		return err
 	}
@@ -248,13 +381,25 @@ func layout(g *gocui.Gui) error {
 
 }
 func getPath(g *gocui.Gui) string {
-	p := findTreePosition(g)
-	for i, s := range p {
-		transformed := s
-		if !strings.HasPrefix(s, "[") && !strings.HasSuffix(s, "]") {
-			transformed = fmt.Sprintf("[%q]", s)
+	return formatPath(tree, findTreePosition(g))
+}
+
+// formatPath formats a position of root like ["key"][0], whether a segment is
+// an array index is decided by the node it is looked up in, so object keys
+// such as "[0]" are quoted as well.
+func formatPath(root treeNode, position treePosition) string {
+	p := make([]string, len(position))
+	node := root
+	for i, s := range position {
+		if _, isList := node.(*listNode); isList {
+			index, _ := parseListIndex(s)
+			p[i] = fmt.Sprintf("[%d]", index)
+		} else {
+			p[i] = fmt.Sprintf("[%q]", s)
+		}
+		if node != nil {
+			node = node.find(treePosition{s})
 		}
-		p[i] = transformed
 	}
 	return strings.Join(p, "")
 }
@@ -262,121 +407,178 @@ func getPath(g *gocui.Gui) string {
 func drawPath(g *gocui.Gui) error {
 	pv, err := g.View(pathView)
 	if err != nil {
-		log.Fatal("failed to get pathView", err)
+		return err
+	}
+	pv.Title = " " + pathView + " "
+	if loading != nil {
+		pv.Title = loading.progress.String()
 	}
 	p := getPath(g)
+	if p == "" {
+		p = duplicateSummary
+	}
 	if formatData {
 		p = p + " (EnableFormat)"
 	}
+	if status := filterStatus(); status != "" {
+		p = p + " (" + status + ")"
+	}
+	if status := treeSearch.status(); status != "" {
+		p = p + " (" + status + ")"
+	}
+	if status := marksStatus(findTreePosition(g)); status != "" {
+		p = p + " (" + status + ")"
+	}
+	if status := visited.status(); status != "" {
+		p = p + " (" + status + ")"
+	}
+	if status := transformStatus(); status != "" {
+		p = p + " (" + status + ")"
+	}
+	return drawMessage(g, p)
+}
+
+func drawMessage(g *gocui.Gui, msg string) error {
+	pv, err := g.View(pathView)
+	if err != nil {
+		return err
+	}
 	pv.Clear()
 	pv.SetOrigin(0, 0)
 	pv.SetCursor(0, 0)
-	internal.Printf(pv, p)
+	internal.Printf(pv, msg)
 	return nil
 }
 
+// drawJSON renders the text of the selected node in the background.
 func drawJSON(g *gocui.Gui) error {
+	if node := findTreeNode(g); node != nil {
+		renderer.render(g, node, formatData)
+	}
+	return nil
+}
+
+// showText replaces the text view with lines.
+func showText(g *gocui.Gui, lines internal.LineSource) error {
 	dv, err := g.View(textView)
 	if err != nil {
 		return err
 	}
-	path := findTreePosition(g)
-	if len(path) == 0 {
-		return rootTextController.Draw(dv)
-	}
-	treeToDraw := tree.find(path)
-	if treeToDraw == nil {
-		return nil
-	}
-	var data = ""
-	if err := internal.RunWithTimeout(context.Background(), time.Second, func() error {
-		data = treeToDraw.String(jsonPadding)
-		return nil
-	}); err != nil {
-		return textController.ReDraw(dv, []byte("Error: 超时"))
+	textController.Clear()
+	textController.Source = lines
+	if err := textController.Draw(dv); err != nil {
+		return err
 	}
-	if formatData {
-		data = internal.FormatData(data)
+	if err := dv.SetOrigin(0, 0); err != nil {
+		return err
 	}
-	if err := textController.ReDraw(dv, internal.String2Bytes(data)); err != nil {
+	if err := dv.SetCursor(0, 0); err != nil {
 		return err
 	}
-	dv.Title = fmt.Sprintf(" text [lines=%d] ", len(textController.Lines))
+	dv.Title = textTitle()
 	return nil
 }
 
-func countIndex(s string) int {
-	count := 0
-	for _, c := range s {
-		if c == ' ' {
-			count++
-		}
+func textTitle() string {
+	name := textView
+	if renderer.transform != nil {
+		name += " | jq"
 	}
-	return count
+	if renderer.loading {
+		return " " + name + " [loading] "
+	}
+	if lines, isOk := textController.Source.(*jsonLines); isOk && !lines.Complete() {
+		return fmt.Sprintf(" %s [lines=%d+] ", name, textController.Len())
+	}
+	return fmt.Sprintf(" %s [lines=%d] ", name, textController.Len())
 }
 
-var cleanPatterns = []string{
-	treeSignUpEnding,
-	treeSignDash,
-	treeSignUpMiddle,
-	treeSignVertical,
-	" (+)",
+// findTreePosition returns the position of the row under the cursor.
+func findTreePosition(g *gocui.Gui) treePosition {
+	v, err := g.View(treeView)
+	if err != nil {
+		log.Fatal("failed to get treeview", err)
+	}
+	return treeLines.position(treeController.Index(v))
 }
 
-func findTreePosition(g *gocui.Gui) treePosition {
+// findTreeNode returns the node of the row under the cursor.
+func findTreeNode(g *gocui.Gui) treeNode {
 	v, err := g.View(treeView)
 	if err != nil {
 		log.Fatal("failed to get treeview", err)
 	}
-	path := treePosition{}
-	ci := -1
-	_, yCurrent := v.Cursor()
-	y := treeController.Origin + yCurrent
-	for cy := y; cy >= 0; cy-- {
-		line := string(treeController.Lines[cy])
-		for _, pattern := range cleanPatterns {
-			line = strings.Replace(line, pattern, "", -1)
-		}
-		if count := countIndex(line); count < ci || ci == -1 {
-			path = append(path, strings.TrimSpace(line))
-			ci = count
-		}
+	return treeLines.node(treeController.Index(v))
+}
+
+// showPosition moves the tree cursor to the node at position, expanding its
+// ancestors. The cursor stays where it is if there is no such node.
+func showPosition(g *gocui.Gui, position treePosition) error {
+	index := treeLines.reveal(position)
+	if index < 0 {
+		return drawPath(g)
+	}
+	tv, err := g.View(treeView)
+	if err != nil {
+		return err
 	}
-	for i := len(path)/2 - 1; i >= 0; i-- {
-		opp := len(path) - 1 - i
-		path[i], path[opp] = path[opp], path[i]
+	if err := treeController.Show(tv, index); err != nil {
+		return err
 	}
-
-	return path[1:]
+	_ = drawJSON(g)
+	return drawPath(g)
 }
 
-func drawTree(g *gocui.Gui, tree treeNode) error {
+func drawTree(g *gocui.Gui) error {
 	tv, err := g.View(treeView)
 	if err != nil {
 		log.Fatal("failed to get treeView", err)
 	}
-	buf := bytes.NewBuffer(make([]byte, 0, 1024*1024))
-	if err := tree.draw(buf, 0); err != nil {
-		return err
-	}
-	return treeController.ReDraw(tv, buf.Bytes())
+	return treeController.Refresh(tv)
 }
 
 func expandAll(g *gocui.Gui) error {
+	if tree == nil {
+		return nil
+	}
 	tree.expandAll()
-	return drawTree(g, tree)
+	treeLines = newRows()
+	treeController.Source = treeLines
+	return drawTree(g)
 }
 
 func collapseAll(g *gocui.Gui) error {
+	if tree == nil {
+		return nil
+	}
 	tree.collapseAll()
-	return drawTree(g, tree)
+	treeLines = newRows()
+	treeController.Source = treeLines
+	return drawTree(g)
+}
+
+// expandDepth expands the selected node, the whole tree from the root, down
+// to depth levels below it and collapses the levels under them.
+func expandDepth(depth int) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		node := findTreeNode(g)
+		if node == nil {
+			return nil
+		}
+		position := findTreePosition(g)
+		expandToDepth(node, depth, treeIndex)
+		treeLines = newRows()
+		treeController.Source = treeLines
+		if err := drawTree(g); err != nil {
+			return err
+		}
+		return showPosition(g, position)
+	}
 }
 
 func toggleExpand(g *gocui.Gui, v *gocui.View) error {
-	p := findTreePosition(g)
-	subTree := tree.find(p)
-	subTree.toggleExpanded()
-	return drawTree(g, tree)
+	treeLines.toggle(treeController.Index(v))
+	return drawTree(g)
 }
 
 func cursorMovement(d int) func(g *gocui.Gui, v *gocui.View) error {
@@ -403,6 +605,69 @@ func switchView(gui *gocui.Gui, view *gocui.View) error {
 	return nil
 }
 
+// reloadTree replaces the current document and redraws every view from scratch.
+func reloadTree(g *gocui.Gui, newTree treeNode) error {
+	treeIndex = nil
+	if err := showTree(g, newTree); err != nil {
+		return err
+	}
+	return showDuplicates(g, duplicateKeys(newTree, treePosition{}))
+}
+
+// showTree replaces the current document, its duplicate keys are reported
+// later with showDuplicates.
+func showTree(g *gocui.Gui, newTree treeNode) error {
+	tree = newTree
+	expandAllStatus = true
+	treeSearch.reset()
+	treeFilter.reset()
+	filterMatches = nil
+	querying.stop()
+	closeResults(g)
+	refreshMarks(g)
+	initDuplicateSummary(nil)
+	treeController.Clear()
+	if err := initController(); err != nil {
+		return err
+	}
+	tv, err := g.View(treeView)
+	if err != nil {
+		return err
+	}
+	if err := treeController.Draw(tv); err != nil {
+		return err
+	}
+	_ = tv.SetOrigin(0, 0)
+	_ = tv.SetCursor(0, 0)
+	tv.Title = treeTitle()
+	renderer.stop()
+	if err := showText(g, nil); err != nil {
+		return err
+	}
+	if err := drawJSON(g); err != nil {
+		return err
+	}
+	return drawPath(g)
+}
+
+func showDuplicates(g *gocui.Gui, positions []treePosition) error {
+	initDuplicateSummary(positions)
+	tv, err := g.View(treeView)
+	if err != nil {
+		return err
+	}
+	tv.Title = treeTitle()
+	return drawPath(g)
+}
+
+func reloadFromClipboard(g *gocui.Gui, v *gocui.View) error {
+	newTree, err := fromClipboard(decodeInput)
+	if err != nil {
+		return drawMessage(g, "Error: failed to load clipboard, "+err.Error())
+	}
+	return reloadTree(g, newTree)
+}
+
 func formatView(gui *gocui.Gui, view *gocui.View) error {
 	formatData = !formatData
 	drawJSON(gui)
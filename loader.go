@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/atotto/clipboard"
+	"github.com/jroimartin/gocui"
+)
+
+// builtNodes counts the nodes created by the parser, it is accessed atomically.
+var builtNodes int64
+
+// loading is the loader of the document while it is being loaded, it is only
+// accessed by the UI goroutine.
+var loading *treeLoader
+
+const (
+	loadRedrawInterval = 100 * time.Millisecond
+	// loadBatchInterval is how often the decoded top-level children are
+	// handed to the UI.
+	loadBatchInterval = 50 * time.Millisecond
+	// loadBatchSize is the most top-level children handed to the UI at once.
+	loadBatchSize = 64 * 1024
+)
+
+// loadProgress is updated by the loader goroutine and drawn by the UI.
+type loadProgress struct {
+	start time.Time
+	done  int64 // bytes read or parsed, accessed atomically
+	total int64 // size of the input if known, accessed atomically
+
+	lock  sync.Mutex
+	phase string
+	err   error
+}
+
+func (p *loadProgress) setPhase(phase string, done, total int64) {
+	p.lock.Lock()
+	p.phase = phase
+	p.lock.Unlock()
+	atomic.StoreInt64(&p.done, done)
+	atomic.StoreInt64(&p.total, total)
+}
+
+func (p *loadProgress) fail(err error) {
+	p.lock.Lock()
+	p.err = err
+	p.lock.Unlock()
+}
+
+func (p *loadProgress) String() string {
+	p.lock.Lock()
+	phase, err := p.phase, p.err
+	p.lock.Unlock()
+	if err != nil {
+		return fmt.Sprintf(" Error: %v (q to quit) ", err)
+	}
+	done, total := atomic.LoadInt64(&p.done), atomic.LoadInt64(&p.total)
+	size := ""
+	if done > 0 {
+		size = " " + formatSize(done)
+	}
+	if total > 0 {
+		const width = 20
+		filled := int(done * width / total)
+		size = fmt.Sprintf(" [%s%s] %d%% %s/%s", strings.Repeat("#", filled), strings.Repeat("-", width-filled),
+			done*100/total, formatSize(done), formatSize(total))
+	}
+	return fmt.Sprintf(" %s%s, %d nodes, %s (q to cancel) ", phase, size, atomic.LoadInt64(&builtNodes),
+		time.Since(p.start).Truncate(loadRedrawInterval))
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// treeLoader reads and decodes the input in the background while the UI is
+// already up. A JSON document is decoded one top-level child at a time, the
+// children can be browsed as soon as they are decoded.
+type treeLoader struct {
+	read      func(ctx context.Context, progress *loadProgress) ([]byte, error)
+	transcode func([]byte) ([]byte, error) // converts the input to UTF-8, nil if it already is
+	decode    decodeFunc                   // nil for JSON, which is streamed
+	index     string                       // file to keep an index of, see fileIndex
+	depth     int                          // levels expanded initially, negative for the default
+	progress  loadProgress
+
+	lock    sync.Mutex
+	updates []func(*gocui.Gui) error
+}
+
+// update runs fn on the UI goroutine. gocui.Update doesn't keep the order of
+// the functions, so they are queued and every call runs the oldest one, the
+// views are redrawn in between.
+func (l *treeLoader) update(g *gocui.Gui, fn func(*gocui.Gui) error) {
+	l.lock.Lock()
+	l.updates = append(l.updates, fn)
+	l.lock.Unlock()
+	g.Update(func(g *gocui.Gui) error {
+		l.lock.Lock()
+		update := l.updates[0]
+		l.updates = l.updates[1:]
+		l.lock.Unlock()
+		return update(g)
+	})
+}
+
+// run loads the document, it is meant to run in its own goroutine and only
+// touches the UI through gocui.Update.
+func (l *treeLoader) run(ctx context.Context, g *gocui.Gui) {
+	l.progress.start = time.Now()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(loadRedrawInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				g.Update(drawPath)
+			}
+		}
+	}()
+	if err := l.load(ctx, g); err != nil {
+		if ctx.Err() == nil {
+			// keep showing the error until the user quits
+			l.progress.fail(err)
+			l.update(g, drawPath)
+		}
+		return
+	}
+	l.update(g, func(g *gocui.Gui) error {
+		if loading == l {
+			loading = nil
+		}
+		return drawPath(g)
+	})
+}
+
+func (l *treeLoader) load(ctx context.Context, g *gocui.Gui) error {
+	// the file is indexed as it was before it was read
+	var current *fileIndex
+	if l.index != "" {
+		current, _ = newFileIndex(l.index)
+	}
+	data, err := l.read(ctx, &l.progress)
+	if err != nil {
+		return err
+	}
+	if l.transcode != nil {
+		l.progress.setPhase("decoding", 0, 0)
+		if data, err = l.transcode(data); err != nil {
+			return err
+		}
+	}
+	var root treeNode
+	var positions []treePosition
+	if l.decode != nil {
+		l.progress.setPhase("parsing", 0, 0)
+		if root, err = l.decode(data); err != nil {
+			return err
+		}
+		if l.depth >= 0 {
+			expandToDepth(root, l.depth, nil)
+		}
+		l.update(g, func(g *gocui.Gui) error {
+			return showTree(g, root)
+		})
+		l.progress.setPhase("checking duplicate keys", 0, 0)
+		positions = duplicateKeys(root, treePosition{})
+	} else if root, positions, err = l.streamIndexed(ctx, g, bytes.TrimSpace(data), current); err != nil {
+		return err
+	}
+	l.update(g, func(g *gocui.Gui) error {
+		if tree != root {
+			// replaced in the meantime, e.g. from the clipboard
+			return nil
+		}
+		return showDuplicates(g, positions)
+	})
+	return nil
+}
+
+// streamIndexed opens the JSON document from the index of the file if it has
+// one, otherwise it streams the document and writes its index. current is the
+// state of the file, nil if it is not indexed. Indexing is only worth it for
+// documents whose children are built lazily.
+func (l *treeLoader) streamIndexed(ctx context.Context, g *gocui.Gui, data []byte, current *fileIndex) (treeNode, []treePosition, error) {
+	if current == nil || len(data) <= lazyExpandSize {
+		return l.stream(ctx, g, data, nil)
+	}
+	l.progress.setPhase("reading index", 0, 0)
+	if index, err := readFileIndex(current); err == nil && index.open(data) == nil {
+		root, err := l.openIndexed(ctx, g, data, index)
+		if err != errInvalidIndex {
+			return root, index.duplicates, err
+		}
+	}
+	builder := &indexBuilder{}
+	root, positions, err := l.stream(ctx, g, data, builder)
+	if err != nil {
+		return nil, nil, err
+	}
+	l.progress.setPhase("writing index", 0, 0)
+	current.length, current.containers, current.duplicates = len(data), builder.containers, positions
+	// the document is fine without an index, it is written again next time
+	_ = current.write()
+	return root, positions, nil
+}
+
+// openIndexed shows the document from its index, the top-level children are
+// handed to the UI in batches like stream does.
+func (l *treeLoader) openIndexed(ctx context.Context, g *gocui.Gui, data []byte, index *fileIndex) (treeNode, error) {
+	container := index.byStart[&data[0]]
+	l.update(g, func(g *gocui.Gui) error {
+		treeIndex = index
+		return nil
+	})
+	root := l.showRoot(g, data[container.start:container.end])
+	batch := l.newRootBatch(ctx, g, root)
+	l.progress.setPhase("opening", 0, int64(len(data)))
+	// the duplicate keys of the root are named from all of its keys
+	names := newObjectKeys(nil)
+	if data[container.start] == '{' {
+		keys := make([]string, 0, container.count)
+		index.foreachChild(container, func(child indexChild) {
+			keys = append(keys, child.key)
+		})
+		names = newObjectKeys(keys)
+	}
+	var err error
+	i := 0
+	valid := index.foreachChild(container, func(child indexChild) {
+		if ctx.Err() != nil || err != nil {
+			return
+		}
+		name := child.key
+		if i < len(names.names) {
+			name = names.names[i]
+		}
+		i++
+		var node treeNode
+		if node, err = indexedNode(data[child.start:child.end]); err != nil {
+			return
+		}
+		// the root is larger than lazyExpandSize, its children start collapsed
+		l.expandChild(node, true, index)
+		batch.add(name, names.isDuplicate(name), node)
+		atomic.StoreInt64(&l.progress.done, int64(child.end))
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !valid || err != nil {
+		l.update(g, func(g *gocui.Gui) error {
+			treeIndex = nil
+			return nil
+		})
+		return nil, errInvalidIndex
+	}
+	batch.flush()
+	return root, nil
+}
+
+// streamChild is a top-level child decoded by stream. name is the name of its
+// key in the root object, see objectKeys, duplicate is set if it is a renamed
+// duplicate key.
+type streamChild struct {
+	name      string
+	duplicate bool
+	node      treeNode
+}
+
+// stream parses the top-level children of a JSON document one at a time and
+// hands them to the UI in batches, the duplicate keys are found on the way.
+// The large containers are added to index if it is set.
+func (l *treeLoader) stream(ctx context.Context, g *gocui.Gui, data []byte, index *indexBuilder) (treeNode, []treePosition, error) {
+	if len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		root, err := parseTree(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if l.depth >= 0 {
+			expandToDepth(root, l.depth, nil)
+		}
+		l.update(g, func(g *gocui.Gui) error {
+			return showTree(g, root)
+		})
+		return root, nil, nil
+	}
+	// the end of the root is only known once it is parsed, until then its
+	// text is drawn from the rest of the input
+	root := l.showRoot(g, data)
+	batch := l.newRootBatch(ctx, g, root)
+
+	l.progress.setPhase("parsing", 0, int64(len(data)))
+	positions := make([]treePosition, 0)
+	p := newJsonParser(data)
+	p.duplicates = &positions
+	p.index = index
+	levels := buildLevels(len(data)) - 1
+	err := p.foreachChild(func(key string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		child, err := p.parseValue(levels)
+		if err != nil {
+			return err
+		}
+		l.expandChild(child, len(data) > lazyExpandSize, nil)
+		atomic.StoreInt64(&l.progress.done, int64(p.pos))
+		// the parser names the duplicate keys while it looks for them
+		name := p.path[0].key
+		batch.add(name, name != key, child)
+		return nil
+	})
+	batch.flush()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := json.RawMessage(data[:p.pos])
+	l.update(g, func(g *gocui.Gui) error {
+		switch n := root.(type) {
+		case *complexNode:
+			n.raw = raw
+		case *listNode:
+			n.raw = raw
+		}
+		return nil
+	})
+	return root, positions, nil
+}
+
+// expandChild expands a top-level child to the depth of the loader, or else
+// collapses it if collapsed is set. index is the index of the document being
+// opened, if any.
+func (l *treeLoader) expandChild(child treeNode, collapsed bool, index *fileIndex) {
+	if l.depth >= 0 {
+		expandToDepth(child, l.depth-1, index)
+	} else if collapsed && child.isCollapsable() {
+		child.toggleExpanded()
+	}
+}
+
+// showRoot shows an empty root for the object or array raw, its children are
+// added with a rootBatch.
+func (l *treeLoader) showRoot(g *gocui.Gui, raw []byte) treeNode {
+	var root treeNode
+	if raw[0] == '{' {
+		root = &complexNode{baseTreeNode: baseTreeNode{true}, shape: newObjectKeys(nil), data: make([]treeNode, 0), raw: raw}
+	} else {
+		root = &listNode{baseTreeNode: baseTreeNode{true}, data: make([]treeNode, 0), raw: raw}
+	}
+	l.update(g, func(g *gocui.Gui) error {
+		return showTree(g, root)
+	})
+	return root
+}
+
+// rootBatch hands the top-level children to the UI in batches. A batch is
+// only handed over once the previous one has been added, so that the UI is
+// redrawn in between even when the children come faster than it adds them.
+type rootBatch struct {
+	ctx      context.Context
+	loader   *treeLoader
+	g        *gocui.Gui
+	root     treeNode
+	children []streamChild
+	last     time.Time
+	added    chan struct{} // closed once the previous batch has been added
+}
+
+func (l *treeLoader) newRootBatch(ctx context.Context, g *gocui.Gui, root treeNode) *rootBatch {
+	return &rootBatch{ctx: ctx, loader: l, g: g, root: root, last: time.Now()}
+}
+
+func (b *rootBatch) add(name string, duplicate bool, node treeNode) {
+	b.children = append(b.children, streamChild{name: name, duplicate: duplicate, node: node})
+	if len(b.children) >= loadBatchSize || time.Since(b.last) >= loadBatchInterval {
+		b.flush()
+	}
+}
+
+func (b *rootBatch) flush() {
+	if b.added != nil {
+		select {
+		case <-b.added:
+		case <-b.ctx.Done():
+			return
+		}
+	}
+	root, children, added := b.root, b.children, make(chan struct{})
+	b.children = make([]streamChild, 0, len(children))
+	b.added = added
+	b.loader.update(b.g, func(g *gocui.Gui) error {
+		defer close(added)
+		return appendRootChildren(g, root, children)
+	})
+	b.last = time.Now()
+}
+
+// appendRootChildren adds the top-level children decoded by the loader to
+// root and to the rows of the tree view.
+func appendRootChildren(g *gocui.Gui, root treeNode, children []streamChild) error {
+	if tree != root || len(children) == 0 {
+		return nil
+	}
+	var from int
+	switch n := root.(type) {
+	case *complexNode:
+		from = len(n.data)
+		for _, child := range children {
+			n.shape.add(child.name, child.duplicate)
+			n.data = append(n.data, child.node)
+		}
+	case *listNode:
+		from = len(n.data)
+		for _, child := range children {
+			n.data = append(n.data, child.node)
+		}
+	}
+	treeLines.appendRootChildren(from)
+	return drawTree(g)
+}
+
+func readClipboard(_ context.Context, _ *loadProgress) ([]byte, error) {
+	data, err := clipboard.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// readFile maps the file into memory, or reads it if it can't be mapped.
+func readFile(filename string) func(ctx context.Context, progress *loadProgress) ([]byte, error) {
+	return func(ctx context.Context, progress *loadProgress) ([]byte, error) {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if data, err := internal.Mmap(f); err == nil {
+			return data, nil
+		}
+		// pipes, devices and platforms without mmap
+		return readAll(ctx, f, progress)
+	}
+}
+
+func readStdin(ctx context.Context, progress *loadProgress) ([]byte, error) {
+	return readAll(ctx, os.Stdin, progress)
+}
+
+// readAll is io.ReadAll reporting the bytes read to progress.
+func readAll(ctx context.Context, r io.Reader, progress *loadProgress) ([]byte, error) {
+	progress.setPhase("reading", 0, 0)
+	data := make([]byte, 0, 512)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+		n, err := r.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		atomic.StoreInt64(&progress.done, int64(len(data)))
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
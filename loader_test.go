@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadAll(t *testing.T) {
+	input := strings.Repeat(`{"a": 1}`, 1000)
+	progress := &loadProgress{}
+	data, err := readAll(context.Background(), strings.NewReader(input), progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != input || progress.done != int64(len(input)) {
+		t.Fatalf("read %d bytes, progress %d, expected %d", len(data), progress.done, len(input))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := readAll(ctx, bytes.NewReader(data), progress); err == nil {
+		t.Fatalf("reading should stop once cancelled")
+	}
+}
+
+func TestLoadProgress(t *testing.T) {
+	progress := &loadProgress{}
+	progress.setPhase("parsing", 512, 2048)
+	if s := progress.String(); !strings.Contains(s, " parsing [#####---------------] 25% 512B/2.0KB, ") {
+		t.Fatalf("unexpected progress %q", s)
+	}
+	progress.setPhase("reading", 3<<20, 0)
+	if s := progress.String(); !strings.Contains(s, " reading 3.0MB, ") {
+		t.Fatalf("unexpected progress %q", s)
+	}
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
-	"os"
 
 	"github.com/jroimartin/gocui"
 )
@@ -12,18 +12,10 @@ func main() {
 	//go pprof.InitPProf()
 
 	flags := initFlag()
-	var err error
-	if flags.File != "" {
-		tree, err = fromFile(flags.File)
-	} else {
-		if !checkStdInFromPiped() {
-			flag.Usage()
-			return
-		}
-		tree, err = fromReader(os.Stdin)
-	}
-	if err != nil {
-		log.Panicln(err)
+	decodeInput = flags.decoder()
+	if !flags.Clipboard && flags.File == "" && !checkStdInFromPiped() {
+		flag.Usage()
+		return
 	}
 	g, err := gocui.NewGui(gocui.OutputNormal)
 	if err != nil {
@@ -33,6 +25,12 @@ func main() {
 
 	initGUI(g)
 
+	// the document is loaded in the background, quitting cancels it
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	loading = flags.loader()
+	go loading.run(ctx, g)
+
 	if err := g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		log.Panicln(err)
 	}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/jroimartin/gocui"
+)
+
+const marksView = "marks"
+
+// marks are the positions of the nodes marked by m<letter>, they are paths
+// rather than rows so they survive expanding, collapsing and reloading the
+// tree. markList is the bookmarks panel while it is open and marksOrigin the
+// position of the tree cursor when it was opened. They are only accessed by
+// the UI goroutine.
+var (
+	marks           = map[rune]treePosition{}
+	markList        *bookmarks
+	marksOrigin     treePosition
+	marksController internal.ViewBufferController
+)
+
+// bookmarks are the lines of the bookmarks panel, the letter of each mark
+// followed by its path and a preview of its value.
+type bookmarks struct {
+	letters []rune
+}
+
+func newBookmarks() *bookmarks {
+	letters := make([]rune, 0, len(marks))
+	for letter := range marks {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i] < letters[j]
+	})
+	return &bookmarks{letters: letters}
+}
+
+func (b *bookmarks) Len() int {
+	return len(b.letters)
+}
+
+func (b *bookmarks) Line(index int) []byte {
+	letter := b.letters[index]
+	return []byte(fmt.Sprintf("%c  %s\n", letter, describeMark(letter)))
+}
+
+func (b *bookmarks) title() string {
+	return " marks: " + plural(len(b.letters), "mark") + " (Enter jump, d delete, Esc close) "
+}
+
+// describeMark returns the path of a mark and a preview of its value.
+func describeMark(letter rune) string {
+	position := marks[letter]
+	path := "$" + formatPath(tree, position)
+	if node := markedNode(position); node != nil {
+		return path + " = " + previewNode(node)
+	}
+	return path + " (missing)"
+}
+
+// markedNode returns the node at a marked position, nil if the document has
+// no such node anymore.
+func markedNode(position treePosition) treeNode {
+	if tree == nil {
+		return nil
+	}
+	return tree.find(position)
+}
+
+func isMarkLetter(ch rune) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+// marksStatus lists the marks of the node at position for the path bar.
+func marksStatus(position treePosition) string {
+	letters := make([]string, 0)
+	for _, letter := range newBookmarks().letters {
+		if samePosition(marks[letter], position) {
+			letters = append(letters, string(letter))
+		}
+	}
+	if len(letters) == 0 {
+		return ""
+	}
+	return "mark " + strings.Join(letters, ", ")
+}
+
+func samePosition(a, b treePosition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// openLetterPrompt opens a prompt reading a single letter, which is passed
+// to fn once it is typed.
+func openLetterPrompt(g *gocui.Gui, title, status string, fn func(g *gocui.Gui, letter rune) error) error {
+	return openPrompt(g, &prompt{
+		title: func() string {
+			if status != "" {
+				return " " + title + " (" + status + ") "
+			}
+			return " " + title + " (a letter, Esc cancel) "
+		},
+		change: func(g *gocui.Gui, input string) error {
+			closePrompt(g)
+			letter := []rune(input)[0]
+			if !isMarkLetter(letter) {
+				return openLetterPrompt(g, title, fmt.Sprintf("%q is not a letter", letter), fn)
+			}
+			return fn(g, letter)
+		},
+	})
+}
+
+// openMark marks the selected node with the letter typed next.
+func openMark(g *gocui.Gui, v *gocui.View) error {
+	return openLetterPrompt(g, "mark", "", setMark)
+}
+
+func setMark(g *gocui.Gui, letter rune) error {
+	if tree == nil {
+		return nil
+	}
+	marks[letter] = findTreePosition(g)
+	refreshMarks(g)
+	return drawPath(g)
+}
+
+// openJump moves the tree cursor to the node marked with the letter typed
+// next.
+func openJump(g *gocui.Gui, v *gocui.View) error {
+	return openLetterPrompt(g, "jump to mark", "", jumpToMark)
+}
+
+func jumpToMark(g *gocui.Gui, letter rune) error {
+	position, isOk := marks[letter]
+	if !isOk {
+		return openLetterPrompt(g, "jump to mark", fmt.Sprintf("no mark %c", letter), jumpToMark)
+	}
+	if markedNode(position) == nil {
+		return openLetterPrompt(g, "jump to mark", fmt.Sprintf("%s no longer exists", describeMark(letter)), jumpToMark)
+	}
+	return jumpToPosition(g, position)
+}
+
+// openMarks opens the bookmarks panel over the text view.
+func openMarks(g *gocui.Gui, v *gocui.View) error {
+	closeResults(g)
+	// the tree follows the cursor of the panel, only the jump to a mark is
+	// recorded in the history
+	marksOrigin = nil
+	if tree != nil {
+		marksOrigin = findTreePosition(g)
+	}
+	markList = newBookmarks()
+	marksController.Clear()
+	marksController.Source = markList
+	currentViewName = marksView
+	return nil
+}
+
+// drawMarks draws the bookmarks panel over the text view.
+func drawMarks(g *gocui.Gui, maxX, maxY int) error {
+	if markList == nil {
+		return nil
+	}
+	x0, y0, x1, y1 := viewPositions[textView].getCoordinates(maxX, maxY)
+	v, err := g.SetView(marksView, x0, y0, x1, y1)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Highlight = true
+		v.SelFgColor = gocui.ColorBlack
+		v.SelBgColor = gocui.ColorGreen
+		if err := marksController.Draw(v); err != nil {
+			return err
+		}
+	}
+	v.Title = markList.title()
+	_, err = g.SetViewOnTop(marksView)
+	return err
+}
+
+// refreshMarks lists the marks again if the bookmarks panel is open, after
+// a mark or the document changed.
+func refreshMarks(g *gocui.Gui) {
+	if markList == nil {
+		return
+	}
+	markList = newBookmarks()
+	marksController.Source = markList
+	if v, err := g.View(marksView); err == nil {
+		_ = marksController.Refresh(v)
+	}
+}
+
+// selectedMark returns the letter of the mark under the cursor of the
+// bookmarks panel, 0 if there is none.
+func selectedMark(v *gocui.View) rune {
+	index := marksController.Index(v)
+	if index < 0 || index >= len(markList.letters) {
+		return 0
+	}
+	return markList.letters[index]
+}
+
+// marksMovement moves the cursor of the bookmarks panel by d lines, the tree
+// follows it.
+func marksMovement(d int) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		_ = marksController.MoveCursor(v, 0, d)
+		if letter := selectedMark(v); letter != 0 {
+			return showPosition(g, marks[letter])
+		}
+		return nil
+	}
+}
+
+// jumpToSelectedMark closes the bookmarks panel and moves the tree cursor
+// to the selected mark.
+func jumpToSelectedMark(g *gocui.Gui, v *gocui.View) error {
+	letter := selectedMark(v)
+	closeMarks(g)
+	if letter == 0 || markedNode(marks[letter]) == nil {
+		return drawPath(g)
+	}
+	recordJump(marksOrigin, marks[letter])
+	return revealPosition(g, marks[letter])
+}
+
+// deleteMark deletes the mark under the cursor of the bookmarks panel.
+func deleteMark(g *gocui.Gui, v *gocui.View) error {
+	letter := selectedMark(v)
+	if letter == 0 {
+		return nil
+	}
+	delete(marks, letter)
+	refreshMarks(g)
+	return drawPath(g)
+}
+
+func closeMarksView(g *gocui.Gui, v *gocui.View) error {
+	closeMarks(g)
+	return nil
+}
+
+// closeMarks hides the bookmarks panel and gives the focus back to the tree.
+func closeMarks(g *gocui.Gui) {
+	if markList == nil {
+		return
+	}
+	markList = nil
+	marksController.Clear()
+	_ = g.DeleteView(marksView)
+	if currentViewName == marksView {
+		currentViewName = treeView
+	}
+}
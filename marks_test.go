@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDescribeMark(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"b": [1, 2]}, "c": "d"}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	previousTree, previousMarks := tree, marks
+	defer func() {
+		tree, marks = previousTree, previousMarks
+	}()
+	tree = root
+	marks = map[rune]treePosition{
+		'a': {"a", "b"},
+		'b': {"a", "b", "[1]"},
+		'c': {"a", "b", "[2]"},
+		'd': {"a", "b"},
+	}
+	for letter, expected := range map[rune]string{
+		'a': `$["a"]["b"] = [2 items]`,
+		'b': `$["a"]["b"][1] = 2`,
+		'c': `$["a"]["b"][2] (missing)`,
+	} {
+		if description := describeMark(letter); description != expected {
+			t.Fatalf("unexpected description of mark %c: %s", letter, description)
+		}
+	}
+	if status := marksStatus(treePosition{"a", "b"}); status != "mark a, d" {
+		t.Fatalf("unexpected marks status: %s", status)
+	}
+	if status := marksStatus(treePosition{"c"}); status != "" {
+		t.Fatalf("unexpected marks status: %s", status)
+	}
+	if line := string(newBookmarks().Line(1)); line != "b  $[\"a\"][\"b\"][1] = 2\n" {
+		t.Fatalf("unexpected bookmark line: %q", line)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// matchMode is how the pattern of a search or filter is matched.
+type matchMode int
+
+const (
+	matchSubstring matchMode = iota
+	matchIgnoreCase
+	matchRegexp
+	matchFuzzy
+	matchModes
+)
+
+var matchModeNames = [matchModes]string{"substring", "ignore case", "regexp", "fuzzy"}
+
+// matchScope is what the pattern of a search or filter is matched against.
+type matchScope int
+
+const (
+	matchKeysAndValues matchScope = iota
+	matchKeys
+	matchValues
+	matchScopes
+)
+
+var matchScopeNames = [matchScopes]string{"keys and values", "keys", "values"}
+
+// matchOptions are toggled in the search and filter prompts.
+type matchOptions struct {
+	mode  matchMode
+	scope matchScope
+}
+
+// searchOptions are the options of the search and filter prompts, they are
+// only accessed by the UI goroutine.
+var searchOptions matchOptions
+
+func (o matchOptions) String() string {
+	return matchModeNames[o.mode] + ", " + matchScopeNames[o.scope]
+}
+
+// matcher matches the keys and the scalar values of a document against a
+// pattern.
+type matcher struct {
+	matchOptions
+	pattern string
+	re      *regexp.Regexp // for regexp and ignore case
+	fuzzy   []rune         // lower case pattern for fuzzy
+}
+
+func newMatcher(pattern string, options matchOptions) (*matcher, error) {
+	m := &matcher{matchOptions: options, pattern: pattern}
+	var err error
+	switch options.mode {
+	case matchIgnoreCase:
+		m.re, err = regexp.Compile("(?i)" + regexp.QuoteMeta(pattern))
+	case matchRegexp:
+		m.re, err = regexp.Compile(pattern)
+	case matchFuzzy:
+		for _, r := range pattern {
+			m.fuzzy = append(m.fuzzy, unicode.ToLower(r))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// keys reports whether the keys are matched.
+func (m *matcher) keys() bool {
+	return m.scope != matchValues
+}
+
+// values reports whether the values are matched.
+func (m *matcher) values() bool {
+	return m.scope != matchKeys
+}
+
+func (m *matcher) match(text string) bool {
+	switch m.mode {
+	case matchIgnoreCase, matchRegexp:
+		return m.re.MatchString(text)
+	case matchFuzzy:
+		_, isOk := fuzzyEnd(text, m.fuzzy)
+		return isOk
+	}
+	return strings.Contains(text, m.pattern)
+}
+
+// score rates a matching text, only fuzzy matches have different scores.
+func (m *matcher) score(text string) int {
+	if m.mode != matchFuzzy {
+		return 0
+	}
+	score, _, _ := fuzzyMatch(text, m.fuzzy)
+	return score
+}
+
+// highlights returns the byte ranges of text which match, in order.
+func (m *matcher) highlights(text string) [][2]int {
+	var ranges [][2]int
+	switch m.mode {
+	case matchIgnoreCase, matchRegexp:
+		for _, r := range m.re.FindAllStringIndex(text, -1) {
+			if r[0] < r[1] {
+				ranges = append(ranges, [2]int{r[0], r[1]})
+			}
+		}
+	case matchFuzzy:
+		_, positions, isOk := fuzzyMatch(text, m.fuzzy)
+		if !isOk {
+			return nil
+		}
+		for _, p := range positions {
+			_, size := utf8.DecodeRuneInString(text[p:])
+			if n := len(ranges); n > 0 && ranges[n-1][1] == p {
+				ranges[n-1][1] = p + size
+				continue
+			}
+			ranges = append(ranges, [2]int{p, p + size})
+		}
+	default:
+		if m.pattern == "" {
+			return nil
+		}
+		for start := 0; ; {
+			i := strings.Index(text[start:], m.pattern)
+			if i < 0 {
+				break
+			}
+			start += i
+			ranges = append(ranges, [2]int{start, start + len(m.pattern)})
+			start += len(m.pattern)
+		}
+	}
+	return ranges
+}
+
+// The scores of fuzzyMatch, like the ones of fzf.
+const (
+	fuzzyScoreMatch        = 16
+	fuzzyScoreGapStart     = -3
+	fuzzyScoreGapExtension = -1
+	fuzzyBonusBoundary     = fuzzyScoreMatch / 2
+	fuzzyBonusNonWord      = fuzzyScoreMatch / 2
+	fuzzyBonusCamel        = fuzzyBonusBoundary - 1
+	fuzzyBonusConsecutive  = -(fuzzyScoreGapStart + fuzzyScoreGapExtension)
+	fuzzyBonusFirstChar    = 2 // multiplier of the bonus of the first rune
+)
+
+type runeClass int
+
+const (
+	runeNonWord runeClass = iota
+	runeLower
+	runeUpper
+	runeDigit
+)
+
+func classOf(r rune) runeClass {
+	switch {
+	case unicode.IsLower(r):
+		return runeLower
+	case unicode.IsUpper(r):
+		return runeUpper
+	case unicode.IsDigit(r):
+		return runeDigit
+	case unicode.IsLetter(r):
+		return runeLower
+	}
+	return runeNonWord
+}
+
+// fuzzyBonus is the bonus of a matching rune of class class following a rune
+// of class previous: the start of a word, of a camel case hump or of a number
+// is worth more than the middle of a word.
+func fuzzyBonus(previous, class runeClass) int {
+	switch {
+	case previous == runeNonWord && class != runeNonWord:
+		return fuzzyBonusBoundary
+	case previous == runeLower && class == runeUpper, previous != runeDigit && class == runeDigit:
+		return fuzzyBonusCamel
+	case class == runeNonWord:
+		return fuzzyBonusNonWord
+	}
+	return 0
+}
+
+// fuzzyEnd returns the byte offset after the first occurrence of the runes of
+// pattern in text, in order and ignoring case.
+func fuzzyEnd(text string, pattern []rune) (int, bool) {
+	if len(pattern) == 0 {
+		return 0, true
+	}
+	i := 0
+	for offset, r := range text {
+		if unicode.ToLower(r) == pattern[i] {
+			if i++; i == len(pattern) {
+				return offset + utf8.RuneLen(r), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// fuzzyMatch matches the runes of pattern in text like fzf does: the first
+// occurrence of the runes in order is narrowed down to its shortest suffix
+// which still has all of them, which is then scored. It returns the score and
+// the byte offset of each matched rune.
+func fuzzyMatch(text string, pattern []rune) (int, []int, bool) {
+	end, isOk := fuzzyEnd(text, pattern)
+	if !isOk || len(pattern) == 0 {
+		return 0, nil, isOk
+	}
+	// look for the pattern backwards from the end of the first occurrence
+	start, i := end, len(pattern)-1
+	for i >= 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+		if unicode.ToLower(r) == pattern[i] {
+			i--
+		}
+	}
+
+	previous := runeNonWord
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		previous = classOf(r)
+	}
+	score, consecutive, firstBonus, inGap := 0, 0, 0, false
+	positions := make([]int, 0, len(pattern))
+	for offset, r := range text[start:end] {
+		class := classOf(r)
+		if len(positions) < len(pattern) && unicode.ToLower(r) == pattern[len(positions)] {
+			bonus := fuzzyBonus(previous, class)
+			if consecutive == 0 {
+				firstBonus = bonus
+			} else {
+				if bonus == fuzzyBonusBoundary {
+					firstBonus = bonus
+				}
+				bonus = maxInts(bonus, firstBonus, fuzzyBonusConsecutive)
+			}
+			if len(positions) == 0 {
+				bonus *= fuzzyBonusFirstChar
+			}
+			score += fuzzyScoreMatch + bonus
+			positions = append(positions, start+offset)
+			consecutive++
+			inGap = false
+		} else {
+			if inGap {
+				score += fuzzyScoreGapExtension
+			} else {
+				score += fuzzyScoreGapStart
+			}
+			inGap, consecutive, firstBonus = true, 0, 0
+		}
+		previous = class
+	}
+	return score, positions, true
+}
+
+func maxInts(v int, others ...int) int {
+	for _, o := range others {
+		if o > v {
+			v = o
+		}
+	}
+	return v
+}
+
+// highlightColor is the escape sequence starting the highlighted parts of the
+// rows, in bold yellow.
+const (
+	highlightColor = "\x1b[33;1m"
+	resetColor     = "\x1b[0m"
+)
+
+// highlightText colors the ranges of text, see matcher.highlights.
+func highlightText(text string, ranges [][2]int) string {
+	if len(ranges) == 0 {
+		return text
+	}
+	var result strings.Builder
+	last := 0
+	for _, r := range ranges {
+		result.WriteString(text[last:r[0]])
+		result.WriteString(highlightColor)
+		result.WriteString(text[r[0]:r[1]])
+		result.WriteString(resetColor)
+		last = r[1]
+	}
+	result.WriteString(text[last:])
+	return result.String()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		mode     matchMode
+		text     string
+		match    bool
+		expected string // highlights of text
+	}{
+		{"na", matchSubstring, "banana", true, "[[2 4] [4 6]]"},
+		{"Na", matchSubstring, "banana", false, "[]"},
+		{"Na", matchIgnoreCase, "baNAna", true, "[[2 4] [4 6]]"},
+		{"a.", matchIgnoreCase, "banana", false, "[]"},
+		{"^b|n.$", matchRegexp, "banana", true, "[[0 1] [4 6]]"},
+		{"bnn", matchFuzzy, "BaNaNa", true, "[[0 1] [2 3] [4 5]]"},
+		{"nab", matchFuzzy, "banana", false, "[]"},
+		{"éa", matchFuzzy, "caféBar", true, "[[3 5] [6 7]]"},
+	} {
+		m, err := newMatcher(test.pattern, matchOptions{mode: test.mode})
+		if err != nil {
+			t.Fatalf("failed to compile %q: %v", test.pattern, err)
+		}
+		if m.match(test.text) != test.match {
+			t.Fatalf("expected %q (%s) matching %q to be %v", test.pattern, matchModeNames[test.mode], test.text, test.match)
+		}
+		if ranges := fmt.Sprint(m.highlights(test.text)); ranges != test.expected {
+			t.Fatalf("expected the highlights of %q (%s) in %q to be %s, got %s",
+				test.pattern, matchModeNames[test.mode], test.text, test.expected, ranges)
+		}
+	}
+	if _, err := newMatcher("(", matchOptions{mode: matchRegexp}); err == nil {
+		t.Fatalf("expected an invalid regexp to fail")
+	}
+	if _, err := newMatcher("(", matchOptions{mode: matchIgnoreCase}); err != nil {
+		t.Fatalf("expected ignore case to match the pattern literally, got %v", err)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	pattern := []rune("fb")
+	// the first occurrence is narrowed down to its shortest suffix
+	_, positions, isOk := fuzzyMatch("f_foo_bar", pattern)
+	if !isOk || fmt.Sprint(positions) != "[2 6]" {
+		t.Fatalf("unexpected positions %v", positions)
+	}
+	// the start of words and consecutive runes score better than gaps
+	for _, better := range [][2]string{
+		{"foo_bar", "foobar"},
+		{"fooBar", "foobar"},
+		{"fb", "f_b"},
+		{"fbx", "xfb"},
+	} {
+		first, _, _ := fuzzyMatch(better[0], pattern)
+		second, _, _ := fuzzyMatch(better[1], pattern)
+		if first <= second {
+			t.Fatalf("expected %q (%d) to score better than %q (%d)", better[0], first, better[1], second)
+		}
+	}
+}
+
+func TestHighlightText(t *testing.T) {
+	text := highlightText("banana", [][2]int{{0, 1}, {4, 6}})
+	if expected := highlightColor + "b" + resetColor + "ana" + highlightColor + "na" + resetColor; text != expected {
+		t.Fatalf("unexpected highlighted text %q", text)
+	}
+	if text := highlightText("banana", nil); text != "banana" {
+		t.Fatalf("unexpected highlighted text %q", text)
+	}
+}
+
+func TestDrawnName(t *testing.T) {
+	tree, err := fromBytes([]byte(`{"name": "x", "list": ["name", 1], "other": "a name"}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	tree.expandAll()
+	rows := newTreeRows(tree)
+	highlighted := func(scope matchScope) []string {
+		rows.highlight, _ = newMatcher("name", matchOptions{scope: scope})
+		names := make([]string, 0, len(rows.rows))
+		for _, row := range rows.rows[1:] {
+			names = append(names, rows.drawnName(row))
+		}
+		return names
+	}
+	on := func(text string) string {
+		return highlightColor + text + resetColor
+	}
+	for scope, expected := range map[matchScope][]string{
+		matchKeysAndValues: {on("name"), "list", on("[0]"), "[1]", on("other")},
+		matchKeys:          {on("name"), "list", "[0]", "[1]", "other"},
+		matchValues:        {"name", "list", on("[0]"), "[1]", on("other")},
+	} {
+		if names := highlighted(scope); fmt.Sprintf("%q", names) != fmt.Sprintf("%q", expected) {
+			t.Fatalf("unexpected names matching %s: %q", matchScopeNames[scope], names)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+)
+
+// childCount returns the number of children of an object or an array.
+func childCount(node treeNode) int {
+	switch n := node.(type) {
+	case *complexNode:
+		return len(n.keys())
+	case *listNode:
+		n.load()
+		return len(n.data)
+	}
+	return 0
+}
+
+// hasChildren reports whether node is an object or an array with children,
+// the children aren't built if they haven't been yet.
+func hasChildren(node treeNode) bool {
+	var data []treeNode
+	var raw []byte
+	switch n := node.(type) {
+	case *complexNode:
+		data, raw = n.data, n.raw
+	case *listNode:
+		data, raw = n.data, n.raw
+	default:
+		return false
+	}
+	if data != nil {
+		return len(data) > 0
+	}
+	// raw has been validated by the parser, it is not empty if anything but
+	// spaces follows its { or [
+	i := skipSpace(raw, 1)
+	return i < len(raw) && raw[i] != '}' && raw[i] != ']'
+}
+
+// keyAt returns the key of the child of node at index, which must exist.
+func keyAt(node treeNode, index int) string {
+	if n, isOk := node.(*complexNode); isOk {
+		return n.keys()[index]
+	}
+	return fmt.Sprintf("[%d]", index)
+}
+
+// indexOf returns the index of the child of node at key, -1 if there is none.
+func indexOf(node treeNode, key string) int {
+	switch n := node.(type) {
+	case *complexNode:
+		n.load()
+		return n.shape.position(key)
+	case *listNode:
+		n.load()
+		if i, err := parseListIndex(key); err == nil && i >= 0 && i < len(n.data) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parentPosition returns the position of the parent of the node at position.
+func parentPosition(root treeNode, position treePosition) (treePosition, bool) {
+	if len(position) == 0 {
+		return nil, false
+	}
+	return position[:len(position)-1], true
+}
+
+// siblingPosition returns the position of the sibling d children after
+// (d > 0) or before (d < 0) the node at position.
+func siblingPosition(root treeNode, position treePosition, d int) (treePosition, bool) {
+	if len(position) == 0 {
+		return nil, false
+	}
+	parent := root.find(position[:len(position)-1])
+	i := indexOf(parent, position[len(position)-1]) + d
+	if i < 0 || i >= childCount(parent) {
+		return nil, false
+	}
+	return appendKey(position[:len(position)-1], keyAt(parent, i)), true
+}
+
+// childPosition returns the position of the first (d > 0) or the last (d < 0)
+// child of the node at position.
+func childPosition(root treeNode, position treePosition, d int) (treePosition, bool) {
+	node := root.find(position)
+	n := childCount(node)
+	if n == 0 {
+		return nil, false
+	}
+	if d > 0 {
+		return appendKey(position, keyAt(node, 0)), true
+	}
+	return appendKey(position, keyAt(node, n-1)), true
+}
+
+// depthPosition returns the position of the next (d > 0) or the previous
+// (d < 0) node in the document with as many ancestors as the node at
+// position, which may be a cousin rather than a sibling.
+func depthPosition(root treeNode, position treePosition, d int) (treePosition, bool) {
+	for level := len(position) - 1; level >= 0; level-- {
+		parent := root.find(position[:level])
+		for i := indexOf(parent, position[level]) + d; i >= 0 && i < childCount(parent); i += d {
+			key := keyAt(parent, i)
+			below, isOk := descendantAt(parent.find(treePosition{key}), len(position)-level-1, d)
+			if isOk {
+				return append(appendKey(position[:level], key), below...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// descendantAt returns the position in node of its first (d > 0) or last
+// (d < 0) descendant depth levels below it.
+func descendantAt(node treeNode, depth int, d int) (treePosition, bool) {
+	if depth == 0 {
+		return treePosition{}, true
+	}
+	if !hasChildren(node) {
+		// the nodes with no descendant are skipped without being built
+		return nil, false
+	}
+	n := childCount(node)
+	i := 0
+	if d < 0 {
+		i = n - 1
+	}
+	for ; i >= 0 && i < n; i += d {
+		key := keyAt(node, i)
+		if below, isOk := descendantAt(node.find(treePosition{key}), depth-1, d); isOk {
+			return append(treePosition{key}, below...), true
+		}
+	}
+	return nil, false
+}
+
+// appendKey returns a new position of the child at key of the node at
+// position.
+func appendKey(position treePosition, key string) treePosition {
+	child := make(treePosition, len(position), len(position)+1)
+	copy(child, position)
+	return append(child, key)
+}
+
+// structuralMovement moves the tree cursor to the node found by next from the
+// node under the cursor, following the structure of the document rather than
+// the rows shown.
+func structuralMovement(next func(root treeNode, position treePosition) (treePosition, bool)) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if tree == nil {
+			return nil
+		}
+		position, isOk := next(tree, findTreePosition(g))
+		if !isOk {
+			return nil
+		}
+		return revealPosition(g, position)
+	}
+}
+
+// withDirection passes d to a search of a position in a direction.
+func withDirection(next func(root treeNode, position treePosition, d int) (treePosition, bool), d int) func(root treeNode, position treePosition) (treePosition, bool) {
+	return func(root treeNode, position treePosition) (treePosition, bool) {
+		return next(root, position, d)
+	}
+}
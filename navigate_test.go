@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructuralPositions(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"b": [1, 2], "c": 3}, "d": [], "e": {"f": {"g": 4}}, "h": {"i": 5}}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, c := range []struct {
+		name     string
+		next     func(root treeNode, position treePosition) (treePosition, bool)
+		from     treePosition
+		expected treePosition
+	}{
+		{"parent", parentPosition, treePosition{"a", "b", "[1]"}, treePosition{"a", "b"}},
+		{"parent", parentPosition, treePosition{}, nil},
+		{"next sibling", withDirection(siblingPosition, 1), treePosition{"a"}, treePosition{"d"}},
+		{"next sibling", withDirection(siblingPosition, 1), treePosition{"a", "b", "[0]"}, treePosition{"a", "b", "[1]"}},
+		{"next sibling", withDirection(siblingPosition, 1), treePosition{"h"}, nil},
+		{"previous sibling", withDirection(siblingPosition, -1), treePosition{"a", "c"}, treePosition{"a", "b"}},
+		{"previous sibling", withDirection(siblingPosition, -1), treePosition{"a"}, nil},
+		{"first child", withDirection(childPosition, 1), treePosition{"a", "b"}, treePosition{"a", "b", "[0]"}},
+		{"last child", withDirection(childPosition, -1), treePosition{}, treePosition{"h"}},
+		{"first child", withDirection(childPosition, 1), treePosition{"d"}, nil},
+		{"next at depth", withDirection(depthPosition, 1), treePosition{"a", "b"}, treePosition{"a", "c"}},
+		{"next at depth", withDirection(depthPosition, 1), treePosition{"a", "c"}, treePosition{"e", "f"}},
+		{"next at depth", withDirection(depthPosition, 1), treePosition{"a", "b", "[1]"}, treePosition{"e", "f", "g"}},
+		{"next at depth", withDirection(depthPosition, 1), treePosition{"e", "f", "g"}, nil},
+		{"previous at depth", withDirection(depthPosition, -1), treePosition{"h", "i"}, treePosition{"e", "f"}},
+		{"previous at depth", withDirection(depthPosition, -1), treePosition{"e", "f", "g"}, treePosition{"a", "b", "[1]"}},
+	} {
+		position, isOk := c.next(root, c.from)
+		if c.expected == nil {
+			if isOk {
+				t.Fatalf("unexpected %s of %q: %q", c.name, c.from, position)
+			}
+			continue
+		}
+		if !isOk || !reflect.DeepEqual(position, c.expected) {
+			t.Fatalf("unexpected %s of %q: %q", c.name, c.from, position)
+		}
+	}
+}
+
+func TestDepthPositionSkipsEmptyNodes(t *testing.T) {
+	raw := []byte(`[{"a": [1]}, [], { }, 5, {"b": [2]}]`)
+	// the children of the root are built when they are needed, like in a
+	// large document
+	p := newJsonParser(raw)
+	root, err := p.parseValue(1)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	position, isOk := depthPosition(root, treePosition{"[0]", "a"}, 1)
+	if !isOk || !reflect.DeepEqual(position, treePosition{"[4]", "b"}) {
+		t.Fatalf("unexpected next position at depth: %q", position)
+	}
+	children := root.(*listNode).data
+	if children[1].(*listNode).data != nil || children[2].(*complexNode).data != nil {
+		t.Fatalf("the empty nodes shouldn't be built")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+// objectKeys are the keys of an object in order, a duplicate key is stored as
+// "key#2", "key#3" ... with the first suffix which is neither a key of the
+// object nor the name of an earlier duplicate, like orderedmap.OrderedMap.Append
+// does. The keys of objects built by the parser are shared by all the objects
+// with the same keys, see internKeys, they must not be modified.
+type objectKeys struct {
+	names []string
+	// index maps the names to their position, for objects with at least
+	// keySetIndexSize keys
+	index      map[string]int
+	duplicates map[string]struct{}
+}
+
+// newObjectKeys returns the keys of an object which has the given keys in the
+// source document.
+func newObjectKeys(keys []string) *objectKeys {
+	k := &objectKeys{names: make([]string, 0, len(keys))}
+	// the keys of the object, once there is a duplicate to name
+	var taken map[string]struct{}
+	for _, key := range keys {
+		// the names of the duplicates are not keys, only a key can be there
+		if k.position(key) < 0 {
+			k.add(key, false)
+			continue
+		}
+		if taken == nil {
+			taken = make(map[string]struct{}, len(keys))
+			for _, key := range keys {
+				taken[key] = struct{}{}
+			}
+		}
+		k.add(duplicateName(key, func(name string) bool {
+			_, isKey := taken[name]
+			return isKey || k.position(name) >= 0
+		}), true)
+	}
+	return k
+}
+
+// duplicateName returns the first of "key#2", "key#3" ... which is not taken.
+func duplicateName(key string, taken func(name string) bool) string {
+	name := key
+	for n := 2; taken(name); n++ {
+		name = key + "#" + strconv.Itoa(n)
+	}
+	return name
+}
+
+// add appends the name of a key, duplicate is set if the key is a repeated
+// key which has been renamed.
+func (k *objectKeys) add(name string, duplicate bool) {
+	if duplicate {
+		if k.duplicates == nil {
+			k.duplicates = make(map[string]struct{})
+		}
+		k.duplicates[name] = struct{}{}
+	}
+	k.names = append(k.names, name)
+	if k.index == nil && len(k.names) < keySetIndexSize {
+		return
+	}
+	if k.index == nil {
+		k.index = make(map[string]int, len(k.names)*2)
+		for i, name := range k.names {
+			k.index[name] = i
+		}
+	}
+	k.index[name] = len(k.names) - 1
+}
+
+// position returns the position of a name, or -1 if there is none.
+func (k *objectKeys) position(name string) int {
+	if k.index != nil {
+		if i, isOk := k.index[name]; isOk {
+			return i
+		}
+		return -1
+	}
+	for i, n := range k.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// isDuplicate reports whether the name is a repeated key of the source object.
+func (k *objectKeys) isDuplicate(name string) bool {
+	_, isOk := k.duplicates[name]
+	return isOk
+}
+
+const (
+	// maxInternedShapes is the number of different objectKeys which are
+	// shared, the keys of the objects of any other shape are not.
+	maxInternedShapes = 4096
+	// maxInternedKeys is the number of keys of the largest object whose keys
+	// are shared.
+	maxInternedKeys = 64
+)
+
+// shapes holds the shared objectKeys by the sequence of their keys, it is
+// used by every parser, including the ones of the loader.
+var shapes = struct {
+	sync.Mutex
+	keys map[string]*objectKeys
+}{keys: make(map[string]*objectKeys)}
+
+// internKeys returns the keys of an object which has the given keys in the
+// source document, shape is the encoded sequence of the keys. They are shared
+// with the previous objects which had the same keys, unless there are
+// duplicates.
+func internKeys(shape []byte, keys []string) *objectKeys {
+	shapes.Lock()
+	defer shapes.Unlock()
+	if k, isOk := shapes.keys[string(shape)]; isOk {
+		return k
+	}
+	k := newObjectKeys(keys)
+	if k.duplicates != nil || len(shapes.keys) >= maxInternedShapes {
+		return k
+	}
+	// the keys usually point into the document, which the shared keys outlive
+	owned := make([]string, len(keys))
+	for i, key := range keys {
+		owned[i] = string([]byte(key))
+	}
+	k = newObjectKeys(owned)
+	shapes.keys[string(shape)] = k
+	return k
+}
+
+// childrenBuilder collects the children of an object or array, to store them
+// compactly once they are all known. It is reused from one container to the
+// next, the key is ignored for array elements.
+type childrenBuilder struct {
+	keys   []string
+	values []treeNode
+	shape  []byte
+}
+
+// childrenBuilders are the builders of the containers loaded outside of a
+// parser, see complexNode.load.
+var childrenBuilders = sync.Pool{New: func() interface{} {
+	return &childrenBuilder{}
+}}
+
+// reset empties the builder, without holding on to the previous children.
+func (b *childrenBuilder) reset() {
+	for i := range b.values {
+		b.values[i] = nil
+	}
+	b.keys = b.keys[:0]
+	b.values = b.values[:0]
+}
+
+func (b *childrenBuilder) add(key string, child treeNode) {
+	b.keys = append(b.keys, key)
+	b.values = append(b.values, child)
+}
+
+// list returns the children, without any spare capacity.
+func (b *childrenBuilder) list() []treeNode {
+	values := make([]treeNode, len(b.values))
+	copy(values, b.values)
+	return values
+}
+
+// object returns the keys and the children of an object.
+func (b *childrenBuilder) object() (*objectKeys, []treeNode) {
+	if len(b.keys) > maxInternedKeys {
+		return newObjectKeys(b.keys), b.list()
+	}
+	b.shape = b.shape[:0]
+	for _, key := range b.keys {
+		b.shape = appendUvarint(b.shape, len(key))
+		b.shape = append(b.shape, key...)
+	}
+	return internKeys(b.shape, b.keys), b.list()
+}
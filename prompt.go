@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+const promptView = "prompt"
+
+// activePrompt is the prompt shown over the path bar, if any. It is only
+// accessed by the UI goroutine.
+var activePrompt *prompt
+
+// prompt reads a line of input over the path bar. Enter calls done, ctrl+r
+// calls apply and Esc calls cancel, all after the prompt is closed. Tab
+// replaces the input with the one returned by complete.
+type prompt struct {
+	title    func() string
+	input    string // initial input
+	change   func(g *gocui.Gui, input string) error
+	done     func(g *gocui.Gui, input string) error
+	apply    func(g *gocui.Gui, input string) error
+	cancel   func(g *gocui.Gui) error
+	complete func(g *gocui.Gui, input string) string
+	// matching prompts have their match options toggled by toggleMatchMode
+	// and toggleMatchScope
+	matching bool
+
+	g        *gocui.Gui
+	previous string // view focused before the prompt
+}
+
+// openPrompt shows p, replacing the prompt already shown if any.
+func openPrompt(g *gocui.Gui, p *prompt) error {
+	if activePrompt != nil {
+		p.previous = activePrompt.previous
+		_ = g.DeleteView(promptView)
+	} else {
+		p.previous = currentViewName
+	}
+	p.g = g
+	activePrompt = p
+	currentViewName = promptView
+	return nil
+}
+
+// closePrompt hides the prompt and gives the focus back to the view which had
+// it before.
+func closePrompt(g *gocui.Gui) *prompt {
+	p := activePrompt
+	if p == nil {
+		return nil
+	}
+	activePrompt = nil
+	currentViewName = p.previous
+	_ = g.DeleteView(promptView)
+	return p
+}
+
+func promptInput(v *gocui.View) string {
+	return strings.TrimRight(v.Buffer(), "\n")
+}
+
+// drawPrompt draws the active prompt over the path bar.
+func drawPrompt(g *gocui.Gui, maxX, maxY int) error {
+	p := activePrompt
+	if p == nil {
+		return nil
+	}
+	_, y0, _, _ := viewPositions[pathView].getCoordinates(maxX, maxY)
+	v, err := g.SetView(promptView, 0, y0, maxX-1, y0+2)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Editable = true
+		v.Editor = gocui.EditorFunc(editPrompt)
+		_, _ = v.Write([]byte(p.input))
+		_ = v.SetCursor(len([]rune(p.input)), 0)
+	}
+	v.Title = p.title()
+	_, err = g.SetViewOnTop(promptView)
+	return err
+}
+
+// editPrompt edits the single line of the prompt, the active prompt is told
+// about every change of the input.
+func editPrompt(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	switch key {
+	case gocui.KeyEnter, gocui.KeyArrowUp, gocui.KeyArrowDown, gocui.KeyTab:
+		return
+	}
+	before := promptInput(v)
+	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	input := promptInput(v)
+	if p := activePrompt; p != nil && p.change != nil && input != before {
+		_ = p.change(p.g, input)
+	}
+}
+
+func submitPrompt(g *gocui.Gui, v *gocui.View) error {
+	input := promptInput(v)
+	if p := closePrompt(g); p != nil && p.done != nil {
+		return p.done(g, input)
+	}
+	return nil
+}
+
+// applyPrompt submits the input of a prompt which can be applied, like the
+// jq prompt replacing the tree with its results.
+func applyPrompt(g *gocui.Gui, v *gocui.View) error {
+	if activePrompt == nil || activePrompt.apply == nil {
+		return nil
+	}
+	input := promptInput(v)
+	return closePrompt(g).apply(g, input)
+}
+
+// completePrompt completes the input of a prompt which can complete it, like
+// the keys of the goto prompt.
+func completePrompt(g *gocui.Gui, v *gocui.View) error {
+	p := activePrompt
+	if p == nil || p.complete == nil {
+		return nil
+	}
+	input := p.complete(g, promptInput(v))
+	v.Clear()
+	_, _ = v.Write([]byte(input))
+	if err := v.SetOrigin(0, 0); err != nil {
+		return err
+	}
+	width, _ := v.Size()
+	if n := len([]rune(input)); n >= width {
+		_ = v.SetOrigin(n-width+1, 0)
+		return v.SetCursor(width-1, 0)
+	}
+	return v.SetCursor(len([]rune(input)), 0)
+}
+
+// toggleMatchMode switches the matching prompt to the next match mode, the
+// input is matched again.
+func toggleMatchMode(g *gocui.Gui, v *gocui.View) error {
+	return toggleMatchOptions(g, v, func() {
+		searchOptions.mode = (searchOptions.mode + 1) % matchModes
+	})
+}
+
+// toggleMatchScope switches the matching prompt to the next match scope, the
+// input is matched again.
+func toggleMatchScope(g *gocui.Gui, v *gocui.View) error {
+	return toggleMatchOptions(g, v, func() {
+		searchOptions.scope = (searchOptions.scope + 1) % matchScopes
+	})
+}
+
+func toggleMatchOptions(g *gocui.Gui, v *gocui.View, toggle func()) error {
+	p := activePrompt
+	if p == nil || !p.matching {
+		return nil
+	}
+	toggle()
+	if p.change != nil {
+		return p.change(g, promptInput(v))
+	}
+	return nil
+}
+
+func cancelPrompt(g *gocui.Gui, v *gocui.View) error {
+	if p := closePrompt(g); p != nil && p.cancel != nil {
+		return p.cancel(g)
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// pythonParser converts Python literals (dict/list/tuple reprs with single
+// quotes, True/False/None and trailing commas) into JSON text.
+type pythonParser struct {
+	data []byte
+	pos  int
+	out  *bytes.Buffer
+}
+
+func fromPython(b []byte) (treeNode, error) {
+	data, err := pythonToJson(b)
+	if err != nil {
+		return nil, err
+	}
+	return fromBytes(data)
+}
+
+func pythonToJson(data []byte) ([]byte, error) {
+	p := &pythonParser{data: data, out: bytes.NewBuffer(make([]byte, 0, len(data)))}
+	if err := p.parseValue(); err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.data) {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return p.out.Bytes(), nil
+}
+
+func (p *pythonParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid python literal at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pythonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		case '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *pythonParser) peek() byte {
+	if p.pos < len(p.data) {
+		return p.data[p.pos]
+	}
+	return 0
+}
+
+func (p *pythonParser) parseValue() error {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == 0:
+		return p.errorf("unexpected end of input")
+	case c == '{':
+		return p.parseDict()
+	case c == '[':
+		return p.parseList(']')
+	case c == '(':
+		return p.parseList(')')
+	case c == '\'' || c == '"' || p.isStringPrefix():
+		s, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		p.out.WriteString(encodeJson(s, 0))
+		return nil
+	case isPythonWordChar(c) || c == '-' || c == '+' || c == '.':
+		return p.parseWord()
+	default:
+		return p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *pythonParser) parseDict() error {
+	p.pos++
+	if p.skipSpace(); p.peek() == '}' {
+		p.pos++
+		p.out.WriteString("{}")
+		return nil
+	}
+	first, err := p.capture()
+	if err != nil {
+		return err
+	}
+	if p.skipSpace(); p.peek() != ':' {
+		// a set, e.g. {1, 2}
+		p.out.WriteByte('[')
+		p.out.Write(first)
+		return p.parseElements('}', ']', false)
+	}
+	p.out.WriteByte('{')
+	p.writeKey(first)
+	if err := p.parseDictValue(); err != nil {
+		return err
+	}
+	return p.parseElements('}', '}', true)
+}
+
+func (p *pythonParser) parseList(end byte) error {
+	p.pos++
+	p.out.WriteByte('[')
+	if p.skipSpace(); p.peek() == end {
+		p.pos++
+		p.out.WriteByte(']')
+		return nil
+	}
+	if err := p.parseValue(); err != nil {
+		return err
+	}
+	return p.parseElements(end, ']', false)
+}
+
+// parseElements parses the elements following the first one up to end, a
+// trailing comma is allowed before end.
+func (p *pythonParser) parseElements(end, jsonEnd byte, dict bool) error {
+	for {
+		if p.skipSpace(); p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != end {
+			return p.errorf("expected ',' or %q", end)
+		}
+		if p.skipSpace(); p.peek() == end {
+			p.pos++
+			p.out.WriteByte(jsonEnd)
+			return nil
+		}
+		p.out.WriteByte(',')
+		if !dict {
+			if err := p.parseValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		key, err := p.capture()
+		if err != nil {
+			return err
+		}
+		p.writeKey(key)
+		if err := p.parseDictValue(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *pythonParser) parseDictValue() error {
+	if p.skipSpace(); p.peek() != ':' {
+		return p.errorf("expected ':' after dict key")
+	}
+	p.pos++
+	p.out.WriteByte(':')
+	return p.parseValue()
+}
+
+// capture parses the next value and returns its JSON text instead of writing it.
+func (p *pythonParser) capture() ([]byte, error) {
+	out := p.out
+	p.out = bytes.NewBuffer(nil)
+	err := p.parseValue()
+	captured := p.out.Bytes()
+	p.out = out
+	return captured, err
+}
+
+// writeKey writes a dict key, keys which are not strings (numbers, True,
+// tuples ...) are converted to their JSON text as a string.
+func (p *pythonParser) writeKey(key []byte) {
+	if len(key) > 0 && key[0] == '"' {
+		p.out.Write(key)
+		return
+	}
+	p.out.WriteString(encodeJson(string(key), 0))
+}
+
+func (p *pythonParser) isStringPrefix() bool {
+	for i := p.pos; i < len(p.data) && i < p.pos+3; i++ {
+		switch p.data[i] {
+		case 'b', 'B', 'r', 'R', 'u', 'U', 'f', 'F':
+			continue
+		case '\'', '"':
+			return i > p.pos
+		}
+		return false
+	}
+	return false
+}
+
+func (p *pythonParser) parseString() (string, error) {
+	raw := false
+	for p.data[p.pos] != '\'' && p.data[p.pos] != '"' {
+		if c := p.data[p.pos]; c == 'r' || c == 'R' {
+			raw = true
+		}
+		p.pos++
+	}
+	quote := p.data[p.pos : p.pos+1]
+	if bytes.HasPrefix(p.data[p.pos:], bytes.Repeat(quote, 3)) {
+		quote = bytes.Repeat(quote, 3)
+	}
+	p.pos += len(quote)
+	var s strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		if bytes.HasPrefix(p.data[p.pos:], quote) {
+			p.pos += len(quote)
+			return s.String(), nil
+		}
+		c := p.data[p.pos]
+		if c == '\n' && len(quote) == 1 {
+			return "", p.errorf("unterminated string")
+		}
+		if c != '\\' || p.pos+1 >= len(p.data) {
+			s.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if raw {
+			s.Write(p.data[p.pos : p.pos+2])
+			p.pos += 2
+			continue
+		}
+		if err := p.parseEscape(&s); err != nil {
+			return "", err
+		}
+	}
+}
+
+var pythonEscapes = map[byte]string{
+	'\\': "\\", '\'': "'", '"': "\"", 'n': "\n", 'r': "\r", 't': "\t",
+	'a': "\a", 'b': "\b", 'f': "\f", 'v': "\v", '\n': "",
+}
+
+func (p *pythonParser) parseEscape(s *strings.Builder) error {
+	c := p.data[p.pos+1]
+	if v, isOk := pythonEscapes[c]; isOk {
+		s.WriteString(v)
+		p.pos += 2
+		return nil
+	}
+	size := 0
+	base := 16
+	switch {
+	case c == 'x':
+		size = 2
+	case c == 'u':
+		size = 4
+	case c == 'U':
+		size = 8
+	case c >= '0' && c <= '7':
+		base = 8
+		for size < 3 && p.pos+1+size < len(p.data) && p.data[p.pos+1+size] >= '0' && p.data[p.pos+1+size] <= '7' {
+			size++
+		}
+	default:
+		// unknown escapes are kept as they are
+		s.Write(p.data[p.pos : p.pos+2])
+		p.pos += 2
+		return nil
+	}
+	start := p.pos + 2
+	if base == 8 {
+		start = p.pos + 1
+	}
+	if start+size > len(p.data) {
+		return p.errorf("truncated escape sequence")
+	}
+	code, err := strconv.ParseUint(string(p.data[start:start+size]), base, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return p.errorf("invalid escape sequence %q", p.data[p.pos:start+size])
+	}
+	s.WriteRune(rune(code))
+	p.pos = start + size
+	return nil
+}
+
+func isPythonWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+var pythonConstants = map[string]string{
+	"True": "true", "False": "false", "None": "null",
+	"true": "true", "false": "false", "null": "null",
+}
+
+// parseWord converts constants and numbers, values which JSON can't express
+// (inf, nan, complex numbers ...) are kept as strings.
+func (p *pythonParser) parseWord() error {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		isExponentSign := (c == '-' || c == '+') && p.pos > start && (p.data[p.pos-1] == 'e' || p.data[p.pos-1] == 'E')
+		if !isPythonWordChar(c) && c != '.' && !isExponentSign && !((c == '-' || c == '+') && p.pos == start) {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() == '(' {
+		// a call like Decimal('1.5') or datetime.date(2020, 1, 1)
+		if err := p.skipCall(); err != nil {
+			return err
+		}
+		p.out.WriteString(encodeJson(string(p.data[start:p.pos]), 0))
+		return nil
+	}
+	word := string(p.data[start:p.pos])
+	if v, isOk := pythonConstants[word]; isOk {
+		p.out.WriteString(v)
+		return nil
+	}
+	number := strings.TrimPrefix(strings.Replace(word, "_", "", -1), "+")
+	if json.Valid([]byte(number)) {
+		p.out.WriteString(number)
+		return nil
+	}
+	if v, isOk := new(big.Int).SetString(number, 0); isOk {
+		p.out.WriteString(v.String())
+		return nil
+	}
+	if v, err := strconv.ParseFloat(number, 64); err == nil && !strings.ContainsAny(strings.ToLower(number), "in") {
+		p.out.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		return nil
+	}
+	p.out.WriteString(encodeJson(word, 0))
+	return nil
+}
+
+func (p *pythonParser) skipCall() error {
+	depth := 0
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '\'' || c == '"':
+			if _, err := p.parseString(); err != nil {
+				return err
+			}
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+		p.pos++
+		if depth == 0 {
+			return nil
+		}
+	}
+	return p.errorf("unterminated call")
+}
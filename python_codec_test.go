@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPythonToJson(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{'a': True, 'b': None, 'c': (1, 2)}`, `{"a":true,"b":null,"c":[1,2]}`},
+		{`[1, 2, 3,]`, `[1,2,3]`},
+		{`{'a': (1,), 'b': [], 'c': {},}`, `{"a":[1],"b":[],"c":{}}`},
+		{`{1: 'x', None: 'y', (1, 2): 'z'}`, `{"1":"x","null":"y","[1,2]":"z"}`},
+		{`{'it\'s': "say \"hi\"\n", 'u': u'中\x41', 'r': r'\d+'}`, `{"it's":"say \"hi\"\n","u":"中A","r":"\\d+"}`},
+		{`{1, 2}`, `[1,2]`},
+		{`[0x1F, 1_000, 1., -2.5e-3, inf, -inf, nan, 1j]`, `[31,1000,1,-2.5e-3,"inf","-inf","nan","1j"]`},
+		{`{'d': Decimal('1.5'), 'date': datetime.date(2020, 1, 1)}`, `{"d":"Decimal('1.5')","date":"datetime.date(2020, 1, 1)"}`},
+		{"{'a': '''multi\nline'''}  # comment", `{"a":"multi\nline"}`},
+		{`{"json": true, "null": null}`, `{"json":true,"null":null}`},
+	}
+	for _, test := range tests {
+		result, err := pythonToJson([]byte(test.input))
+		if err != nil {
+			t.Fatalf("failed to convert %s: %v", test.input, err)
+		}
+		if string(result) != test.expected {
+			t.Fatalf("convert %s\nexpected: %s\ngot:      %s", test.input, test.expected, result)
+		}
+	}
+	for _, input := range []string{`{'a' 1}`, `[1 2]`, `{'a': 'x`, `[1] 2`} {
+		if _, err := pythonToJson([]byte(input)); err == nil {
+			t.Fatalf("expected error for %s", input)
+		}
+	}
+}
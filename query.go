@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/atotto/clipboard"
+	"github.com/jroimartin/gocui"
+)
+
+const resultsView = "results"
+
+// maxPreviewSize is the number of bytes of a scalar shown by a result.
+const maxPreviewSize = 200
+
+// queryText is the latest JSONPath query and queryResults are its results
+// while the results view is open, querying is the query in progress. They are
+// only accessed by the UI goroutine.
+var (
+	queryText         = "$"
+	queryResults      *jsonPathResults
+	resultsController internal.ViewBufferController
+	querying          backgroundJob
+)
+
+// jsonPathResults are the lines of the results view, the path of each match
+// followed by a preview of its value.
+type jsonPathResults struct {
+	query   string
+	matches []jsonPathMatch
+	copied  bool // the results have just been copied
+	// origin is the position of the tree cursor when the results were
+	// listed, the tree follows the cursor of the results view until one of
+	// them is jumped to
+	origin treePosition
+}
+
+func (r *jsonPathResults) Len() int {
+	return len(r.matches)
+}
+
+func (r *jsonPathResults) Line(index int) []byte {
+	m := r.matches[index]
+	return []byte("$" + formatPath(tree, m.position) + " = " + previewNode(m.node) + "\n")
+}
+
+func (r *jsonPathResults) title() string {
+	title := " " + r.query + ": " + plural(len(r.matches), "result")
+	if r.copied {
+		title += ", copied"
+	}
+	return title + " (Enter jump, c copy, Esc close) "
+}
+
+// previewNode returns a short description of a value which fits in a line,
+// objects and arrays are summed up by their size.
+func previewNode(node treeNode) string {
+	switch n := node.(type) {
+	case *complexNode:
+		return "{" + plural(len(n.keys()), "key") + "}"
+	case *listNode:
+		n.load()
+		return "[" + plural(len(n.data), "item") + "]"
+	}
+	preview := node.String(0)
+	if len(preview) <= maxPreviewSize {
+		return preview
+	}
+	end := maxPreviewSize
+	for end > 0 && !utf8.RuneStart(preview[end]) {
+		end--
+	}
+	return preview[:end] + "..."
+}
+
+// plural returns the count of things named word, like 1 key or 2 keys.
+func plural(count int, word string) string {
+	if count == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", count, word)
+}
+
+// openQuery opens the JSONPath prompt, the results of the query are listed
+// once it is submitted.
+func openQuery(g *gocui.Gui, v *gocui.View) error {
+	return openQueryPrompt(g, queryText, "")
+}
+
+func openQueryPrompt(g *gocui.Gui, input, status string) error {
+	return openPrompt(g, &prompt{
+		title: func() string {
+			if status != "" {
+				return " jsonpath (" + status + ") "
+			}
+			return " jsonpath "
+		},
+		input: input,
+		change: func(g *gocui.Gui, input string) error {
+			status = ""
+			if _, err := compileJSONPath(input); err != nil {
+				status = err.Error()
+			}
+			return nil
+		},
+		done: runQuery,
+	})
+}
+
+// runQuery evaluates a JSONPath query over the document in the background and
+// lists its results, the prompt is opened again if the query is invalid.
+func runQuery(g *gocui.Gui, input string) error {
+	queryText = input
+	path, err := compileJSONPath(input)
+	if err != nil {
+		return openQueryPrompt(g, input, err.Error())
+	}
+	if tree == nil {
+		return nil
+	}
+	ctx := querying.start()
+	raw, index := searchSource(tree), treeIndex
+	_ = drawMessage(g, "jsonpath: querying... (Esc cancel)")
+	go func() {
+		matches, err := evaluateRaw(ctx, path, raw, index)
+		if ctx.Err() != nil {
+			return
+		}
+		g.Update(func(g *gocui.Gui) error {
+			if querying.ctx != ctx {
+				return nil
+			}
+			querying.stop()
+			if err != nil {
+				return openQueryPrompt(g, input, err.Error())
+			}
+			return showResults(g, &jsonPathResults{query: input, matches: matches})
+		})
+	}()
+	return nil
+}
+
+// evaluateRaw evaluates path over the JSON value raw, index is the index of
+// the document if it has one. The nodes of the tree are built on the UI
+// goroutine, so the query runs over nodes of its own whose positions are the
+// same. Their children are built one level at a time when they are selected
+// and dropped once they have been, so that only the matches are kept rather
+// than a second tree.
+func evaluateRaw(ctx context.Context, path *jsonPath, raw []byte, index *fileIndex) ([]jsonPathMatch, error) {
+	p := newJsonParser(raw)
+	p.pos = skipSpace(raw, 0)
+	root, err := p.parseValue(0)
+	if err != nil {
+		return nil, err
+	}
+	// the children of the root are kept for the queries of $ in the filters
+	buildChildren(root, index)
+	ev := &jsonPathEval{ctx: ctx, root: root, unload: dropChildren}
+	ev.load = func(node treeNode) bool {
+		return buildChildren(node, index)
+	}
+	return path.run(ev, root)
+}
+
+// buildChildren builds the children of an object or array without building
+// theirs, from index if the document is indexed. It returns false if they
+// were already built.
+func buildChildren(node treeNode, index *fileIndex) bool {
+	var raw json.RawMessage
+	switch n := node.(type) {
+	case *complexNode:
+		if n.data != nil {
+			return false
+		}
+		raw = n.raw
+	case *listNode:
+		if n.data != nil {
+			return false
+		}
+		raw = n.raw
+	default:
+		return false
+	}
+	children := childrenBuilders.Get().(*childrenBuilder)
+	defer func() {
+		children.reset()
+		childrenBuilders.Put(children)
+	}()
+	if !index.children(raw, children.add) {
+		// raw has been validated by the parser
+		_ = newJsonParser(raw).parseChildren(0, children.add)
+	}
+	switch n := node.(type) {
+	case *complexNode:
+		n.shape, n.data = children.object()
+	case *listNode:
+		n.data = children.list()
+	}
+	return true
+}
+
+// dropChildren drops the children of an object or array, they are built from
+// its raw text again when they are needed.
+func dropChildren(node treeNode) {
+	switch n := node.(type) {
+	case *complexNode:
+		n.shape, n.data = nil, nil
+	case *listNode:
+		n.data = nil
+	}
+}
+
+// showResults lists the results of a query in the results view, the tree
+// cursor goes to the first one.
+func showResults(g *gocui.Gui, results *jsonPathResults) error {
+	closeMarks(g)
+	queryResults = results
+	resultsController.Clear()
+	resultsController.Source = queryResults
+	if v, err := g.View(resultsView); err == nil {
+		_ = v.SetCursor(0, 0)
+		if err := resultsController.Draw(v); err != nil {
+			return err
+		}
+	}
+	currentViewName = resultsView
+	results.origin = findTreePosition(g)
+	return showResult(g, 0)
+}
+
+// stopQuery cancels the query in progress, it returns false if there is none.
+func stopQuery(g *gocui.Gui) bool {
+	if !querying.pending() {
+		return false
+	}
+	querying.stop()
+	_ = drawMessage(g, "jsonpath: cancelled")
+	return true
+}
+
+// drawResults draws the results view over the text view.
+func drawResults(g *gocui.Gui, maxX, maxY int) error {
+	if queryResults == nil {
+		return nil
+	}
+	x0, y0, x1, y1 := viewPositions[textView].getCoordinates(maxX, maxY)
+	v, err := g.SetView(resultsView, x0, y0, x1, y1)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Highlight = true
+		v.SelFgColor = gocui.ColorBlack
+		v.SelBgColor = gocui.ColorGreen
+		if err := resultsController.Draw(v); err != nil {
+			return err
+		}
+	}
+	v.Title = queryResults.title()
+	_, err = g.SetViewOnTop(resultsView)
+	return err
+}
+
+// showResult moves the tree cursor to the result at index.
+func showResult(g *gocui.Gui, index int) error {
+	if index < 0 || index >= len(queryResults.matches) {
+		return drawPath(g)
+	}
+	return showPosition(g, queryResults.matches[index].position)
+}
+
+// resultsMovement moves the cursor of the results view by d lines, the tree
+// follows it.
+func resultsMovement(d int) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		queryResults.copied = false
+		_ = resultsController.MoveCursor(v, 0, d)
+		return showResult(g, resultsController.Index(v))
+	}
+}
+
+// jumpToResult closes the results and leaves the tree cursor on the selected
+// result.
+func jumpToResult(g *gocui.Gui, v *gocui.View) error {
+	index := resultsController.Index(v)
+	if index >= len(queryResults.matches) {
+		closeResults(g)
+		return nil
+	}
+	position, origin := queryResults.matches[index].position, queryResults.origin
+	closeResults(g)
+	recordJump(origin, position)
+	return revealPosition(g, position)
+}
+
+func closeResultsView(g *gocui.Gui, v *gocui.View) error {
+	closeResults(g)
+	return nil
+}
+
+// closeResults hides the results view and gives the focus back to the tree.
+func closeResults(g *gocui.Gui) {
+	if queryResults == nil {
+		return
+	}
+	queryResults = nil
+	resultsController.Clear()
+	_ = g.DeleteView(resultsView)
+	if currentViewName == resultsView {
+		currentViewName = treeView
+	}
+}
+
+// copyResults copies the values of all the results as a JSON array.
+func copyResults(g *gocui.Gui, v *gocui.View) error {
+	values := make([]string, len(queryResults.matches))
+	for i, m := range queryResults.matches {
+		values[i] = m.node.String(0)
+	}
+	data := encodeRawJson(json.RawMessage("["+strings.Join(values, ",")+"]"), jsonPadding)
+	if formatData {
+		data = internal.FormatData(data)
+	}
+	_ = clipboard.WriteAll(data)
+	queryResults.copied = true
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPreviewNode(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": {"b": 1}, "c": [1, 2], "d": "x", "e": "` + strings.Repeat("é", maxPreviewSize) + `"}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for key, expected := range map[string]string{"a": "{1 key}", "c": "[2 items]", "d": `"x"`} {
+		if preview := previewNode(root.find(treePosition{key})); preview != expected {
+			t.Fatalf("unexpected preview of %s %q", key, preview)
+		}
+	}
+	preview := previewNode(root.find(treePosition{"e"}))
+	if !strings.HasSuffix(preview, "é...") || len(preview) > maxPreviewSize+len("...") {
+		t.Fatalf("expected the preview to be cut between runes, got %q", preview)
+	}
+}
+
+func TestEvaluateRaw(t *testing.T) {
+	raw := []byte(`{"a": [{"b": 1}, {"b": 2}], "a": {"b": 3}}`)
+	path, err := compileJSONPath(`$..b`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	matches, err := evaluateRaw(context.Background(), path, raw, nil)
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+	if positions := fmt.Sprint(matchPositions(matches)); positions != "[[a [0] b] [a [1] b] [a#2 b]]" {
+		t.Fatalf("unexpected positions %s", positions)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := evaluateRaw(ctx, path, raw, nil); err != context.Canceled {
+		t.Fatalf("expected the query to be cancelled, got %v", err)
+	}
+}
+
+func TestEvaluateRawDropsChildren(t *testing.T) {
+	raw := []byte(`{"pad": "` + strings.Repeat("x", lazyExpandSize) + `", "a": [{"b": {"c": 1}}, {"b": {"c": 2}}], "n": 1}`)
+	path, err := compileJSONPath(`$.a[?(@.b.c > $.n)].b`)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	matches, err := evaluateRaw(context.Background(), path, raw, nil)
+	if err != nil {
+		t.Fatalf("failed to evaluate: %v", err)
+	}
+	if positions := fmt.Sprint(matchPositions(matches)); positions != "[[a [1] b]]" {
+		t.Fatalf("unexpected positions %s", positions)
+	}
+	// the children built to select the match are not kept
+	if n := matches[0].node.(*complexNode); n.data != nil {
+		t.Fatalf("the children of a match should be dropped once they have been selected from")
+	}
+	if s := matches[0].node.String(0); s != `{"c":2}` {
+		t.Fatalf("unexpected match %s", s)
+	}
+	if preview := previewNode(matches[0].node); preview != "{1 key}" {
+		t.Fatalf("unexpected preview %s", preview)
+	}
+}
+
+func matchPositions(matches []jsonPathMatch) []treePosition {
+	positions := make([]treePosition, len(matches))
+	for i, m := range matches {
+		positions[i] = m.position
+	}
+	return positions
+}
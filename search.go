@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/jroimartin/gocui"
+)
+
+// maxSearchMatches is the number of matches kept by a search, the others are
+// only counted as more.
+const maxSearchMatches = 100000
+
+// searchCheckValues is how many values are searched between two checks of the
+// context of the search.
+const searchCheckValues = 4096
+
+// treeSearch is the search of the tree view, it is only accessed by the UI
+// goroutine.
+var treeSearch searchState
+
+// searchState is the latest search of the document and the match selected in
+// the tree. Searches run in the background, starting one cancels the one in
+// progress.
+type searchState struct {
+	query   string
+	matcher *matcher
+	err     error // the pattern is invalid
+	searchResult
+	current int // index of the selected match, -1 if none has been selected
+
+	// the search in progress
+	backgroundJob
+}
+
+// reset stops the search and forgets its matches.
+func (s *searchState) reset() {
+	s.stop()
+	s.query, s.matcher, s.err, s.searchResult, s.current = "", nil, nil, searchResult{}, -1
+}
+
+// start searches the document for query with the options of the prompts in
+// the background, done is called on the UI goroutine with the matches unless
+// the search is superseded.
+func (s *searchState) start(g *gocui.Gui, query string, done func(g *gocui.Gui) error) {
+	s.reset()
+	s.query = query
+	if query == "" || tree == nil {
+		return
+	}
+	m, err := newMatcher(query, searchOptions)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.matcher = m
+	ctx := s.backgroundJob.start()
+	raw := searchSource(tree)
+	go func() {
+		result, err := searchRaw(ctx, raw, m)
+		if err != nil {
+			return
+		}
+		g.Update(func(g *gocui.Gui) error {
+			if s.ctx != ctx {
+				return nil
+			}
+			s.stop()
+			s.searchResult = result
+			return done(g)
+		})
+	}()
+}
+
+// status describes the search for the path bar, it is empty without a search.
+func (s *searchState) status() string {
+	switch {
+	case s.query == "":
+		return ""
+	case s.err != nil:
+		return "invalid pattern"
+	case s.pending():
+		return "searching"
+	case len(s.matches) == 0:
+		return "no match"
+	}
+	total := fmt.Sprint(len(s.matches))
+	if s.more {
+		total += "+"
+	}
+	if s.current < 0 {
+		return total + " matches"
+	}
+	return fmt.Sprintf("match %d/%s", s.current+1, total)
+}
+
+// searchSource returns the JSON text searched for the nodes of root. The
+// nodes themselves aren't searched: most of them haven't been built yet, and
+// the loader may still be adding children to the root.
+func searchSource(root treeNode) []byte {
+	if raw := nodeRaw(root); raw != nil {
+		return raw
+	}
+	return []byte(root.String(0))
+}
+
+// searchResult are the matches of a search.
+type searchResult struct {
+	matches []treePosition
+	more    bool // there are more than maxSearchMatches matches
+	best    int  // index of the match with the best score, see matcher.score
+}
+
+// searchRaw returns the position of every key and scalar value of the JSON
+// value raw which match, in document order. A member whose key and value both
+// match is returned once. The positions name duplicate keys like the tree
+// does, see orderedmap.OrderedMap.Append.
+func searchRaw(ctx context.Context, raw []byte, m *matcher) (searchResult, error) {
+	s := &rawSearch{ctx: ctx, matcher: m}
+	s.matches = make([]treePosition, 0)
+	s.p = newJsonParser(raw)
+	// the parser names the duplicate keys while it looks for them
+	s.p.duplicates = &[]treePosition{}
+	s.p.pos = skipSpace(raw, 0)
+	if err := s.value(false); err != nil {
+		return searchResult{}, err
+	}
+	return s.searchResult, nil
+}
+
+type rawSearch struct {
+	searchResult
+	ctx       context.Context
+	p         *jsonParser
+	matcher   *matcher
+	bestScore int
+	values    int
+}
+
+func (s *rawSearch) add(text string) {
+	if len(s.matches) == maxSearchMatches {
+		s.more = true
+		return
+	}
+	if score := s.matcher.score(text); len(s.matches) == 0 || score > s.bestScore {
+		s.best, s.bestScore = len(s.matches), score
+	}
+	s.matches = append(s.matches, s.p.position())
+}
+
+// value searches the value at p.pos, matched is whether its key has matched.
+func (s *rawSearch) value(matched bool) error {
+	if s.values++; s.values%searchCheckValues == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	p := s.p
+	switch p.next() {
+	case '{', '[':
+		return p.foreachChild(func(key string) error {
+			matched := p.path[len(p.path)-1].index < 0 && s.matcher.keys() && s.matcher.match(key)
+			if matched {
+				s.add(key)
+			}
+			return s.value(matched)
+		})
+	case '"':
+		end, err := p.scanString()
+		if err != nil {
+			return err
+		}
+		value, err := unquoteString(p.data[p.pos:end])
+		if err != nil {
+			return err
+		}
+		p.pos = end
+		if !matched && s.matcher.values() && s.matcher.match(value) {
+			s.add(value)
+		}
+		return nil
+	}
+	end, err := p.scanLiteral()
+	if err != nil {
+		return err
+	}
+	literal := p.data[p.pos:end]
+	p.pos = end
+	if !matched && s.matcher.values() && s.matcher.match(internal.Bytes2String(literal)) {
+		s.add(internal.Bytes2String(literal))
+	}
+	return nil
+}
+
+// openSearch opens the search prompt, the tree cursor follows the first match
+// as the query is typed and goes back where it was if the search is cancelled.
+func openSearch(g *gocui.Gui, v *gocui.View) error {
+	origin := findTreePosition(g)
+	return openPrompt(g, &prompt{
+		title: func() string {
+			return matchTitle("search", &treeSearch)
+		},
+		input:    treeSearch.query,
+		matching: true,
+		change: func(g *gocui.Gui, input string) error {
+			treeSearch.start(g, input, func(g *gocui.Gui) error {
+				if len(treeSearch.matches) == 0 {
+					return showPosition(g, origin)
+				}
+				return selectMatch(g, treeSearch.best)
+			})
+			return updateHighlight(g)
+		},
+		done: func(g *gocui.Gui, input string) error {
+			recordJump(origin, findTreePosition(g))
+			return drawPath(g)
+		},
+		cancel: func(g *gocui.Gui) error {
+			treeSearch.reset()
+			if err := updateHighlight(g); err != nil {
+				return err
+			}
+			return showPosition(g, origin)
+		},
+	})
+}
+
+// matchTitle returns the title of the prompt of a search named name, with its
+// options and its status.
+func matchTitle(name string, s *searchState) string {
+	title := " " + name + " [" + searchOptions.String() + "]"
+	if status := s.status(); status != "" {
+		title += " (" + status + ")"
+	}
+	return title + " "
+}
+
+// highlightMatcher returns the matcher of the parts of the tree highlighted,
+// the search's or else the filter's.
+func highlightMatcher() *matcher {
+	if treeSearch.matcher != nil {
+		return treeSearch.matcher
+	}
+	return treeFilter.matcher
+}
+
+// updateHighlight redraws the tree with the matches of the latest search
+// highlighted.
+func updateHighlight(g *gocui.Gui) error {
+	treeLines.highlight = highlightMatcher()
+	return drawTree(g)
+}
+
+// nextMatch selects the match d matches after the selected one, wrapping
+// around the document.
+func nextMatch(d int) func(g *gocui.Gui, v *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		n := len(treeSearch.matches)
+		if n == 0 {
+			return nil
+		}
+		current := treeSearch.current
+		if current < 0 && d < 0 {
+			current = 0
+		}
+		index := ((current+d)%n + n) % n
+		recordJump(findTreePosition(g), treeSearch.matches[index])
+		return selectMatch(g, index)
+	}
+}
+
+// selectMatch moves the tree cursor to the match at index.
+func selectMatch(g *gocui.Gui, index int) error {
+	treeSearch.current = index
+	return showPosition(g, treeSearch.matches[index])
+}
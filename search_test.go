@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchRaw(t *testing.T) {
+	raw := []byte(`{"name": "x", "list": ["a", {"name": "name"}, 12], "k": 1, "k": "names", "n": null}`)
+	contains := func(query string) *matcher {
+		m, _ := newMatcher(query, matchOptions{})
+		return m
+	}
+	for query, expected := range map[string]string{
+		"name": `[[name] [list [1] name] [k#2]]`,
+		"1":    `[[list [2]] [k]]`,
+		"nul":  `[[n]]`,
+		"zzz":  `[]`,
+	} {
+		result, err := searchRaw(context.Background(), raw, contains(query))
+		matches := result.matches
+		if err != nil || result.more {
+			t.Fatalf("failed to search %q: %v", query, err)
+		}
+		if fmt.Sprint(matches) != expected {
+			t.Fatalf("expected the matches of %q to be %s, got %v", query, expected, matches)
+		}
+	}
+
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	result, _ := searchRaw(context.Background(), raw, contains("name"))
+	for _, position := range result.matches {
+		if tree.find(position) == nil {
+			t.Fatalf("the match %v isn't in the tree", position)
+		}
+	}
+
+	result, err = searchRaw(context.Background(), []byte(`"a name"`), contains("name"))
+	if err != nil || fmt.Sprint(result.matches) != "[[]]" {
+		t.Fatalf("expected a scalar document to match at the root, got %v %v", result.matches, err)
+	}
+}
+
+func TestSearchRawLimits(t *testing.T) {
+	raw := []byte("[" + strings.Repeat(`"x",`, maxSearchMatches) + `"x"]`)
+	all, _ := newMatcher("", matchOptions{mode: matchRegexp})
+	result, err := searchRaw(context.Background(), raw, all)
+	if err != nil || len(result.matches) != maxSearchMatches || !result.more {
+		t.Fatalf("expected the matches to be limited, got %d %v %v", len(result.matches), result.more, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := searchRaw(ctx, raw, all); err != context.Canceled {
+		t.Fatalf("expected the search to be cancelled, got %v", err)
+	}
+}
+
+func TestSearchStatus(t *testing.T) {
+	s := searchState{query: "a", searchResult: searchResult{matches: []treePosition{{"a"}, {"b"}}}, current: -1}
+	if status := s.status(); status != "2 matches" {
+		t.Fatalf("unexpected status %q", status)
+	}
+	s.current, s.more = 1, true
+	if status := s.status(); status != "match 2/2+" {
+		t.Fatalf("unexpected status %q", status)
+	}
+	s.err = errors.New("invalid")
+	if status := s.status(); status != "invalid pattern" {
+		t.Fatalf("unexpected status %q", status)
+	}
+	s.reset()
+	if status := s.status(); status != "" {
+		t.Fatalf("unexpected status %q", status)
+	}
+}
+
+func TestSearchRawOptions(t *testing.T) {
+	raw := []byte(`{"Name": "nm", "list": ["name", {"n_m": "x"}], "nickname": 1}`)
+	for _, test := range []struct {
+		query    string
+		options  matchOptions
+		expected string
+		best     int
+	}{
+		{"name", matchOptions{}, `[[list [0]] [nickname]]`, 0},
+		{"name", matchOptions{mode: matchIgnoreCase}, `[[Name] [list [0]] [nickname]]`, 0},
+		{"name", matchOptions{mode: matchIgnoreCase, scope: matchKeys}, `[[Name] [nickname]]`, 0},
+		{"name", matchOptions{mode: matchIgnoreCase, scope: matchValues}, `[[list [0]]]`, 0},
+		{"^n.?m$", matchOptions{mode: matchRegexp}, `[[Name] [list [1] n_m]]`, 0},
+		{"nm", matchOptions{mode: matchFuzzy}, `[[Name] [list [0]] [list [1] n_m] [nickname]]`, 2},
+		{"nm", matchOptions{mode: matchFuzzy, scope: matchKeys}, `[[Name] [list [1] n_m] [nickname]]`, 1},
+	} {
+		m, err := newMatcher(test.query, test.options)
+		if err != nil {
+			t.Fatalf("failed to compile %q: %v", test.query, err)
+		}
+		result, err := searchRaw(context.Background(), raw, m)
+		if err != nil {
+			t.Fatalf("failed to search %q: %v", test.query, err)
+		}
+		if fmt.Sprint(result.matches) != test.expected || result.best != test.best {
+			t.Fatalf("expected the matches of %q (%v) to be %s best %d, got %v best %d",
+				test.query, test.options, test.expected, test.best, result.matches, result.best)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/anthony-dong/jsonui/internal/jq"
+	"github.com/jroimartin/gocui"
+)
+
+// textRenderDelay is how long the previous text stays in the text view while
+// the next one is rendered, before the loading indicator replaces it.
+const textRenderDelay = 100 * time.Millisecond
+
+// renderCheckLines is how many lines are split between two checks of the
+// context of the rendering.
+const renderCheckLines = 4096
+
+// renderer renders the text of the selected node, it is only accessed by the
+// UI goroutine.
+var renderer textRenderer
+
+// textRenderer renders the text view in the background. Only the latest
+// rendering is kept: starting a new one cancels the one in progress, and
+// results arriving after they have been superseded are dropped.
+type textRenderer struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	loading bool // the loading indicator is shown
+	// transform is the jq expression whose results are shown instead of
+	// the nodes, if any
+	transform *jq.Query
+}
+
+// pending reports whether a rendering is in progress.
+func (r *textRenderer) pending() bool {
+	return r.ctx != nil
+}
+
+// stop cancels the rendering in progress, if any.
+func (r *textRenderer) stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.ctx, r.cancel, r.loading = nil, nil, false
+}
+
+// render renders node in the background and shows it in the text view once it
+// is done, unless render or stop is called again in the meantime.
+func (r *textRenderer) render(g *gocui.Gui, node treeNode, format bool) {
+	r.stop()
+	if node == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.ctx, r.cancel = ctx, cancel
+	// raw is replaced by the loader on the UI goroutine, don't read it from
+	// the renderer
+	raw := nodeRaw(node)
+	transform := r.transform
+	go func() {
+		var source internal.LineSource
+		var err error
+		if transform != nil {
+			source, err = transformNode(ctx, transform, node, raw, format)
+		} else {
+			source, err = renderText(ctx, node, raw, format)
+		}
+		if err != nil {
+			return
+		}
+		g.Update(func(g *gocui.Gui) error {
+			if r.ctx != ctx {
+				return nil
+			}
+			r.stop()
+			return showText(g, source)
+		})
+	}()
+	time.AfterFunc(textRenderDelay, func() {
+		g.Update(func(g *gocui.Gui) error {
+			if r.ctx != ctx {
+				return nil
+			}
+			r.loading = true
+			return showText(g, textLines{[]byte("loading...\n")})
+		})
+	})
+}
+
+// renderText returns the lines of the text of node, raw is the raw JSON of
+// node if it has one. Objects and arrays are rendered on demand as the lines
+// are drawn, the text of other nodes is split into lines up front.
+func renderText(ctx context.Context, node treeNode, raw []byte, format bool) (internal.LineSource, error) {
+	if raw != nil {
+		return newJsonLines(raw, jsonPadding), ctx.Err()
+	}
+	data := node.String(jsonPadding)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if format {
+		data = internal.FormatData(data)
+	}
+	return splitLines(ctx, internal.String2Bytes(data))
+}
+
+// textLines are lines that have been rendered up front, each ends with '\n'.
+type textLines [][]byte
+
+func (l textLines) Len() int {
+	return len(l)
+}
+
+func (l textLines) Line(index int) []byte {
+	return l[index]
+}
+
+// splitLines splits data into textLines, like ViewBufferController.Write.
+func splitLines(ctx context.Context, data []byte) (textLines, error) {
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+	lines := make(textLines, 0, 1)
+	for {
+		if len(lines)%renderCheckLines == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			return append(lines, append(data[:len(data):len(data)], '\n')), nil
+		}
+		lines = append(lines, data[:end+1:end+1])
+		data = data[end+1:]
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/anthony-dong/jsonui/internal"
+)
+
+func readLines(lines internal.LineSource) string {
+	var result strings.Builder
+	for i := 0; i < lines.Len(); i++ {
+		result.Write(lines.Line(i))
+	}
+	return result.String()
+}
+
+func TestRenderText(t *testing.T) {
+	tree, err := fromBytes([]byte(`{"a": [1, 2], "b": "{\"c\": true}"}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	a := tree.find([]string{"a"})
+	lines, err := renderText(context.Background(), a, nodeRaw(a), false)
+	if err != nil || readLines(lines) != "[\n  1,\n  2\n]\n" {
+		t.Fatalf("unexpected text of an array: %v", err)
+	}
+	b := tree.find([]string{"b"})
+	lines, err = renderText(context.Background(), b, nodeRaw(b), false)
+	if err != nil || readLines(lines) != "\"{\\\"c\\\": true}\"\n" {
+		t.Fatalf("unexpected text of a string: %v", err)
+	}
+	lines, err = renderText(context.Background(), b, nodeRaw(b), true)
+	if err != nil || readLines(lines) != "{\n  \"c\": true\n}\n" {
+		t.Fatalf("unexpected formatted text of a string: %v", err)
+	}
+}
+
+func TestRenderTextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	node := &stringNode{data: strings.Repeat("x\n", 10)}
+	if _, err := renderText(ctx, node, nil, false); err != context.Canceled {
+		t.Fatalf("expected the rendering to be cancelled, got %v", err)
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	for input, expected := range map[string][]string{
+		"":         {"\n"},
+		"a":        {"a\n"},
+		"a\n":      {"a\n"},
+		"a\n\nb":   {"a\n", "\n", "b\n"},
+		"a\nb\n\n": {"a\n", "b\n", "\n"},
+	} {
+		lines, err := splitLines(context.Background(), []byte(input))
+		if err != nil {
+			t.Fatalf("failed to split %q: %v", input, err)
+		}
+		if lines.Len() != len(expected) {
+			t.Fatalf("expected %q to have %d lines, got %q", input, len(expected), lines)
+		}
+		for i := range expected {
+			if string(lines.Line(i)) != expected[i] {
+				t.Fatalf("expected line %d of %q to be %q, got %q", i, input, expected[i], lines.Line(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthony-dong/jsonui/internal"
+	"github.com/anthony-dong/jsonui/internal/jq"
+	"github.com/jroimartin/gocui"
+)
+
+// maxTransformSize is the number of bytes of results previewed by the text
+// view, the results of a query which doesn't end are cut there. A query with
+// more results doesn't replace the tree.
+const maxTransformSize = 32 << 20
+
+// transformInput is the latest jq expression typed, it is only accessed by
+// the UI goroutine. The text view shows the results of renderer.transform.
+var transformInput = "."
+
+var errTransformTruncated = errors.New("the results are too large, the rest is not shown")
+
+var errTransformTooLarge = errors.New("the results are too large to replace the tree")
+
+// replacement is the replacement of the tree by the results of a jq
+// expression in progress, Esc or opening the jq prompt again cancels it. It is
+// only accessed by the UI goroutine.
+var replacement backgroundJob
+
+// transformNode returns the lines of the results of q over the JSON of node,
+// raw is the raw JSON of node if it has one. An error of q is shown on the
+// line after the results it output before failing.
+func transformNode(ctx context.Context, q *jq.Query, node treeNode, raw []byte, format bool) (internal.LineSource, error) {
+	out := &bytes.Buffer{}
+	err := runTransform(ctx, q, node, raw, func(v interface{}) error {
+		out.WriteString(jq.Encode(v, jsonPadding))
+		out.WriteByte('\n')
+		if out.Len() > maxTransformSize {
+			return errTransformTruncated
+		}
+		return nil
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	data := out.Bytes()
+	if format {
+		data = internal.String2Bytes(internal.FormatData(out.String()))
+	}
+	if err != nil {
+		data = append(data, "error: "+err.Error()+"\n"...)
+	}
+	if len(data) == 0 {
+		return textLines{}, nil
+	}
+	return splitLines(ctx, data)
+}
+
+// runTransform runs q over the JSON of node.
+func runTransform(ctx context.Context, q *jq.Query, node treeNode, raw []byte, fn func(v interface{}) error) error {
+	input, err := decodeNode(node, raw)
+	if err != nil {
+		return err
+	}
+	return q.Run(ctx, input, fn)
+}
+
+// decodedNode is the JSON of the latest node transformed, which is decoded
+// once for all the expressions typed while it is selected.
+var decodedNode struct {
+	sync.Mutex
+	node    treeNode
+	decoded *decodedValue
+}
+
+type decodedValue struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func decodeNode(node treeNode, raw []byte) (interface{}, error) {
+	decodedNode.Lock()
+	if decodedNode.node != node || decodedNode.decoded == nil {
+		decodedNode.node, decodedNode.decoded = node, &decodedValue{}
+	}
+	d := decodedNode.decoded
+	decodedNode.Unlock()
+	d.once.Do(func() {
+		if raw == nil {
+			raw = []byte(node.String(0))
+		}
+		d.value, d.err = jq.Decode(raw)
+	})
+	return d.value, d.err
+}
+
+// transformStatus describes the transformation for the path bar, it is
+// empty when the text view shows the nodes as they are.
+func transformStatus() string {
+	if renderer.transform == nil {
+		return ""
+	}
+	return "jq " + strconv.Quote(renderer.transform.String())
+}
+
+// openTransform opens the jq prompt, the text view previews the results of
+// the expression for the selected node as it is typed. Enter keeps the
+// preview, ctrl+r replaces the tree with the results.
+func openTransform(g *gocui.Gui, v *gocui.View) error {
+	replacement.stop()
+	return openTransformPrompt(g, transformInput, "", renderer.transform)
+}
+
+// openTransformPrompt opens the jq prompt with an input and the error of the
+// previous attempt, previous is the expression restored by Esc.
+func openTransformPrompt(g *gocui.Gui, input, status string, previous *jq.Query) error {
+	return openPrompt(g, &prompt{
+		title: func() string {
+			if status != "" {
+				return " jq (" + status + ") "
+			}
+			return " jq (Enter keep, ctrl+r replace the tree, Esc cancel) "
+		},
+		input: input,
+		change: func(g *gocui.Gui, input string) error {
+			status = ""
+			if err := previewTransform(g, input); err != nil {
+				status = err.Error()
+			}
+			return nil
+		},
+		done: func(g *gocui.Gui, input string) error {
+			if err := previewTransform(g, input); err != nil {
+				return openTransformPrompt(g, input, err.Error(), previous)
+			}
+			return drawPath(g)
+		},
+		apply: replaceWithTransform,
+		cancel: func(g *gocui.Gui) error {
+			renderer.transform = previous
+			_ = drawJSON(g)
+			return drawPath(g)
+		},
+	})
+}
+
+// previewTransform shows the results of the expression input in the text
+// view, or the error compiling it. An empty input shows the node as it is.
+func previewTransform(g *gocui.Gui, input string) error {
+	transformInput = input
+	q, err := compileTransform(input)
+	if err != nil {
+		renderer.stop()
+		renderer.transform = nil
+		_ = showText(g, textLines{[]byte("error: " + err.Error() + "\n")})
+		return err
+	}
+	renderer.transform = q
+	_ = drawJSON(g)
+	return nil
+}
+
+// compileTransform compiles a jq expression, nil is returned for an empty
+// one.
+func compileTransform(input string) (*jq.Query, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	return jq.Compile(input)
+}
+
+// clearTransform shows the nodes as they are in the text view again, and
+// cancels the replacement of the tree in progress.
+func clearTransform(g *gocui.Gui) error {
+	if replacement.pending() {
+		replacement.stop()
+		_ = drawJSON(g)
+		return drawMessage(g, "jq: cancelled")
+	}
+	if renderer.transform == nil {
+		return nil
+	}
+	renderer.transform = nil
+	_ = drawJSON(g)
+	return drawPath(g)
+}
+
+// replaceWithTransform replaces the tree with the results of the expression
+// input for the selected node, an array of them if there are several. The
+// prompt is opened again if the expression fails or its results are larger
+// than maxTransformSize.
+func replaceWithTransform(g *gocui.Gui, input string) error {
+	transformInput = input
+	q, err := compileTransform(input)
+	if err != nil {
+		return openTransformPrompt(g, input, err.Error(), nil)
+	}
+	node := findTreeNode(g)
+	if q == nil || node == nil {
+		return clearTransform(g)
+	}
+	renderer.stop()
+	renderer.transform = nil
+	ctx := replacement.start()
+	raw := nodeRaw(node)
+	_ = drawMessage(g, "jq: transforming... (Esc cancel)")
+	go func() {
+		var results [][]byte
+		size := 0
+		err := runTransform(ctx, q, node, raw, func(v interface{}) error {
+			result := []byte(jq.Encode(v, 0))
+			if size += len(result) + 1; size > maxTransformSize {
+				return errTransformTooLarge
+			}
+			results = append(results, result)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		var data []byte
+		switch {
+		case err != nil:
+		case len(results) == 1:
+			data = results[0]
+		default:
+			data = append(append([]byte{'['}, bytes.Join(results, []byte{','})...), ']')
+		}
+		g.Update(func(g *gocui.Gui) error {
+			if replacement.ctx != ctx {
+				return nil
+			}
+			replacement.stop()
+			if err != nil {
+				_ = drawJSON(g)
+				return openTransformPrompt(g, input, err.Error(), nil)
+			}
+			newTree, err := fromBytes(data)
+			if err != nil {
+				return drawMessage(g, "Error: jq: "+err.Error())
+			}
+			return reloadTree(g, newTree)
+		})
+	}()
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/anthony-dong/jsonui/internal/jq"
+)
+
+func TestTransformNode(t *testing.T) {
+	root, err := fromBytes([]byte(`{"a": [{"b": 1}, {"b": "x"}], "c": "d"}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, c := range []struct {
+		key, query, expected string
+	}{
+		{"a", `.[].b`, "1\n\"x\"\n"},
+		{"a", `map(.b + 1)`, "error: string (\"x\") and number (1) cannot be added\n"},
+		{"a", `.[] | .b + 1`, "2\nerror: string (\"x\") and number (1) cannot be added\n"},
+		{"c", `{(.): .}`, "{\n  \"d\": \"d\"\n}\n"},
+		{"c", `empty`, ""},
+	} {
+		node := root.find(treePosition{c.key})
+		q, err := jq.Compile(c.query)
+		if err != nil {
+			t.Fatalf("failed to compile %s: %v", c.query, err)
+		}
+		source, err := transformNode(context.Background(), q, node, nodeRaw(node), false)
+		if err != nil {
+			t.Fatalf("failed to transform %s: %v", c.key, err)
+		}
+		lines := make([]string, source.Len())
+		for i := range lines {
+			lines[i] = string(source.Line(i))
+		}
+		if text := strings.Join(lines, ""); text != c.expected {
+			t.Fatalf("unexpected results of %s over %s: %q", c.query, c.key, text)
+		}
+	}
+}
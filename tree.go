@@ -3,12 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/anthony-dong/jsonui/internal/orderedmap"
+	"github.com/atotto/clipboard"
 )
 
 const (
@@ -16,6 +15,9 @@ const (
 	treeSignVertical = "│"
 	treeSignUpMiddle = "├"
 	treeSignUpEnding = "└"
+
+	treeSignCollapsed = " (+)"
+	treeSignDuplicate = " (!)"
 )
 
 type treePosition []string
@@ -32,16 +34,9 @@ func (t treePosition) shift() treePosition {
 	return newPosition
 }
 
-type query struct {
-	q string
-}
-
 type treeNode interface {
 	String(int) string
-	draw(w io.Writer, level int) error
-	filter(query query) bool
 	find(treePosition) treeNode
-	search(query string) (treeNode, error)
 	isCollapsable() bool
 	toggleExpanded()
 	collapseAll()
@@ -68,56 +63,113 @@ func (n baseTreeNode) expIcon() string {
 	return "[-]"
 }
 
+// lazyExpandSize is the size up to which the children of a node are expanded
+// when they are loaded, the children of larger nodes start collapsed so that
+// showing the tree doesn't build them all. The README and the help view tell
+// about it.
+const lazyExpandSize = 1024 * 1024
+
+// complexNode is a JSON object. Its children are decoded from raw when they
+// are needed for the first time, raw is the text of the object in the
+// document, not a copy of it.
 type complexNode struct {
 	baseTreeNode
-	data *orderedmap.OrderedMap
-	raw  *orderedmap.OrderedMap
+	shape *objectKeys
+	data  []treeNode // in the order of shape.names
+	raw   json.RawMessage
+}
+
+// load builds the children, see loadChildren.
+func (n *complexNode) load() {
+	// treeIndex is only read when there is something to build, the nodes
+	// built by another goroutine can be used once it has built them
+	if n.data == nil {
+		n.loadIndexed(treeIndex)
+	}
+}
+
+// loadIndexed builds the children like load, from index rather than
+// treeIndex which only the UI goroutine may read.
+func (n *complexNode) loadIndexed(index *fileIndex) {
+	if n.data != nil {
+		return
+	}
+	children := childrenBuilders.Get().(*childrenBuilder)
+	loadChildren(index, n.raw, children.add)
+	n.shape, n.data = children.object()
+	children.reset()
+	childrenBuilders.Put(children)
 }
 
 func (n *complexNode) collapseAll() {
 	n.expanded = false
-	n.data.Foreach(func(key string, value interface{}) {
-		value.(treeNode).collapseAll()
-	})
+	for _, v := range n.data {
+		v.collapseAll()
+	}
 }
 
 func (n *complexNode) expandAll() {
 	n.expanded = true
-	n.data.Foreach(func(key string, value interface{}) {
-		value.(treeNode).expandAll()
-	})
-}
-func (n complexNode) isCollapsable() bool {
-	return true
+	n.load()
+	for _, v := range n.data {
+		v.expandAll()
+	}
 }
-func (n complexNode) search(query string) (treeNode, error) {
-	filteredNode := &complexNode{
-		baseTreeNode: baseTreeNode{true},
-		data:         orderedmap.New(),
+
+// expandToDepth expands the objects and arrays less than depth levels below
+// node, node itself if depth is positive, and collapses the others. Their
+// children are built from index if the document is indexed.
+func expandToDepth(node treeNode, depth int, index *fileIndex) {
+	if !node.isCollapsable() {
+		return
+	}
+	if depth <= 0 {
+		node.collapseAll()
+		return
+	}
+	if !node.isExpanded() {
+		node.toggleExpanded()
 	}
-	n.data.Foreach(func(key string, value interface{}) {
-		if key == query {
-			filteredNode.data.Set(key, value)
-		}
-	})
-	return filteredNode, nil
+	var children []treeNode
+	switch n := node.(type) {
+	case *complexNode:
+		n.loadIndexed(index)
+		children = n.data
+	case *listNode:
+		n.loadIndexed(index)
+		children = n.data
+	}
+	for _, child := range children {
+		expandToDepth(child, depth-1, index)
+	}
+}
+
+func (n *complexNode) isCollapsable() bool {
+	return true
 }
 
-func (n complexNode) get(key string) (treeNode, bool) {
-	v, isOk := n.data.Get(key)
-	if !isOk {
+func (n *complexNode) get(key string) (treeNode, bool) {
+	n.load()
+	i := n.shape.position(key)
+	if i < 0 {
 		return nil, false
 	}
-	return v.(treeNode), true
+	return n.data[i], true
+}
+
+func (n *complexNode) keys() []string {
+	n.load()
+	return n.shape.names
 }
 
-func (n complexNode) keys() []string {
-	return n.data.Keys()
+// isDuplicate reports whether the key is a repeated key of the source object.
+func (n *complexNode) isDuplicate(key string) bool {
+	return n.shape != nil && n.shape.isDuplicate(key)
 }
 
-func (n complexNode) find(tp treePosition) treeNode {
+func (n *complexNode) find(tp treePosition) treeNode {
 	if tp.empty() {
-		return &n
+		return n
 	}
 	e, ok := n.get(tp[0])
 	newTp := tp.shift()
@@ -131,62 +183,49 @@ func (n complexNode) find(tp treePosition) treeNode {
 	return e.find(newTp)
 }
 
-func (n complexNode) String(indent int) string {
+func (n *complexNode) String(indent int) string {
 	if n.raw != nil {
-		return encodeJson(n.raw, indent)
+		return encodeRawJson(n.raw, indent)
 	}
-	result := orderedmap.NewWithSize(n.data.Size())
+	result := orderedmap.NewWithSize(len(n.data))
 	result.SetUseNumber(true)
 	result.SetEscapeHTML(true)
-	n.data.Foreach(func(key string, value interface{}) {
-		data := value.(treeNode).String(indent)
+	for i, key := range n.shape.names {
+		data := n.data[i].String(indent)
 		result.Set(key, json.RawMessage(data))
-	})
+	}
 	return encodeJson(result, indent)
 }
 
-func (n complexNode) draw(writer io.Writer, level int) error {
-	if level == 0 {
-		fmt.Fprintf(writer, "%s\n", "root")
-	}
-	keys := n.keys()
-	length := len(keys)
-	for i, key := range keys {
-		value, _ := n.get(key)
-		var char string
-		if i < length-1 {
-			char = treeSignUpMiddle
-		} else {
-			char = treeSignUpEnding
-		}
-		char += treeSignDash
-		expendedCharacter := ""
-		if value.isCollapsable() && !value.isExpanded() {
-			expendedCharacter += " (+)"
-		}
-		fmt.Fprintf(writer,
-			"%s%s %s%s\n",
-			strings.Repeat("│  ", level),
-			char,
-			key,
-			expendedCharacter,
-		)
-		if value.isExpanded() {
-			value.draw(writer, level+1)
-		}
-	}
-	return nil
-
+// listNode is a JSON array. Its children are decoded from raw when they are
+// needed for the first time.
+type listNode struct {
+	baseTreeNode
+	data   []treeNode
+	raw    json.RawMessage
+	labels []string
 }
-func (n complexNode) filter(query query) bool {
-	return true
 
+// load builds the children, see loadChildren.
+func (n *listNode) load() {
+	// treeIndex is only read when there is something to build, like for
+	// complexNode.load
+	if n.data == nil {
+		n.loadIndexed(treeIndex)
+	}
 }
 
-type listNode struct {
-	baseTreeNode
-	data []treeNode
-	raw  []interface{}
+// loadIndexed builds the children like load, from index rather than
+// treeIndex which only the UI goroutine may read.
+func (n *listNode) loadIndexed(index *fileIndex) {
+	if n.data != nil {
+		return
+	}
+	children := childrenBuilders.Get().(*childrenBuilder)
+	loadChildren(index, n.raw, children.add)
+	n.data = children.list()
+	children.reset()
+	childrenBuilders.Put(children)
 }
 
 func (n *listNode) collapseAll() {
@@ -197,24 +236,22 @@ func (n *listNode) collapseAll() {
 }
 func (n *listNode) expandAll() {
 	n.expanded = true
+	n.load()
 	for _, v := range n.data {
 		v.expandAll()
 	}
 }
-func (n listNode) isCollapsable() bool {
+func (n *listNode) isCollapsable() bool {
 	return true
 }
 
-func (n listNode) search(query string) (treeNode, error) {
-	return nil, nil
-
-}
-func (n listNode) find(tp treePosition) treeNode {
+func (n *listNode) find(tp treePosition) treeNode {
 	if tp.empty() {
-		return &n
+		return n
 	}
-	i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(tp[0], "["), "]"))
-	if err != nil {
+	n.load()
+	i, err := parseListIndex(tp[0])
+	if err != nil || i < 0 || i >= len(n.data) {
 		return nil
 	}
 	newTp := tp.shift()
@@ -224,267 +261,103 @@ func (n listNode) find(tp treePosition) treeNode {
 	return n.data[i].find(newTp)
 }
 
-func (n listNode) String(indent int) string {
-	return encodeJson(n.raw, indent)
-}
-
-func (n listNode) draw(writer io.Writer, level int) error {
-	if level == 0 {
-		fmt.Fprintf(writer, "%s\n", "root")
+// parseListIndex parses a list element position like "3" or "[3]", ignoring
+// any label drawn after the index.
+func parseListIndex(s string) (int, error) {
+	if !strings.HasPrefix(s, "[") {
+		return strconv.Atoi(s)
 	}
-	length := len(n.data)
-	for i, value := range n.data {
-		var char string
-		if i < length-1 {
-			char = treeSignUpMiddle
-		} else {
-			char = treeSignUpEnding
-		}
-		char += treeSignDash
-		expendedCharacter := ""
-
-		if value.isCollapsable() && !value.isExpanded() {
-			expendedCharacter += " (+)"
-		}
-
-		fmt.Fprintf(writer,
-			"%s%s [%d]%s\n",
-			strings.Repeat("│  ", level),
-			char,
-			i,
-			expendedCharacter,
-		)
-		if value.isExpanded() {
-			value.draw(writer, level+1)
-		}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return 0, fmt.Errorf("invalid list index %q", s)
 	}
-	return nil
-
+	return strconv.Atoi(s[1:end])
 }
-func (n listNode) filter(query query) bool {
-	return true
 
+func (n *listNode) String(indent int) string {
+	return encodeRawJson(n.raw, indent)
 }
 
-type floatNode struct {
-	baseTreeNode
-	data json.Number
-}
+// scalarNode implements the treeNode methods which do nothing for the nodes
+// without children. It takes no space, so that the many scalars of a large
+// document are as small as their value.
+type scalarNode struct{}
 
-func (n *floatNode) collapseAll() {
+func (scalarNode) isExpanded() bool {
+	return false
 }
-func (n *floatNode) expandAll() {
+func (scalarNode) toggleExpanded() {
 }
-func (n floatNode) isCollapsable() bool {
-	return false
+func (scalarNode) collapseAll() {
 }
-func (n floatNode) search(query string) (treeNode, error) {
-	return nil, nil
+func (scalarNode) expandAll() {
 }
-func (n floatNode) find(tp treePosition) treeNode {
+func (scalarNode) isCollapsable() bool {
+	return false
+}
+func (scalarNode) find(tp treePosition) treeNode {
 	return nil
-
 }
 
-func (n floatNode) String(_ int) string {
-	return string(n.data)
+// floatNode is a JSON number, kept as its literal.
+type floatNode struct {
+	scalarNode
+	data json.Number
 }
 
-func (n floatNode) draw(writer io.Writer, _ int) error {
-	return nil
-
-}
-func (n floatNode) filter(query query) bool {
-	return true
+func (n *floatNode) String(_ int) string {
+	return string(n.data)
 }
 
 type stringNode struct {
-	baseTreeNode
+	scalarNode
 	data string
 }
 
-func (n *stringNode) collapseAll() {
-}
-func (n *stringNode) expandAll() {
-}
-
-func (n stringNode) isCollapsable() bool {
-	return false
-}
-
-func (n stringNode) find(tp treePosition) treeNode {
-	return nil
-}
-
-func (n stringNode) String(_ int) string {
+func (n *stringNode) String(_ int) string {
 	return encodeJson(n.data, 0)
 }
 
-func (n stringNode) search(query string) (treeNode, error) {
-	return nil, nil
-
-}
-func (n stringNode) draw(writer io.Writer, _ int) error {
-	//fmt.Fprintf(writer, "%s%q\n", strings.Repeat(" ", padding+padding*lvl), n.data)
-	return nil
-
-}
-func (n stringNode) filter(query query) bool {
-	return true
-}
-
+// boolNode is true or false, every true and every false of the documents is
+// the same node, see trueNode and falseNode.
 type boolNode struct {
-	baseTreeNode
+	scalarNode
 	data bool
 }
 
-func (n *boolNode) collapseAll() {
-}
-func (n *boolNode) expandAll() {
-}
-
-func (n boolNode) isCollapsable() bool {
-	return false
-}
-
-func (n boolNode) find(tp treePosition) treeNode {
-	return nil
-}
+var (
+	trueNode  = &boolNode{data: true}
+	falseNode = &boolNode{data: false}
+)
 
-func (n boolNode) String(_ int) string {
+func (n *boolNode) String(_ int) string {
 	return fmt.Sprintf("%t", n.data)
 }
 
-func (n boolNode) search(query string) (treeNode, error) {
-	return nil, nil
-
-}
-func (n boolNode) draw(writer io.Writer, _ int) error {
-	return nil
-
-}
-func (n boolNode) filter(query query) bool {
-	return true
-}
-
+// nilNode is null, every null of the documents is nullNode.
 type nilNode struct {
-	baseTreeNode
+	scalarNode
 }
 
-func (n *nilNode) collapseAll() {
-}
-func (n *nilNode) expandAll() {
-}
+var nullNode = &nilNode{}
 
-func (n nilNode) isCollapsable() bool {
-	return false
-}
-
-func (n nilNode) find(tp treePosition) treeNode {
-	return nil
-}
-
-func (n nilNode) String(_ int) string {
+func (n *nilNode) String(_ int) string {
 	return "null"
 }
 
-func (n nilNode) search(query string) (treeNode, error) {
-	return nil, nil
-
-}
-func (n nilNode) draw(writer io.Writer, _ int) error {
-	return nil
-}
-
-func (n nilNode) filter(query query) bool {
-	return true
+// duplicateKeys returns the position of every duplicate object key in the tree.
+func duplicateKeys(node treeNode, position treePosition) []treePosition {
+	// raw has been validated by the parser
+	positions, _ := parseDuplicateKeys(nodeRaw(node), position)
+	return positions
 }
 
-func newTree(y interface{}) (treeNode, error) {
-	var err error
-	var tree treeNode
-	switch v := y.(type) {
-	case bool:
-		tree = &boolNode{
-			baseTreeNode{true},
-			v,
-		}
-	case string:
-		tree = &stringNode{
-			baseTreeNode{true},
-			v,
-		}
-
-	case nil:
-		tree = &nilNode{baseTreeNode{true}}
-
-	case json.Number:
-		tree = &floatNode{
-			baseTreeNode{true},
-			v,
-		}
-	case *orderedmap.OrderedMap, orderedmap.OrderedMap, map[string]interface{}:
-		tree, err = newComplexNode(v)
-		if err != nil {
-			return nil, err
-		}
-	case []interface{}:
-		data := make([]treeNode, 0, len(v))
-		for _, listItemInterface := range v {
-			listItem, err := newTree(listItemInterface)
-			if err != nil {
-				return nil, err
-			}
-			data = append(data, listItem)
-		}
-		tree = &listNode{
-			baseTreeNode: baseTreeNode{true},
-			data:         data,
-			raw:          v,
-		}
-	default:
-		tree = &stringNode{baseTreeNode{true}, "TODO"}
-	}
-	return tree, nil
-}
-
-func newComplexNode(v interface{}) (treeNode, error) {
-	orderMap, err := toOrderMap(v)
-	if err != nil {
-		return nil, err
-	}
-	data := orderedmap.NewWithSize(orderMap.Size())
-	if err := orderMap.ForeachErr(func(key string, value interface{}) error {
-		childNode, err := newTree(value)
-		if err != nil {
-			return err
-		}
-		data.Set(key, childNode)
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-	tree = &complexNode{
-		baseTreeNode: baseTreeNode{true},
-		data:         data,
-		raw:          orderMap,
-	}
-	return tree, nil
-}
-
-func fromReader(r io.Reader) (treeNode, error) {
-	b, err := io.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
-	return fromBytes(b)
-}
+type decodeFunc func([]byte) (treeNode, error)
 
-func fromFile(filename string) (treeNode, error) {
-	open, err := os.Open(filename)
+func fromClipboard(decode decodeFunc) (treeNode, error) {
+	data, err := clipboard.ReadAll()
 	if err != nil {
 		return nil, err
 	}
-	defer open.Close()
-	return fromReader(open)
+	return decode([]byte(data))
 }
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// treeRow is a visible row of the tree view.
+type treeRow struct {
+	node      treeNode
+	name      string // key of an object member, or index and label of an array element
+	level     int
+	last      bool // last child of its parent
+	duplicate bool
+	element   bool // element of an array, its key is an index
+	path      *rowPath
+	// filter holds the matches below the row when the rows are filtered, it
+	// is nil below a match, where the rows are not filtered
+	filter *filterTrie
+}
+
+// rowPath is the position of a row in the tree, it is linked to the path of
+// the parent row so that a row doesn't copy the keys of its ancestors.
+type rowPath struct {
+	parent *rowPath
+	key    string // object key, or "[index]" for an array element
+}
+
+func (p *rowPath) position() treePosition {
+	depth := 0
+	for cur := p; cur != nil; cur = cur.parent {
+		depth++
+	}
+	position := make(treePosition, depth)
+	for cur := p; cur != nil; cur = cur.parent {
+		depth--
+		position[depth] = cur.key
+	}
+	return position
+}
+
+// treeRows is the flattened list of the visible rows of a tree, the text of a
+// row is only formatted when it is drawn.
+type treeRows struct {
+	rows []treeRow
+	// collapsed are the filtered rows collapsed by the user, the nodes are
+	// left as they are to show them again once the filter is cleared
+	collapsed map[treeNode]bool
+	// highlight matches the parts of the names highlighted in the rows, if
+	// any, see drawnName
+	highlight *matcher
+}
+
+func newTreeRows(root treeNode) *treeRows {
+	if root == nil {
+		// the document is still being loaded
+		return &treeRows{}
+	}
+	rows := []treeRow{{node: root, name: "root", level: -1, last: true}}
+	return &treeRows{rows: appendTreeRows(rows, root, 0, nil, 0)}
+}
+
+// newFilteredTreeRows returns the rows of the nodes which match filter, along
+// with their ancestors and everything below them.
+func newFilteredTreeRows(root treeNode, filter *filterTrie) *treeRows {
+	r := &treeRows{collapsed: make(map[treeNode]bool)}
+	rows := []treeRow{{node: root, name: "root", level: -1, last: true, filter: filter}}
+	r.rows = r.appendChildRows(rows, rows[0])
+	return r
+}
+
+// appendChildRows appends the visible rows of the children of row.
+func (r *treeRows) appendChildRows(rows []treeRow, row treeRow) []treeRow {
+	if row.filter == nil {
+		return appendTreeRows(rows, row.node, row.level+1, row.path, 0)
+	}
+	_, element := row.node.(*listNode)
+	for i, key := range row.filter.keys {
+		child, name, duplicate := childOf(row.node, key)
+		if child == nil {
+			continue
+		}
+		childRow := treeRow{
+			node:      child,
+			name:      name,
+			level:     row.level + 1,
+			last:      i == len(row.filter.keys)-1,
+			duplicate: duplicate,
+			element:   element,
+			path:      &rowPath{parent: row.path, key: key},
+		}
+		if matches := row.filter.children[key]; len(matches.keys) > 0 {
+			childRow.filter = matches
+		}
+		rows = append(rows, childRow)
+		if r.expanded(childRow) {
+			rows = r.appendChildRows(rows, childRow)
+		}
+	}
+	return rows
+}
+
+// expanded reports whether the children of row are visible.
+func (r *treeRows) expanded(row treeRow) bool {
+	if !row.node.isCollapsable() {
+		return false
+	}
+	if row.filter != nil {
+		return !r.collapsed[row.node]
+	}
+	return row.node.isExpanded()
+}
+
+// appendTreeRows appends the visible rows of the children of node, starting
+// with the child at index from.
+func appendTreeRows(rows []treeRow, node treeNode, level int, parent *rowPath, from int) []treeRow {
+	_, element := node.(*listNode)
+	foreachChild(node, from, func(key, name string, child treeNode, duplicate, last bool) {
+		path := &rowPath{parent: parent, key: key}
+		rows = append(rows, treeRow{
+			node:      child,
+			name:      name,
+			level:     level,
+			last:      last,
+			duplicate: duplicate,
+			element:   element,
+			path:      path,
+		})
+		if child.isCollapsable() && child.isExpanded() {
+			rows = appendTreeRows(rows, child, level+1, path, 0)
+		}
+	})
+	return rows
+}
+
+// foreachChild calls fn with the children of an object or array from index
+// from on, along with their key in the tree and the name drawn for them.
+func foreachChild(node treeNode, from int, fn func(key, name string, child treeNode, duplicate, last bool)) {
+	switch n := node.(type) {
+	case *complexNode:
+		keys := n.keys()
+		for i := from; i < len(keys); i++ {
+			key := keys[i]
+			fn(key, displayKey(key), n.data[i], n.isDuplicate(key), i == len(keys)-1)
+		}
+	case *listNode:
+		n.load()
+		for i := from; i < len(n.data); i++ {
+			key := fmt.Sprintf("[%d]", i)
+			fn(key, n.elementName(key, i), n.data[i], false, i == len(n.data)-1)
+		}
+	}
+}
+
+// childOf returns the child of an object or array at key along with the name
+// drawn for it, like foreachChild.
+func childOf(node treeNode, key string) (child treeNode, name string, duplicate bool) {
+	switch n := node.(type) {
+	case *complexNode:
+		if child, isOk := n.get(key); isOk {
+			return child, displayKey(key), n.isDuplicate(key)
+		}
+	case *listNode:
+		n.load()
+		if i, err := parseListIndex(key); err == nil && i >= 0 && i < len(n.data) {
+			return n.data[i], n.elementName(key, i), false
+		}
+	}
+	return nil, "", false
+}
+
+// elementName returns the name drawn for the element at index, its key
+// followed by its label if it has one.
+func (n *listNode) elementName(key string, index int) string {
+	if index < len(n.labels) && n.labels[index] != "" {
+		return key + " " + displayKey(n.labels[index])
+	}
+	return key
+}
+
+// displayKey escapes the control characters of a key, so that a key
+// containing a newline still takes a single row.
+func displayKey(key string) string {
+	if strings.IndexFunc(key, unicode.IsControl) < 0 {
+		return key
+	}
+	quoted := strconv.Quote(key)
+	return quoted[1 : len(quoted)-1]
+}
+
+// node returns the node shown by the row at index.
+func (r *treeRows) node(index int) treeNode {
+	if index < 0 || index >= len(r.rows) {
+		return nil
+	}
+	return r.rows[index].node
+}
+
+// position returns the position of the row at index, the root row and rows
+// out of range are at the empty position.
+func (r *treeRows) position(index int) treePosition {
+	if index < 0 || index >= len(r.rows) {
+		return treePosition{}
+	}
+	return r.rows[index].path.position()
+}
+
+func (r *treeRows) Len() int {
+	return len(r.rows)
+}
+
+func (r *treeRows) Line(index int) []byte {
+	row := r.rows[index]
+	if row.level < 0 {
+		return []byte(row.name + "\n")
+	}
+	line := strings.Builder{}
+	line.WriteString(strings.Repeat(treeSignVertical+"  ", row.level))
+	if row.last {
+		line.WriteString(treeSignUpEnding)
+	} else {
+		line.WriteString(treeSignUpMiddle)
+	}
+	line.WriteString(treeSignDash)
+	line.WriteString(" ")
+	line.WriteString(r.drawnName(row))
+	if row.duplicate {
+		line.WriteString(treeSignDuplicate)
+	}
+	if row.node.isCollapsable() && !r.expanded(row) {
+		line.WriteString(treeSignCollapsed)
+	}
+	line.WriteString("\n")
+	return []byte(line.String())
+}
+
+// drawnName returns the name of a row with the parts matched by r.highlight
+// highlighted: the matching parts of a key, or the whole name when it doesn't
+// show the key as it is or when the value matches.
+func (r *treeRows) drawnName(row treeRow) string {
+	m := r.highlight
+	if m == nil {
+		return row.name
+	}
+	if key := row.path.key; !row.element && m.keys() && m.match(key) {
+		if ranges := m.highlights(key); ranges != nil && row.name == key {
+			return highlightText(key, ranges)
+		}
+		return highlightText(row.name, [][2]int{{0, len(row.name)}})
+	}
+	if text, isOk := scalarText(row.node); isOk && m.values() && m.match(text) {
+		return highlightText(row.name, [][2]int{{0, len(row.name)}})
+	}
+	return row.name
+}
+
+// scalarText returns the text of a scalar node which searches match, the
+// string itself or the literal.
+func scalarText(node treeNode) (string, bool) {
+	switch n := node.(type) {
+	case *stringNode:
+		return n.data, true
+	case *floatNode, *boolNode, *nilNode:
+		return n.String(0), true
+	}
+	return "", false
+}
+
+// subtreeEnd returns the index after the last visible descendant of a row.
+func (r *treeRows) subtreeEnd(index int) int {
+	end := index + 1
+	for end < len(r.rows) && r.rows[end].level > r.rows[index].level {
+		end++
+	}
+	return end
+}
+
+// toggle expands or collapses the node of a row, only the rows of its subtree
+// are touched.
+func (r *treeRows) toggle(index int) {
+	if index <= 0 || index >= len(r.rows) {
+		return
+	}
+	row := r.rows[index]
+	if !row.node.isCollapsable() {
+		return
+	}
+	end := r.subtreeEnd(index)
+	if row.filter != nil {
+		r.collapsed[row.node] = !r.collapsed[row.node]
+	} else {
+		row.node.toggleExpanded()
+	}
+	var children []treeRow
+	if r.expanded(row) {
+		children = r.appendChildRows(nil, row)
+	}
+	r.splice(index+1, end, children)
+}
+
+// reveal expands the ancestors of the node at position and returns the index
+// of its row, or -1 if there is no such node.
+func (r *treeRows) reveal(position treePosition) int {
+	index, depth := r.descend(position, true)
+	if depth < len(position) {
+		return -1
+	}
+	return index
+}
+
+// locate returns the index of the row of the node at position, or of its
+// closest visible ancestor, without expanding anything.
+func (r *treeRows) locate(position treePosition) int {
+	index, _ := r.descend(position, false)
+	return index
+}
+
+// descend follows position from the root row for as long as there are rows,
+// expanding the collapsed ancestors on the way if expand is set. It returns
+// the index of the last row reached and the number of keys followed.
+func (r *treeRows) descend(position treePosition, expand bool) (int, int) {
+	if len(r.rows) == 0 {
+		return -1, 0
+	}
+	index := 0
+	for level, key := range position {
+		if expand && index > 0 && !r.expanded(r.rows[index]) {
+			r.toggle(index)
+		}
+		child := -1
+		for i, end := index+1, r.subtreeEnd(index); i < end; i++ {
+			if r.rows[i].level == level && r.rows[i].path.key == key {
+				child = i
+				break
+			}
+		}
+		if child < 0 {
+			return index, level
+		}
+		index = child
+	}
+	return index, len(position)
+}
+
+// appendRootChildren adds the rows of the children of the root from index
+// from on, which were decoded after the rows were built.
+func (r *treeRows) appendRootChildren(from int) {
+	if len(r.rows) == 0 || r.rows[0].filter != nil {
+		// the filter only covers the children it was applied to
+		return
+	}
+	for i := len(r.rows) - 1; i > 0; i-- {
+		if r.rows[i].level == 0 {
+			r.rows[i].last = false
+			break
+		}
+	}
+	r.rows = appendTreeRows(r.rows, r.rows[0].node, 0, nil, from)
+}
+
+// splice replaces the rows in [start, end) with rows.
+func (r *treeRows) splice(start, end int, rows []treeRow) {
+	tail := len(r.rows) - end
+	size := start + len(rows) + tail
+	if size > cap(r.rows) {
+		grown := make([]treeRow, size, size+size/4)
+		copy(grown, r.rows[:start])
+		copy(grown[start+len(rows):], r.rows[end:])
+		r.rows = grown
+	} else {
+		old := r.rows
+		r.rows = r.rows[:size]
+		copy(r.rows[start+len(rows):], old[end:end+tail])
+		// release the nodes of rows dropped from the end
+		for i := size; i < len(old); i++ {
+			old[i] = treeRow{}
+		}
+	}
+	copy(r.rows[start:], rows)
+}
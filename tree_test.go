@@ -2,12 +2,19 @@ package main
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
-// TODO(gulyasm): write multi lvl draw
+func drawRows(rows *treeRows) string {
+	var result bytes.Buffer
+	for i := 0; i < rows.Len(); i++ {
+		result.Write(rows.Line(i))
+	}
+	return result.String()
+}
+
 func TestDrawTree(t *testing.T) {
-	t.SkipNow()
 	var json = []byte(`
 	{
 		"alma": 1, 
@@ -19,27 +26,67 @@ func TestDrawTree(t *testing.T) {
 		},
 		"wazz": 1 
 	}`)
-	var expected = `
-root
+	var expected = `root
 ├─ alma
-├── barack
-│   ├─ barack_1
-│   ├─ barack_2
-│   ├─ barack_3
-│   │  ├─ [0]
-│   │  ├─ [1]
-│   │  └─ [2]
-│   └─ wazz_barack_4
-└── wazz
+├─ barack
+│  ├─ barack_1
+│  ├─ barack_2
+│  ├─ barack_3
+│  │  ├─ [0]
+│  │  ├─ [1]
+│  │  └─ [2]
+│  └─ wazz_barack_4
+└─ wazz
 `
 	tree, err := fromBytes(json)
 	if err != nil {
 		t.Fatalf("failed to convert JSON to tree")
 	}
-	var result bytes.Buffer
-	tree.draw(&result, 0)
-	if expected != result.String() {
-		t.Fatalf("tree drawing failed. Result tree:\n%s", result.String())
+	if result := drawRows(newTreeRows(tree)); expected != result {
+		t.Fatalf("tree drawing failed. Result tree:\n%s", result)
+	}
+}
+
+func TestToggleTreeRows(t *testing.T) {
+	tree, err := fromBytes([]byte(`{"a":{"b":[1,2],"c":3},"d":4}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	rows := newTreeRows(tree)
+	rows.toggle(1)
+	if result := drawRows(rows); result != "root\n├─ a (+)\n└─ d\n" {
+		t.Fatalf("unexpected rows after collapse:\n%s", result)
+	}
+	rows.toggle(1)
+	rows.toggle(2)
+	if result := drawRows(rows); result != "root\n├─ a\n│  ├─ b (+)\n│  └─ c\n└─ d\n" {
+		t.Fatalf("unexpected rows after expand:\n%s", result)
+	}
+	rows.toggle(2)
+	if result := drawRows(rows); result != drawRows(newTreeRows(tree)) {
+		t.Fatalf("toggled rows differ from a rebuilt tree:\n%s", result)
+	}
+}
+
+func TestExpandToDepth(t *testing.T) {
+	tree, err := fromBytes([]byte(`{"a":{"b":[1,{"c":2}],"d":3},"e":[]}`))
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, c := range []struct {
+		depth    int
+		expected string
+	}{
+		{1, "root\n├─ a (+)\n└─ e (+)\n"},
+		{2, "root\n├─ a\n│  ├─ b (+)\n│  └─ d\n└─ e\n"},
+		{3, "root\n├─ a\n│  ├─ b\n│  │  ├─ [0]\n│  │  └─ [1] (+)\n│  └─ d\n└─ e\n"},
+		{9, "root\n├─ a\n│  ├─ b\n│  │  ├─ [0]\n│  │  └─ [1]\n│  │  │  └─ c\n│  └─ d\n└─ e\n"},
+		{2, "root\n├─ a\n│  ├─ b (+)\n│  └─ d\n└─ e\n"},
+	} {
+		expandToDepth(tree, c.depth, nil)
+		if result := drawRows(newTreeRows(tree)); result != c.expected {
+			t.Fatalf("unexpected rows expanded to depth %d:\n%s", c.depth, result)
+		}
 	}
 }
 
@@ -86,3 +133,162 @@ func TestShift(t *testing.T) {
 		}
 	}
 }
+
+func TestDuplicateKeys(t *testing.T) {
+	raw := []byte(`{"a": 1, "b": {"c": 1, "c": 2, "c": 3}, "a": [{"d": 1, "d": 2}]}`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	if v := tree.find([]string{"b", "c#3"}); v == nil || v.String(0) != "3" {
+		t.Fatalf("duplicate key should be kept as c#3")
+	}
+	positions := duplicateKeys(tree, treePosition{})
+	expected := []string{`["b"]["c#2"]`, `["b"]["c#3"]`, `["a#2"]`, `["a#2"][0]["d#2"]`}
+	if len(positions) != len(expected) {
+		t.Fatalf("expected %d duplicate keys, got %v", len(expected), positions)
+	}
+	for i, p := range positions {
+		if formatPath(tree, p) != expected[i] {
+			t.Fatalf("expected duplicate key %s, got %s", expected[i], formatPath(tree, p))
+		}
+	}
+}
+
+func TestDuplicateKeySuffixTaken(t *testing.T) {
+	raw := []byte(`{"x": {"a": 1, "a": 2, "a#2": 3, "a": 4}}`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for path, expected := range map[string]string{"a": "1", "a#3": "2", "a#2": "3", "a#4": "4"} {
+		if v := tree.find([]string{"x", path}); v == nil || v.String(0) != expected {
+			t.Fatalf("expected %s at x.%s", expected, path)
+		}
+	}
+	// the positions found without building the tree name the keys the same
+	positions := duplicateKeys(tree, treePosition{})
+	expected := []string{`["x"]["a#3"]`, `["x"]["a#4"]`}
+	if len(positions) != len(expected) {
+		t.Fatalf("expected %d duplicate keys, got %v", len(expected), positions)
+	}
+	for i, p := range positions {
+		if formatPath(tree, p) != expected[i] {
+			t.Fatalf("expected duplicate key %s, got %s", expected[i], formatPath(tree, p))
+		}
+	}
+}
+
+func TestLazyTree(t *testing.T) {
+	raw := []byte(`{"a": {"b": [1, {"c": "d"}]}, "e": [true, null, 1.50]}`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	a, _ := tree.(*complexNode).get("a")
+	if a.(*complexNode).data == nil {
+		t.Fatalf("a small document should be built in one pass")
+	}
+	if !a.isExpanded() {
+		t.Fatalf("children of a small document should start expanded")
+	}
+	if v := tree.find([]string{"a", "b", "[1]", "c"}); v == nil || v.String(0) != `"d"` {
+		t.Fatalf("unexpected node at a.b[1].c")
+	}
+	if s := tree.String(0); s != `{"a":{"b":[1,{"c":"d"}]},"e":[true,null,1.50]}` {
+		t.Fatalf("unexpected tree string: %s", s)
+	}
+}
+
+func TestLazyTreeCollapsed(t *testing.T) {
+	raw := []byte(`[{"padding": "` + strings.Repeat("x", lazyExpandSize) + `"}, [1]]`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	for _, child := range tree.(*listNode).data {
+		if child.isExpanded() {
+			t.Fatalf("children of a large node should start collapsed")
+		}
+	}
+	if result := drawRows(newTreeRows(tree)); result != "root\n├─ [0] (+)\n└─ [1] (+)\n" {
+		t.Fatalf("unexpected tree drawing:\n%s", result)
+	}
+	first := tree.(*listNode).data[0].(*complexNode)
+	if first.data != nil {
+		t.Fatalf("the children of a large document should be built when they are needed")
+	}
+	if v := tree.find([]string{"[0]", "padding"}); v == nil || len(v.String(0)) != lazyExpandSize+2 {
+		t.Fatalf("find should build the nodes on its way")
+	}
+	if first.data == nil {
+		t.Fatalf("find should build the nodes on its way")
+	}
+}
+
+func TestTreeRowsPosition(t *testing.T) {
+	raw := []byte(`{"a b": {"[0]": ["x", {"├─ │": 1, "new\nline": 2}]}}`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	rows := newTreeRows(tree)
+	expected := []string{``, `["a b"]`, `["a b"]["[0]"]`, `["a b"]["[0]"][0]`, `["a b"]["[0]"][1]`,
+		`["a b"]["[0]"][1]["├─ │"]`, `["a b"]["[0]"][1]["new\nline"]`}
+	if rows.Len() != len(expected) {
+		t.Fatalf("expected %d rows, got:\n%s", len(expected), drawRows(rows))
+	}
+	for i := range expected {
+		position := rows.position(i)
+		if p := formatPath(tree, position); p != expected[i] {
+			t.Fatalf("expected path %s of row %d, got %s", expected[i], i, p)
+		}
+		if tree.find(position) != rows.node(i) {
+			t.Fatalf("row %d doesn't map to the node at %s", i, expected[i])
+		}
+	}
+	if line := string(rows.Line(6)); line != "│  │  │  └─ new\\nline\n" {
+		t.Fatalf("unexpected line %q", line)
+	}
+}
+
+func TestAppendRootChildren(t *testing.T) {
+	raw := []byte(`[{"a":1},2,3]`)
+	root := &listNode{baseTreeNode: baseTreeNode{true}, data: make([]treeNode, 0), raw: raw}
+	rows := newTreeRows(root)
+	parsed, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	children := parsed.(*listNode).data
+	root.data = append(root.data, children[:2]...)
+	rows.appendRootChildren(0)
+	root.data = append(root.data, children[2:]...)
+	rows.appendRootChildren(2)
+	if result := drawRows(rows); result != "root\n├─ [0]\n│  └─ a\n├─ [1]\n└─ [2]\n" {
+		t.Fatalf("unexpected rows:\n%s", result)
+	}
+}
+
+func TestRevealTreeRows(t *testing.T) {
+	raw := []byte(`{"a": {"b": [1, {"c": 2}]}, "d": 3}`)
+	tree, err := fromBytes(raw)
+	if err != nil {
+		t.Fatalf("failed to convert JSON to tree: %v", err)
+	}
+	tree.collapseAll()
+	rows := newTreeRows(tree)
+	index := rows.reveal(treePosition{"a", "b", "[1]", "c"})
+	if index != 5 || rows.node(index) != tree.find([]string{"a", "b", "[1]", "c"}) {
+		t.Fatalf("unexpected row %d:\n%s", index, drawRows(rows))
+	}
+	if result := drawRows(rows); result != "root\n├─ a\n│  └─ b\n│  │  ├─ [0]\n│  │  └─ [1]\n│  │  │  └─ c\n└─ d\n" {
+		t.Fatalf("unexpected rows:\n%s", result)
+	}
+	if index := rows.reveal(treePosition{"a", "x"}); index != -1 {
+		t.Fatalf("expected no row for a missing key, got %d", index)
+	}
+	if index := rows.reveal(treePosition{}); index != 0 {
+		t.Fatalf("expected the root row, got %d", index)
+	}
+}
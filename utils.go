@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 )
 
@@ -52,3 +53,32 @@ func (c *cacheData) set(key string, value interface{}) {
 	c.cacheList = append(c.cacheList, key)
 	c.cache[key] = value
 }
+
+// backgroundJob is a task run in the background on behalf of the UI, only the
+// latest one is kept: starting another or stopping it cancels it, and the
+// results arriving afterwards are dropped.
+type backgroundJob struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// start cancels the job in progress, if any, and returns the context of the
+// new one.
+func (j *backgroundJob) start() context.Context {
+	j.stop()
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	return j.ctx
+}
+
+// pending reports whether a job is in progress.
+func (j *backgroundJob) pending() bool {
+	return j.ctx != nil
+}
+
+// stop cancels the job in progress, if any.
+func (j *backgroundJob) stop() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.ctx, j.cancel = nil, nil
+}